@@ -0,0 +1,239 @@
+// Package agent 实现 gomockAgent 的核心：调用 OpenAI 兼容的 chat completions 接口，
+// 执行模型请求的工具，直到得到最终回复。
+//
+// 典型用法：
+//
+//	a := agent.New(agent.Options{APIKey: key, Endpoint: url, Model: "gpt-4o", Tools: tools})
+//	session := a.NewSession()
+//	session.Subscribe(agent.SubscriberFunc(func(e agent.Event) { ... }))
+//	reply, err := session.Send(ctx, "hello")
+//
+// 过程中的文本、工具调用、用量与错误以 Event 的形式发送给订阅者。
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DefaultSystemPrompt 是未指定 SystemPrompt 时使用的系统提示
+const DefaultSystemPrompt = "You are a helpful Go programmer assistant. You have access to tools to interact with the local filesystem (read, list, edit files). Use them when appropriate to fulfill the user's request. When editing, be precise about the changes. Respond ONLY with tool calls if you need to use tools, otherwise respond with text."
+
+// Options 配置 Agent
+type Options struct {
+	APIKey       string
+	Endpoint     string                        // 完整的 chat completions URL，例如 https://api.openai.com/v1/chat/completions
+	Model        string                        // Profile.Model 非空时以其为准
+	SystemPrompt string                        // 为空时使用 DefaultSystemPrompt
+	Examples     []OpenAIChatCompletionMessage // few-shot 示例，每个会话中紧跟在系统提示之后
+	Tools        []ToolDefinition
+	Profile      *Profile // 为 nil 时使用 DefaultProfile
+	Prices       map[string]ModelPrice
+	Budget       BudgetConfig // 每个会话的预算
+	StrictTools  bool         // 以 OpenAI strict 模式发送工具定义
+	Timeout      time.Duration
+	Debug        bool // 打印 HTTP 请求与响应
+	// ScopedInstructions 返回与工具调用相关、只在需要时注入的指令，例如按 glob 匹配的项目规则
+	ScopedInstructions ScopedInstructionsFunc
+	// Memory 为每个会话创建对话记忆，为 nil 时使用 Profile.Memory
+	Memory MemoryFactory
+}
+
+// Agent 保存模型、工具与请求参数，可被多个 Session 并发使用
+type Agent struct {
+	restyClient   *resty.Client
+	apiKey        string
+	endpoint      string
+	model         string                    // Store the target model name
+	tools         map[string]ToolDefinition // Map of tool names to tool definitions
+	systemPrompt  string                    // Store the system prompt
+	examples      []OpenAIChatCompletionMessage
+	strictSchemas map[string]map[string]any // strict 模式下发送的参数 schema
+	nonStrict     map[string]error          // 无法使用 strict 模式的工具及原因
+	profile       Profile
+	prices        map[string]ModelPrice
+	budget        BudgetConfig
+	repairs       *argRepairRecorder
+	subs          subscribers
+	memory        MemoryFactory // 为 nil 时发送完整对话
+
+	scopedInstructions ScopedInstructionsFunc
+}
+
+// New 根据 Options 创建 Agent
+func New(opts Options) *Agent {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	toolMap := make(map[string]ToolDefinition)
+	for _, tool := range opts.Tools {
+		toolMap[tool.Name] = tool
+	}
+	profile := DefaultProfile()
+	if opts.Profile != nil {
+		profile = *opts.Profile
+	}
+	model := opts.Model
+	if profile.Model != "" {
+		model = profile.Model
+	}
+	memory := opts.Memory
+	if memory == nil && profile.Memory != nil {
+		memory = profile.Memory.factory()
+	}
+	systemPrompt := opts.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = DefaultSystemPrompt
+	}
+	a := &Agent{
+		restyClient:  resty.New().SetTimeout(timeout).SetDebug(opts.Debug),
+		apiKey:       opts.APIKey,
+		endpoint:     opts.Endpoint,
+		model:        model,
+		tools:        toolMap,
+		systemPrompt: systemPrompt,
+		examples:     opts.Examples,
+		profile:      profile,
+		prices:       opts.Prices,
+		budget:       opts.Budget,
+		repairs:      &argRepairRecorder{stats: map[string]*ArgRepairStats{}},
+		memory:       memory,
+
+		scopedInstructions: opts.ScopedInstructions,
+	}
+	if opts.StrictTools {
+		a.enableStrictTools()
+	}
+	return a
+}
+
+// Model 返回请求使用的模型名
+func (a *Agent) Model() string { return a.model }
+
+// Tools 返回已注册的工具
+func (a *Agent) Tools() map[string]ToolDefinition { return a.tools }
+
+// Subscribe 订阅该 Agent 所有会话的事件，返回取消订阅的函数
+func (a *Agent) Subscribe(sub Subscriber) (unsubscribe func()) { return a.subs.add(sub) }
+
+// NonStrictTools 返回开启 StrictTools 后仍以普通模式发送的工具及原因（例如参数含 map）
+func (a *Agent) NonStrictTools() map[string]error { return a.nonStrict }
+
+// RepairStats 返回按模型统计的工具参数修复情况
+func (a *Agent) RepairStats() ([]string, map[string]ArgRepairStats) { return a.repairs.Snapshot() }
+
+// systemRole 返回系统提示使用的角色，o 系列模型使用 developer
+func (a *Agent) systemRole() string {
+	if a.profile.SystemRole != "" {
+		return a.profile.SystemRole
+	}
+	return "system"
+}
+
+func (a *Agent) enableStrictTools() {
+	a.strictSchemas = make(map[string]map[string]any, len(a.tools))
+	a.nonStrict = map[string]error{}
+	for name, tool := range a.tools {
+		strict, err := StrictSchema(tool.InputSchema)
+		if err != nil {
+			a.nonStrict[name] = err
+			continue
+		}
+		a.strictSchemas[name] = strict
+	}
+}
+
+// ErrNoChoices 表示响应中没有任何 choice
+var ErrNoChoices = errors.New("OpenAI response contained no choices")
+
+// BudgetExceededError 表示会话用量已达到预算，工具循环被停止
+type BudgetExceededError struct {
+	Reason string
+}
+
+func (e *BudgetExceededError) Error() string { return "budget exceeded: " + e.Reason }
+
+// requestOption 在发送前修改单次请求，例如指定 response_format
+type requestOption func(*OpenAIChatCompletionRequest)
+
+// withoutTools 发送不带工具定义的请求
+func withoutTools(req *OpenAIChatCompletionRequest) {
+	req.Tools = nil
+	req.ToolChoice = nil
+	req.ParallelToolCalls = nil
+}
+
+// callOpenAICompletion 发送一次请求
+func (a *Agent) callOpenAICompletion(ctx context.Context, conversation []OpenAIChatCompletionMessage, opts ...requestOption) (*OpenAIChatCompletionResponse, error) {
+
+	// Prepare tools in OpenAI format
+	openaiTools := []OpenAIChatCompletionTool{}
+	for _, toolDef := range a.tools {
+		function := OpenAIChatCompletionFunctionDefinition{
+			Name:        toolDef.Name,
+			Description: toolDef.Description,
+			Parameters:  toolDef.InputSchema,
+		}
+		if strict, ok := a.strictSchemas[toolDef.Name]; ok {
+			function.Parameters = strict
+			function.Strict = true
+		}
+		openaiTools = append(openaiTools, OpenAIChatCompletionTool{
+			Type:     "function",
+			Function: function,
+		})
+	}
+
+	// Build request payload
+	requestPayload := OpenAIChatCompletionRequest{
+		Model:    a.model,
+		Messages: conversation,
+		Tools:    openaiTools,
+	}
+	a.profile.applyTo(&requestPayload)
+	if len(openaiTools) > 0 {
+		requestPayload.ToolChoice = "auto" // Let the model decide when to use tools
+	} else {
+		requestPayload.ParallelToolCalls = nil // 没有工具时 API 不接受该参数
+	}
+	for _, opt := range opts {
+		opt(&requestPayload)
+	}
+	reply := &OpenAIChatCompletionResponse{}
+	resp, err := a.restyClient.R().
+		SetContext(ctx).
+		SetBody(requestPayload).
+		SetAuthToken(a.apiKey).
+		SetResult(reply).
+		Post(a.endpoint)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+
+	if resp.IsError() {
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode(), string(resp.Body()))
+	}
+	return reply, nil
+}
+
+// Complete 发送一次独立的请求（不带工具与对话历史），返回回复文本。
+// examples 是放在系统提示与用户消息之间的 few-shot 示例
+func (a *Agent) Complete(ctx context.Context, systemPrompt, userPrompt string, examples ...OpenAIChatCompletionMessage) (string, error) {
+	s := a.NewSession()
+	s.BeginTurn(userPrompt)
+	conversation := []OpenAIChatCompletionMessage{{Role: a.systemRole(), Content: systemPrompt}}
+	conversation = append(conversation, examples...)
+	conversation = append(conversation, OpenAIChatCompletionMessage{Role: "user", Content: userPrompt})
+	message, err := s.nextAssistantMessage(ctx, conversation, withoutTools)
+	s.finishTurn(err)
+	if err != nil {
+		return "", err
+	}
+	return message.Content, nil
+}
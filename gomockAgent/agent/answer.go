@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// -------------------------- 结构化最终回答 --------------------------
+// 调用方提供 Go 类型或 JSON schema，agent 照常执行工具循环，最终回复必须是符合 schema 的 JSON。
+// 请求带上 response_format: json_schema；本地再用 ValidateSchema 校验一次（部分兼容服务会忽略
+// response_format），不通过时把问题反馈给模型重新回答，最多 MaxRetries 次。
+// strict 形式去掉了 minLength 等关键字并允许可选字段为 null，只用于 response_format；
+// 本地校验使用原 schema，与工具参数一样先把 null 按未提供处理。
+
+// AnswerSpec 描述最终回答的格式
+type AnswerSpec struct {
+	Name       string         // response_format 中的名字，只能包含字母、数字、_ 和 -
+	Schema     map[string]any // 最终回答的 JSON schema，用于本地校验
+	Strict     bool           // 以 strict 模式发送 response_format
+	StrictForm map[string]any // Strict 时发送的 schema，为空时发送 Schema
+	MaxRetries int            // 校验失败后重新询问的次数
+}
+
+// DefaultAnswerRetries 是 AnswerSpecFor 与 AnswerSpecFromJSON 使用的重试次数
+const DefaultAnswerRetries = 2
+
+// AnswerSpecFor 根据 T 生成 AnswerSpec，优先使用 strict 模式
+func AnswerSpecFor[T any]() *AnswerSpec {
+	spec := &AnswerSpec{Name: "final_answer", Schema: GenerateSchema[T](), MaxRetries: DefaultAnswerRetries}
+	if strict, err := StrictSchema(spec.Schema); err == nil {
+		spec.StrictForm, spec.Strict = strict, true
+	}
+	return spec
+}
+
+// AnswerSpecFromJSON 使用调用方提供的 JSON schema；能转换为 strict 模式时自动转换
+func AnswerSpecFromJSON(data []byte) (*AnswerSpec, error) {
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse answer schema: %w", err)
+	}
+	spec := &AnswerSpec{Name: "final_answer", Schema: schema, MaxRetries: DefaultAnswerRetries}
+	if strict, err := StrictSchema(schema); err == nil {
+		spec.StrictForm, spec.Strict = strict, true
+	}
+	return spec, nil
+}
+
+func (s *AnswerSpec) responseFormat() requestOption {
+	schema := s.Schema
+	if s.Strict && s.StrictForm != nil {
+		schema = s.StrictForm
+	}
+	format := &OpenAIResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &OpenAIJSONSchema{
+			Name:   s.Name,
+			Schema: compactSchema(schema),
+			Strict: s.Strict,
+		},
+	}
+	return func(req *OpenAIChatCompletionRequest) { req.ResponseFormat = format }
+}
+
+func (s *AnswerSpec) instructions() string {
+	schema, _ := json.Marshal(compactSchema(s.Schema))
+	return "When you have finished using tools, your final reply must be a single JSON value matching this JSON schema, " +
+		"with no surrounding text or code fences:\n" + string(schema)
+}
+
+// validate 校验回复内容，返回规范化后的 JSON
+func (s *AnswerSpec) validate(content string) (json.RawMessage, []SchemaProblem, error) {
+	text := strings.TrimSpace(content)
+	if stripped, ok := stripCodeFence(text); ok {
+		text = stripped
+	}
+	value, err := decodeJSONValue(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf("final answer is not valid JSON: %w", err)
+	}
+	if s.Strict {
+		// strict 模式下可选字段以 null 出现，按未提供处理后再用原 schema 校验
+		value = dropNulls(value)
+	}
+	if problems := ValidateSchema(s.Schema, value); len(problems) > 0 {
+		return nil, problems, nil
+	}
+	if s.Strict {
+		answer, err := json.Marshal(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode final answer: %w", err)
+		}
+		return answer, nil, nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(text)); err != nil {
+		return nil, nil, fmt.Errorf("final answer is not valid JSON: %w", err)
+	}
+	return compact.Bytes(), nil, nil
+}
+
+// AnswerValidationError 表示重试后最终回答仍不符合 schema
+type AnswerValidationError struct {
+	Content  string
+	Problems []SchemaProblem
+	Err      error
+}
+
+func (e *AnswerValidationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("final answer rejected: %v. Answer was: %s", e.Err, e.Content)
+	}
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.String()
+	}
+	return fmt.Sprintf("final answer does not match the schema: %s. Answer was: %s", strings.Join(parts, "; "), e.Content)
+}
+
+// Ask 在新会话中执行一轮对话（含工具循环），返回模型的最终文本回复
+func (a *Agent) Ask(ctx context.Context, prompt string) (string, error) {
+	return a.NewSession().Send(ctx, prompt)
+}
+
+// AskStructured 在新会话中执行一轮对话，返回通过 spec 校验的 JSON
+func (a *Agent) AskStructured(ctx context.Context, prompt string, spec *AnswerSpec) (json.RawMessage, error) {
+	return a.NewSession().SendStructured(ctx, prompt, spec)
+}
+
+// SendStructured 发送一条用户消息，最终回复必须通过 spec 校验；不通过时把问题反馈给模型重新回答
+func (s *Session) SendStructured(ctx context.Context, prompt string, spec *AnswerSpec) (json.RawMessage, error) {
+	s.BeginTurn(prompt)
+	answer, err := s.structuredTurn(ctx, prompt, spec)
+	s.finishTurn(err)
+	return answer, err
+}
+
+func (s *Session) structuredTurn(ctx context.Context, prompt string, spec *AnswerSpec) (json.RawMessage, error) {
+	s.mu.Lock()
+	conversation := append(s.messages, OpenAIChatCompletionMessage{Role: "user", Content: prompt})
+	s.mu.Unlock()
+	conversation = append(conversation, OpenAIChatCompletionMessage{Role: s.agent.systemRole(), Content: spec.instructions()})
+	defer func() {
+		s.mu.Lock()
+		s.messages = conversation
+		s.mu.Unlock()
+	}()
+	for attempt := 0; ; attempt++ {
+		var err error
+		conversation, err = s.runToolLoop(ctx, conversation, spec.responseFormat())
+		if err != nil {
+			return nil, err
+		}
+		final := conversation[len(conversation)-1]
+		answer, problems, err := spec.validate(final.Content)
+		if err == nil && len(problems) == 0 {
+			return answer, nil
+		}
+		if attempt >= spec.MaxRetries {
+			return nil, &AnswerValidationError{Content: final.Content, Problems: problems, Err: err}
+		}
+
+		feedback := "Your final answer was rejected"
+		if err != nil {
+			feedback += ": " + err.Error()
+		} else {
+			feedback += " because it does not match the schema:"
+			for _, p := range problems {
+				feedback += "\n  - " + p.String()
+			}
+		}
+		s.notice("answer_rejected", "%s", feedback)
+		conversation = append(conversation, OpenAIChatCompletionMessage{
+			Role:    "user",
+			Content: feedback + "\nReply again with only the corrected JSON.",
+		})
+	}
+}
+
+// AskAs 以 T 作为最终回答的类型
+func AskAs[T any](ctx context.Context, a *Agent, prompt string) (T, error) {
+	var result T
+	answer, err := a.AskStructured(ctx, prompt, AnswerSpecFor[T]())
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(answer, &result); err != nil {
+		return result, fmt.Errorf("failed to decode final answer: %w", err)
+	}
+	return result, nil
+}
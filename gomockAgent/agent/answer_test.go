@@ -0,0 +1,90 @@
+package agent
+
+import "testing"
+
+func TestAnswerSpecValidatesAgainstOriginalSchema(t *testing.T) {
+	spec, err := AnswerSpecFromJSON([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 3},
+			"note": {"type": "string"}
+		},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.Strict || spec.StrictForm == nil {
+		t.Fatalf("expected a strict form, got %+v", spec)
+	}
+	if _, ok := spec.Schema["additionalProperties"]; ok {
+		t.Fatalf("Schema must stay the original schema, got %v", spec.Schema)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string // 规范化后的回答，空表示应被拒绝
+	}{
+		{"valid", `{"name":"alice","note":"hi"}`, `{"name":"alice","note":"hi"}`},
+		{"null optional field is dropped", `{"name":"alice","note":null}`, `{"name":"alice"}`},
+		{"code fence", "```json\n{\"name\": \"alice\", \"note\": null}\n```", `{"name":"alice"}`},
+		{"minLength", `{"name":"","note":null}`, ""},
+		{"too short", `{"name":"al","note":"hi"}`, ""},
+		{"null required field", `{"name":null,"note":"hi"}`, ""},
+		{"optional non-nullable field with the wrong type", `{"name":"alice","note":3}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, problems, err := spec.validate(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(problems) == 0 {
+					t.Fatalf("expected %s to be rejected, got %s", tt.content, answer)
+				}
+				return
+			}
+			if len(problems) > 0 {
+				t.Fatalf("unexpected problems: %v", problems)
+			}
+			if string(answer) != tt.want {
+				t.Fatalf("answer = %s, want %s", answer, tt.want)
+			}
+		})
+	}
+}
+
+// 不使用 strict 模式时 null 不会被丢弃，非 nullable 的可选字段不接受 null
+func TestAnswerSpecNonStrictRejectsNull(t *testing.T) {
+	spec := &AnswerSpec{Name: "final_answer", Schema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"note": map[string]any{"type": "string"}},
+	}}
+	if _, problems, err := spec.validate(`{"note":null}`); err != nil || len(problems) == 0 {
+		t.Fatalf("expected null to be rejected, got problems %v, error %v", problems, err)
+	}
+	answer, problems, err := spec.validate(`{ "note": "x" }`)
+	if err != nil || len(problems) > 0 || string(answer) != `{"note":"x"}` {
+		t.Fatalf("answer = %s, problems %v, error %v", answer, problems, err)
+	}
+}
+
+type answerSample struct {
+	Name string `json:"name" jsonschema:"required,minLength=3"`
+	Note string `json:"note,omitempty"`
+}
+
+func TestAnswerSpecForKeepsMinLength(t *testing.T) {
+	spec := AnswerSpecFor[answerSample]()
+	if !spec.Strict {
+		t.Fatal("expected strict mode")
+	}
+	if _, problems, _ := spec.validate(`{"name":"","note":null}`); len(problems) == 0 {
+		t.Fatal("minLength must be enforced locally")
+	}
+	if answer, problems, _ := spec.validate(`{"name":"bob","note":null}`); len(problems) > 0 || string(answer) != `{"name":"bob"}` {
+		t.Fatalf("answer = %s, problems %v", answer, problems)
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// -------------------------- 工具审批 --------------------------
+// 设置了 ToolApprover 的会话在执行每个工具前先发送 ToolApprovalRequested，
+// 再等待 approver 返回：nil 表示批准，返回 error 表示拒绝，错误信息作为工具结果回传给模型。
+// approver 可以阻塞到用户在 UI 中作出选择，ctx 在本轮被取消时结束。
+
+// ToolApprover 决定是否执行一次工具调用
+type ToolApprover func(ctx context.Context, call ToolApprovalRequested) error
+
+// ToolDeniedError 表示工具调用未被批准
+type ToolDeniedError struct {
+	Tool   string
+	Reason string
+}
+
+func (e *ToolDeniedError) Error() string {
+	if e.Reason == "" {
+		return "the user denied the " + e.Tool + " tool call"
+	}
+	return "the user denied the " + e.Tool + " tool call: " + e.Reason
+}
+
+// approverHolder 保存会话的 approver，可在轮次之间更换
+type approverHolder struct {
+	mu sync.Mutex
+	fn ToolApprover
+}
+
+func (h *approverHolder) get() ToolApprover {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fn
+}
+
+// SetApprover 设置工具审批函数，nil 表示不需要审批
+func (s *Session) SetApprover(approver ToolApprover) {
+	s.approver.mu.Lock()
+	defer s.approver.mu.Unlock()
+	s.approver.fn = approver
+}
+
+// approve 在有 approver 时请求审批
+func (s *Session) approve(ctx context.Context, started ToolCallStarted) error {
+	approver := s.approver.get()
+	if approver == nil {
+		return nil
+	}
+	request := ToolApprovalRequested{
+		EventMeta: s.meta(),
+		CallID:    started.CallID,
+		Name:      started.Name,
+		Arguments: started.Arguments,
+	}
+	s.emit(request)
+	return approver(ctx, request)
+}
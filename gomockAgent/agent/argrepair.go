@@ -0,0 +1,493 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// -------------------------- 工具参数修复 --------------------------
+// 较弱的模型生成的 tool_call arguments 经常不是合法 JSON：被截断、尾随逗号、单引号、
+// 没加引号的 key、Python 风格的 True/None、被包在 ```json 代码块里，或者数字写成字符串。
+// RepairToolArguments 先修正语法，再按工具的 InputSchema 做类型转换；
+// 修复失败时返回带期望 schema 的错误，交给模型重试。
+
+// RepairToolArguments 返回可直接传给工具的参数以及做过的修复（为空表示原样可用）
+func RepairToolArguments(tool string, raw string, schema map[string]any) (json.RawMessage, []string, error) {
+	var repairs []string
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return json.RawMessage("{}"), nil, nil
+	}
+
+	value, err := decodeJSONValue(text)
+	if err != nil {
+		fixed, syntaxRepairs := repairJSONSyntax(text)
+		value, err = decodeJSONValue(fixed)
+		if err != nil {
+			return nil, syntaxRepairs, &ArgumentRepairError{Tool: tool, Raw: raw, Err: err, Schema: schema}
+		}
+		if len(syntaxRepairs) == 0 {
+			syntaxRepairs = []string{"fixed invalid escapes"}
+		}
+		repairs = append(repairs, syntaxRepairs...)
+	}
+
+	value = coerceToSchema(schema, value, "$", &repairs)
+	if want := schemaTypes(schema); len(want) > 0 && !typeAllowed(want, jsonType(value), value) {
+		err := fmt.Errorf("expected a JSON %s, got %s", strings.Join(want, " or "), jsonType(value))
+		return nil, repairs, &ArgumentRepairError{Tool: tool, Raw: raw, Err: err, Schema: schema}
+	}
+	if len(repairs) == 0 {
+		return json.RawMessage(text), nil, nil
+	}
+	fixed, err := json.Marshal(value)
+	if err != nil {
+		return nil, repairs, &ArgumentRepairError{Tool: tool, Raw: raw, Err: err, Schema: schema}
+	}
+	return fixed, repairs, nil
+}
+
+// ArgumentRepairError 表示参数无法修复成工具可用的 JSON
+type ArgumentRepairError struct {
+	Tool   string
+	Raw    string
+	Err    error
+	Schema map[string]any
+}
+
+func (e *ArgumentRepairError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "arguments for %s could not be parsed or repaired: %v. Arguments were: %s", e.Tool, e.Err, e.Raw)
+	if schema, err := json.Marshal(compactSchema(e.Schema)); err == nil {
+		fmt.Fprintf(&b, "\nResend the call with a single JSON object matching this schema: %s", schema)
+	}
+	return b.String()
+}
+
+func (e *ArgumentRepairError) Unwrap() error { return e.Err }
+
+func decodeJSONValue(text string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+// -------------------------- 语法修复 --------------------------
+
+// repairJSONSyntax 逐字符重写 text，尽量得到合法 JSON
+func repairJSONSyntax(text string) (string, []string) {
+	seen := map[string]bool{}
+	var repairs []string
+	note := func(r string) {
+		if !seen[r] {
+			seen[r] = true
+			repairs = append(repairs, r)
+		}
+	}
+
+	if stripped, ok := stripCodeFence(text); ok {
+		text = stripped
+		note("removed code fence")
+	}
+	// 去掉值前面的说明文字，例如 "Arguments: {...}"
+	if i := strings.IndexAny(text, "{["); i > 0 {
+		text = text[i:]
+		note("removed text before JSON")
+	}
+
+	out, commas := rewriteJSON(text, note)
+	// 截断在某个成员中间时，逐个丢掉最后的不完整成员再试
+	for {
+		if _, err := decodeJSONValue(out); err == nil || len(commas) == 0 {
+			return out, repairs
+		}
+		note("dropped incomplete trailing member")
+		last := commas[len(commas)-1]
+		out, commas = rewriteJSON(out[:last], func(string) {})
+	}
+}
+
+func stripCodeFence(text string) (string, bool) {
+	if !strings.HasPrefix(text, "```") {
+		return text, false
+	}
+	text = strings.TrimPrefix(text, "```")
+	if nl := strings.IndexByte(text, '\n'); nl >= 0 {
+		text = text[nl+1:] // 跳过 ```json 这样的语言标记
+	}
+	text = strings.TrimSpace(text)
+	text = strings.TrimSuffix(text, "```")
+	return strings.TrimSpace(text), true
+}
+
+// rewriteJSON 执行一次重写，返回结果以及结构层面逗号在结果中的位置
+func rewriteJSON(text string, note func(string)) (string, []int) {
+	var out strings.Builder
+	var stack []byte // 期望的闭合符
+	var commas []int
+	started := false
+
+	trimTrailingComma := func() {
+		s := strings.TrimRight(out.String(), " \t\r\n")
+		if strings.HasSuffix(s, ",") {
+			note("removed trailing comma")
+			s = s[:len(s)-1]
+			out.Reset()
+			out.WriteString(s)
+			if n := len(commas); n > 0 && commas[n-1] >= len(s) {
+				commas = commas[:n-1]
+			}
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		if started && len(stack) == 0 {
+			if strings.TrimSpace(text[i:]) != "" {
+				note("removed text after JSON")
+			}
+			break
+		}
+		c := text[i]
+		switch {
+		case c == '"' || c == '\'':
+			s, next, closed := readQuoted(text, i)
+			if c == '\'' {
+				note("converted single quotes")
+			}
+			if !closed {
+				note("closed unterminated string")
+			}
+			quoted, _ := json.Marshal(s)
+			if bytes.Contains(quoted, []byte(`\n`)) && strings.ContainsAny(text[i:next], "\n\r\t") {
+				note("escaped control characters in string")
+			}
+			out.Write(quoted)
+			started = true
+			i = next - 1
+
+		case c == '{' || c == '[':
+			if c == '{' {
+				stack = append(stack, '}')
+			} else {
+				stack = append(stack, ']')
+			}
+			out.WriteByte(c)
+			started = true
+
+		case c == '}' || c == ']':
+			trimTrailingComma()
+			idx := bytes.LastIndexByte(stack, c)
+			if idx < 0 {
+				note("removed unbalanced bracket")
+				continue
+			}
+			for len(stack) > idx+1 {
+				out.WriteByte(stack[len(stack)-1])
+				stack = stack[:len(stack)-1]
+				note("closed unbalanced bracket")
+			}
+			out.WriteByte(c)
+			stack = stack[:idx]
+
+		case c == ',':
+			commas = append(commas, out.Len())
+			out.WriteByte(c)
+
+		case c == '/' && i+1 < len(text) && (text[i+1] == '/' || text[i+1] == '*'):
+			note("removed comment")
+			if text[i+1] == '/' {
+				for i < len(text) && text[i] != '\n' {
+					i++
+				}
+			} else {
+				end := strings.Index(text[i+2:], "*/")
+				if end < 0 {
+					i = len(text)
+				} else {
+					i += end + 3
+				}
+			}
+
+		case isBareChar(c):
+			j := i
+			for j < len(text) && isBareChar(text[j]) {
+				j++
+			}
+			out.WriteString(bareToken(text[i:j], nextNonSpace(text, j) == ':', note))
+			started = true
+			i = j - 1
+
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	// 输入被截断：补齐缺失的部分
+	trimTrailingComma()
+	if s := strings.TrimRight(out.String(), " \t\r\n"); strings.HasSuffix(s, ":") {
+		out.WriteString("null")
+		note("filled missing value")
+	}
+	if len(stack) > 0 {
+		note("closed truncated JSON")
+	}
+	for len(stack) > 0 {
+		out.WriteByte(stack[len(stack)-1])
+		stack = stack[:len(stack)-1]
+	}
+	return out.String(), commas
+}
+
+// readQuoted 读取从 text[start] 开始的单引号或双引号字符串
+func readQuoted(text string, start int) (value string, next int, closed bool) {
+	quote := text[start]
+	var b strings.Builder
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, true
+		case c == '\\' && i+1 < len(text):
+			i++
+			switch e := text[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 < len(text) {
+					if r, err := strconv.ParseUint(text[i+1:i+5], 16, 32); err == nil {
+						b.WriteRune(rune(r))
+						i += 4
+						continue
+					}
+				}
+				b.WriteString(`\u`)
+			default: // \" \' \\ \/ 以及未知转义都保留字符本身
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), len(text), false
+}
+
+func isBareChar(c byte) bool {
+	return c == '_' || c == '-' || c == '+' || c == '.' || c == '$' ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func nextNonSpace(text string, i int) byte {
+	for ; i < len(text); i++ {
+		if c := text[i]; c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c
+		}
+	}
+	return 0
+}
+
+// bareToken 处理没有引号的词：数字与字面量保留，Python 字面量转换，其余加引号
+func bareToken(tok string, isKey bool, note func(string)) string {
+	if isKey {
+		note("quoted object keys")
+		return strconv.Quote(tok)
+	}
+	switch tok {
+	case "true", "false", "null":
+		return tok
+	case "True", "False", "None", "TRUE", "FALSE", "NULL", "nil", "undefined":
+		note("converted non-JSON literals")
+		switch strings.ToLower(tok) {
+		case "true":
+			return "true"
+		case "false":
+			return "false"
+		}
+		return "null"
+	}
+	if _, err := strconv.ParseFloat(tok, 64); err == nil && json.Valid([]byte(tok)) {
+		return tok
+	}
+	note("quoted bare strings")
+	return strconv.Quote(tok)
+}
+
+// -------------------------- 按 schema 转换类型 --------------------------
+
+func coerceToSchema(schema map[string]any, value any, path string, repairs *[]string) any {
+	if schema == nil {
+		return value
+	}
+	types := schemaTypes(schema)
+	if len(types) == 0 {
+		return value
+	}
+	if typeAllowed(types, jsonType(value), value) {
+		switch v := value.(type) {
+		case json.Number:
+			// 2.0 这样的整数值无法反序列化到 int
+			if slices.Contains(types, "integer") && !slices.Contains(types, "number") {
+				if converted, ok := convertJSONType("integer", v); ok && converted.(json.Number) != v {
+					*repairs = append(*repairs, fmt.Sprintf("converted %s from number to integer", path))
+					return converted
+				}
+			}
+		case map[string]any:
+			props, _ := schema["properties"].(map[string]any)
+			for k, child := range v {
+				if ps, ok := props[k].(map[string]any); ok {
+					v[k] = coerceToSchema(ps, child, path+"."+k, repairs)
+				}
+			}
+		case []any:
+			if items, ok := schema["items"].(map[string]any); ok {
+				for i, child := range v {
+					v[i] = coerceToSchema(items, child, fmt.Sprintf("%s[%d]", path, i), repairs)
+				}
+			}
+		}
+		return value
+	}
+
+	for _, t := range types {
+		if converted, ok := convertJSONType(t, value); ok {
+			*repairs = append(*repairs, fmt.Sprintf("converted %s from %s to %s", path, jsonType(value), t))
+			return coerceToSchema(schema, converted, path, repairs)
+		}
+	}
+	return value // 留给工具自己的校验报告
+}
+
+func convertJSONType(target string, value any) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		switch target {
+		case "integer", "number":
+			if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+				return json.Number(s), true
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+				return b, true
+			}
+		case "object", "array":
+			// 参数被二次编码成字符串
+			if inner, err := decodeJSONValue(s); err == nil && jsonType(inner) == target {
+				return inner, true
+			}
+		case "null":
+			if s == "" || strings.EqualFold(s, "null") {
+				return nil, true
+			}
+		}
+	case json.Number:
+		switch target {
+		case "string":
+			return v.String(), true
+		case "integer":
+			if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+				return json.Number(strconv.FormatInt(int64(f), 10)), true
+			}
+		case "boolean":
+			switch v.String() {
+			case "0":
+				return false, true
+			case "1":
+				return true, true
+			}
+		}
+	case bool:
+		if target == "string" {
+			return strconv.FormatBool(v), true
+		}
+	case nil:
+		if target == "array" {
+			return []any{}, true
+		}
+	}
+	// 单个值而 schema 要求数组
+	if target == "array" && jsonType(value) != "array" && value != nil {
+		return []any{value}, true
+	}
+	return nil, false
+}
+
+// -------------------------- 修复统计 --------------------------
+
+// ArgRepairStats 记录某个模型的工具参数质量
+type ArgRepairStats struct {
+	Calls    int            // 工具调用总数
+	Repaired int            // 经修复后可用
+	Failed   int            // 无法修复
+	Kinds    map[string]int // 各类修复出现的次数
+}
+
+type argRepairRecorder struct {
+	mu    sync.Mutex
+	stats map[string]*ArgRepairStats
+}
+
+func (r *argRepairRecorder) Record(model string, repairs []string, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[model]
+	if !ok {
+		s = &ArgRepairStats{Kinds: map[string]int{}}
+		r.stats[model] = s
+	}
+	s.Calls++
+	switch {
+	case failed:
+		s.Failed++
+	case len(repairs) > 0:
+		s.Repaired++
+	}
+	for _, kind := range repairs {
+		// 类型转换按种类计数，不区分具体字段
+		if strings.HasPrefix(kind, "converted $") {
+			if i := strings.Index(kind, " from "); i >= 0 {
+				kind = "converted" + kind[i:]
+			}
+		}
+		s.Kinds[kind]++
+	}
+}
+
+// Snapshot 返回按模型名排序的统计副本
+func (r *argRepairRecorder) Snapshot() ([]string, map[string]ArgRepairStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	models := make([]string, 0, len(r.stats))
+	out := make(map[string]ArgRepairStats, len(r.stats))
+	for m, s := range r.stats {
+		models = append(models, m)
+		kinds := make(map[string]int, len(s.Kinds))
+		for k, v := range s.Kinds {
+			kinds[k] = v
+		}
+		out[m] = ArgRepairStats{Calls: s.Calls, Repaired: s.Repaired, Failed: s.Failed, Kinds: kinds}
+	}
+	sort.Strings(models)
+	return models, out
+}
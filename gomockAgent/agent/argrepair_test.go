@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var repairSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"path":  map[string]any{"type": "string"},
+		"line":  map[string]any{"type": "integer"},
+		"ratio": map[string]any{"type": "number"},
+		"force": map[string]any{"type": "boolean"},
+		"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"opts": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"depth": map[string]any{"type": "integer"}},
+		},
+	},
+	"required": []any{"path"},
+}
+
+func TestRepairToolArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string   // 修复后的参数
+		repairs []string // 必须出现的修复
+	}{
+		{
+			name: "valid JSON is returned unchanged",
+			raw:  `{ "path": "a.go", "line": 3, "tags": ["x"] }`,
+			want: `{ "path": "a.go", "line": 3, "tags": ["x"] }`,
+		},
+		{
+			name: "empty arguments",
+			raw:  "  ",
+			want: `{}`,
+		},
+		{
+			name:    "trailing commas",
+			raw:     `{"path": "a.go", "tags": ["x", "y",],}`,
+			want:    `{"path":"a.go","tags":["x","y"]}`,
+			repairs: []string{"removed trailing comma"},
+		},
+		{
+			name:    "code fence",
+			raw:     "```json\n{\"path\": \"a.go\"}\n```",
+			want:    `{"path":"a.go"}`,
+			repairs: []string{"removed code fence"},
+		},
+		{
+			name:    "single quotes",
+			raw:     `{'path': 'it\'s.go', 'force': True}`,
+			want:    `{"force":true,"path":"it's.go"}`,
+			repairs: []string{"converted single quotes", "converted non-JSON literals"},
+		},
+		{
+			name:    "unquoted keys",
+			raw:     `{path: "a.go", line: 3}`,
+			want:    `{"line":3,"path":"a.go"}`,
+			repairs: []string{"quoted object keys"},
+		},
+		{
+			name:    "truncated object",
+			raw:     `{"path": "a.go", "opts": {"depth": 2`,
+			want:    `{"opts":{"depth":2},"path":"a.go"}`,
+			repairs: []string{"closed truncated JSON"},
+		},
+		{
+			name:    "truncated inside a string",
+			raw:     `{"path": "a.go", "tags": ["x", "y`,
+			want:    `{"path":"a.go","tags":["x","y"]}`,
+			repairs: []string{"closed unterminated string", "closed truncated JSON"},
+		},
+		{
+			name:    "truncated after a key",
+			raw:     `{"path": "a.go", "line":`,
+			want:    `{"line":null,"path":"a.go"}`,
+			repairs: []string{"filled missing value", "closed truncated JSON"},
+		},
+		{
+			name:    "truncated inside a key",
+			raw:     `{"path": "a.go", "li`,
+			want:    `{"path":"a.go"}`,
+			repairs: []string{"dropped incomplete trailing member"},
+		},
+		{
+			name:    "stringified numbers and booleans",
+			raw:     `{"path": "a.go", "line": "42", "ratio": "0.5", "force": "true"}`,
+			want:    `{"force":true,"line":42,"path":"a.go","ratio":0.5}`,
+			repairs: []string{"converted $.line from string to integer", "converted $.ratio from string to number", "converted $.force from string to boolean"},
+		},
+		{
+			name:    "nested stringified integer",
+			raw:     `{"path": "a.go", "opts": {"depth": "2"}}`,
+			want:    `{"opts":{"depth":2},"path":"a.go"}`,
+			repairs: []string{"converted $.opts.depth from string to integer"},
+		},
+		{
+			name:    "integer written as a float",
+			raw:     `{"path": "a.go", "line": 3.0}`,
+			want:    `{"line":3,"path":"a.go"}`,
+			repairs: []string{"converted $.line from number to integer"},
+		},
+		{
+			name:    "number for a string field",
+			raw:     `{"path": 7}`,
+			want:    `{"path":"7"}`,
+			repairs: []string{"converted $.path from number to string"},
+		},
+		{
+			name:    "single value for an array",
+			raw:     `{"path": "a.go", "tags": "x"}`,
+			want:    `{"path":"a.go","tags":["x"]}`,
+			repairs: []string{"converted $.tags from string to array"},
+		},
+		{
+			name:    "double-encoded object",
+			raw:     `"{\"path\": \"a.go\"}"`,
+			want:    `{"path":"a.go"}`,
+			repairs: []string{"converted $ from string to object"},
+		},
+		{
+			name: "strings that look like numbers stay strings",
+			raw:  `{"path": "42"}`,
+			want: `{"path": "42"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs, err := RepairToolArguments("edit", tt.raw, repairSchema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("arguments = %s, want %s", got, tt.want)
+			}
+			if len(tt.repairs) == 0 && len(repairs) > 0 {
+				t.Errorf("repairs = %q, want none", repairs)
+			}
+			for _, r := range tt.repairs {
+				if !slices.Contains(repairs, r) {
+					t.Errorf("repairs = %q, missing %q", repairs, r)
+				}
+			}
+		})
+	}
+}
+
+func TestRepairToolArgumentsFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string // 错误中应包含的内容
+	}{
+		{"not an object", `just some words`, "expected a JSON object, got string"},
+		{"array instead of object", `["a.go"]`, "expected a JSON object, got array"},
+		{"missing value", `{"path": }`, "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := RepairToolArguments("edit", tt.raw, repairSchema)
+			var repairErr *ArgumentRepairError
+			if !errors.As(err, &repairErr) {
+				t.Fatalf("expected an ArgumentRepairError, got %s, %v", got, err)
+			}
+			if repairErr.Tool != "edit" || repairErr.Raw != tt.raw {
+				t.Errorf("error = %+v", repairErr)
+			}
+			msg := err.Error()
+			if !strings.Contains(msg, tt.want) {
+				t.Errorf("error %q does not mention %q", msg, tt.want)
+			}
+			// 错误信息带上 schema，让模型按 schema 重发
+			if !strings.Contains(msg, "matching this schema") || !strings.Contains(msg, `"path"`) {
+				t.Errorf("error does not include the schema: %s", msg)
+			}
+		})
+	}
+}
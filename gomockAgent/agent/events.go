@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// -------------------------- 事件 --------------------------
+// 工具循环中的每一步都以事件的形式发送给订阅者。REPL、HTTP 服务等都只是订阅者之一，
+// 自行决定如何展示。事件按发生顺序在调用 Send 的 goroutine 中同步投递，
+// 订阅者应尽快返回，耗时的处理请自行转到其他 goroutine。
+
+// Event 是所有事件的公共接口，Type 返回稳定的事件名，可用于序列化
+type Event interface {
+	Type() string
+	Meta() EventMeta
+}
+
+// EventMeta 标识事件所属的会话与轮次
+type EventMeta struct {
+	SessionID string    `json:"session_id"`
+	Turn      int       `json:"turn"`
+	Time      time.Time `json:"time"`
+}
+
+func (m EventMeta) Meta() EventMeta { return m }
+
+// TurnStarted 在用户消息加入对话、调用模型之前发送
+type TurnStarted struct {
+	EventMeta
+	Prompt string `json:"prompt"`
+}
+
+// AssistantTextDelta 是助手回复的一段文本。目前请求不使用流式输出，每条助手消息对应一个 delta
+type AssistantTextDelta struct {
+	EventMeta
+	Text string `json:"text"`
+}
+
+// ToolCallStarted 在执行工具前发送。参数被修复过时，Arguments 是修复后实际使用的参数，
+// RawArguments 是模型生成的原始参数，Repairs 列出做过的修复
+type ToolCallStarted struct {
+	EventMeta
+	CallID       string   `json:"call_id"`
+	Name         string   `json:"name"`
+	Arguments    string   `json:"arguments"`
+	RawArguments string   `json:"raw_arguments,omitempty"`
+	Repairs      []string `json:"repairs,omitempty"`
+}
+
+// ToolApprovalRequested 在会话设置了 ToolApprover 时，于执行工具前发送
+type ToolApprovalRequested struct {
+	EventMeta
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolCallFinished 在工具返回后发送，Error 非空表示失败（结果同样会回传给模型）
+type ToolCallFinished struct {
+	EventMeta
+	CallID   string        `json:"call_id"`
+	Name     string        `json:"name"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Notice 是不影响继续执行的提示，例如截断后续写、最终回答被拒绝后重试
+type Notice struct {
+	EventMeta
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// ErrorEvent 表示本轮因错误结束；Err 可用 errors.As 判断具体类型
+type ErrorEvent struct {
+	EventMeta
+	Err     error  `json:"-"`
+	Message string `json:"message"`
+}
+
+// UsageUpdated 在每次 API 调用后发送
+type UsageUpdated struct {
+	EventMeta
+	Call    TokenUsage `json:"call"`
+	Turn    TokenUsage `json:"turn_total"`
+	Session TokenUsage `json:"session_total"`
+}
+
+// TurnFinished 在一轮结束时发送，无论成功与否
+type TurnFinished struct {
+	EventMeta
+	Usage TokenUsage `json:"usage"`
+	Error string     `json:"error,omitempty"`
+}
+
+func (TurnStarted) Type() string           { return "turn_started" }
+func (AssistantTextDelta) Type() string    { return "assistant_text_delta" }
+func (ToolCallStarted) Type() string       { return "tool_call_started" }
+func (ToolApprovalRequested) Type() string { return "tool_approval_requested" }
+func (ToolCallFinished) Type() string      { return "tool_call_finished" }
+func (Notice) Type() string                { return "notice" }
+func (ErrorEvent) Type() string            { return "error" }
+func (UsageUpdated) Type() string          { return "usage" }
+func (TurnFinished) Type() string          { return "turn_finished" }
+
+// Subscriber 接收事件
+type Subscriber interface {
+	HandleEvent(Event)
+}
+
+// SubscriberFunc 让普通函数实现 Subscriber
+type SubscriberFunc func(Event)
+
+func (f SubscriberFunc) HandleEvent(e Event) { f(e) }
+
+// subscribers 是可并发增删的订阅者列表
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]Subscriber
+}
+
+func (s *subscribers) add(sub Subscriber) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs == nil {
+		s.subs = map[int]Subscriber{}
+	}
+	id := s.next
+	s.next++
+	s.subs[id] = sub
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs, id)
+	}
+}
+
+func (s *subscribers) publish(e Event) {
+	s.mu.Lock()
+	ids := make([]int, 0, len(s.subs))
+	for id := range s.subs {
+		ids = append(ids, id)
+	}
+	subs := make([]Subscriber, 0, len(ids))
+	slices.Sort(ids) // 按订阅顺序投递
+	for _, id := range ids {
+		subs = append(subs, s.subs[id])
+	}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		sub.HandleEvent(e)
+	}
+}
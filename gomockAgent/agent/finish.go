@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+)
+
+// -------------------------- finish_reason --------------------------
+// 每个 choice 的 finish_reason 说明回复为什么结束：
+//   - stop / tool_calls：正常结束
+//   - length：达到 max_tokens。文本回复自动请求续写并拼接；工具调用的参数已被截断，
+//     丢弃这次回复并以更大的 max_tokens 重新请求
+//   - content_filter：内容被过滤，返回 ContentFilterError
+// 模型通过 refusal 字段拒绝回答时返回 RefusalError。
+
+const (
+	maxTextContinuations   = 3     // 文本被截断后最多续写次数
+	maxToolCallRetries     = 2     // 工具调用被截断后最多重试次数
+	maxTokenBudgetCeiling  = 32768 // 重试时 max_tokens 的上限
+	unsetTokenBudgetRetry  = 8192  // 未配置 max_tokens 时重试使用的值
+	continuationUserPrompt = "Your previous reply was cut off because it reached the output token limit. " +
+		"Continue exactly where you stopped, without repeating anything or adding any preamble."
+)
+
+// ContentFilterError 表示回复被内容过滤拦截
+type ContentFilterError struct {
+	Partial string // 被拦截前已生成的内容
+}
+
+func (e *ContentFilterError) Error() string {
+	if e.Partial == "" {
+		return "the response was blocked by the provider's content filter"
+	}
+	return fmt.Sprintf("the response was blocked by the provider's content filter after: %q", e.Partial)
+}
+
+// RefusalError 表示模型拒绝回答
+type RefusalError struct {
+	Refusal string
+}
+
+func (e *RefusalError) Error() string { return "model refused: " + e.Refusal }
+
+// nextAssistantMessage 请求一条完整的助手消息，按 finish_reason 处理截断与过滤
+func (s *Session) nextAssistantMessage(ctx context.Context, conversation []OpenAIChatCompletionMessage, opts ...requestOption) (OpenAIChatCompletionMessage, error) {
+	var text string // 已续写的文本
+	toolRetries, continuations := 0, 0
+	callOpts := opts
+	request := conversation
+	for {
+		if reason, exceeded := s.usage.BudgetExceeded(); exceeded {
+			return OpenAIChatCompletionMessage{}, &BudgetExceededError{Reason: reason}
+		}
+		resp, err := s.call(ctx, request, callOpts...)
+		if err != nil {
+			return OpenAIChatCompletionMessage{}, err
+		}
+		if len(resp.Choices) == 0 {
+			return OpenAIChatCompletionMessage{}, ErrNoChoices
+		}
+		choice := resp.Choices[0]
+		message := choice.Message
+		if message.Refusal != "" {
+			return message, &RefusalError{Refusal: message.Refusal}
+		}
+
+		switch choice.FinishReason {
+		case "", "stop", "tool_calls", "function_call":
+			message.Content = text + message.Content
+			return message, nil
+
+		case "content_filter":
+			return message, &ContentFilterError{Partial: text + message.Content}
+
+		case "length":
+			if len(message.ToolCalls) > 0 {
+				// 参数 JSON 不完整，执行它没有意义
+				if toolRetries >= maxToolCallRetries {
+					return message, fmt.Errorf("tool call arguments were truncated at the output token limit %d times", toolRetries+1)
+				}
+				toolRetries++
+				callOpts = append(append([]requestOption(nil), opts...), withTokenBudgetScale(1<<toolRetries))
+				s.notice("truncated_tool_call", "retrying with a larger max_tokens (attempt %d)", toolRetries)
+				continue
+			}
+			if continuations >= maxTextContinuations {
+				message.Content = text + message.Content
+				s.notice("truncated", "reply still incomplete after %d continuations", continuations)
+				return message, nil
+			}
+			continuations++
+			text += message.Content
+			// 续写请求：把已有内容作为助手消息，再要求模型接着写；每次都从原对话重新构造
+			request = append(conversation[:len(conversation):len(conversation)],
+				OpenAIChatCompletionMessage{Role: "assistant", Content: text},
+				OpenAIChatCompletionMessage{Role: "user", Content: continuationUserPrompt},
+			)
+			continue
+
+		default:
+			s.notice("warning", "unknown finish_reason %q, treating the reply as complete", choice.FinishReason)
+			message.Content = text + message.Content
+			return message, nil
+		}
+	}
+}
+
+// withTokenBudgetScale 把本次请求的输出 token 上限放大 scale 倍
+func withTokenBudgetScale(scale int) requestOption {
+	return func(req *OpenAIChatCompletionRequest) {
+		switch {
+		case req.MaxCompletionTokens > 0:
+			req.MaxCompletionTokens = min(req.MaxCompletionTokens*scale, maxTokenBudgetCeiling)
+		case req.MaxTokens > 0:
+			req.MaxTokens = min(req.MaxTokens*scale, maxTokenBudgetCeiling)
+		default:
+			req.MaxTokens = unsetTokenBudgetRetry
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeEndpoint 是按顺序返回预设回复的 chat completions 接口，并记录收到的请求
+type fakeEndpoint struct {
+	t         *testing.T
+	mu        sync.Mutex
+	responses []OpenAIChatCompletionChoice
+	requests  []OpenAIChatCompletionRequest
+}
+
+func newFakeEndpoint(t *testing.T, responses ...OpenAIChatCompletionChoice) (*fakeEndpoint, *httptest.Server) {
+	f := &fakeEndpoint{t: t, responses: responses}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req OpenAIChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("decoding request: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if len(f.responses) == 0 {
+		f.t.Errorf("unexpected request %d", len(f.requests))
+		http.Error(w, "no more responses", http.StatusInternalServerError)
+		return
+	}
+	choice := f.responses[0]
+	f.responses = f.responses[1:]
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(OpenAIChatCompletionResponse{
+		ID:      "chatcmpl-test",
+		Object:  "chat.completion",
+		Model:   req.Model,
+		Choices: []OpenAIChatCompletionChoice{choice},
+		Usage:   &OpenAIUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+}
+
+func textChoice(content, finishReason string) OpenAIChatCompletionChoice {
+	return OpenAIChatCompletionChoice{
+		Message:      OpenAIChatCompletionMessage{Role: "assistant", Content: content},
+		FinishReason: finishReason,
+	}
+}
+
+func toolCallChoice(arguments, finishReason string) OpenAIChatCompletionChoice {
+	return OpenAIChatCompletionChoice{
+		Message: OpenAIChatCompletionMessage{Role: "assistant", ToolCalls: []OpenAIChatCompletionToolCall{{
+			ID: "call_1", Type: "function",
+			Function: OpenAIChatCompletionFunctionCall{Name: "read_file", Arguments: arguments},
+		}}},
+		FinishReason: finishReason,
+	}
+}
+
+func TestNextAssistantMessage(t *testing.T) {
+	refusal := textChoice("", "stop")
+	refusal.Message.Refusal = "I can't help with that."
+
+	tests := []struct {
+		name      string
+		responses []OpenAIChatCompletionChoice
+		want      string // 最终消息的 Content
+		wantCalls bool   // 最终消息带有工具调用
+		wantErr   func(error) bool
+		notice    string // 期望的 Notice.Kind
+		check     func(t *testing.T, reqs []OpenAIChatCompletionRequest)
+	}{
+		{
+			name:      "stop",
+			responses: []OpenAIChatCompletionChoice{textChoice("done", "stop")},
+			want:      "done",
+		},
+		{
+			name:      "tool_calls",
+			responses: []OpenAIChatCompletionChoice{toolCallChoice(`{"path":"a.go"}`, "tool_calls")},
+			wantCalls: true,
+		},
+		{
+			name: "length with text is continued and stitched",
+			responses: []OpenAIChatCompletionChoice{
+				textChoice("Hello, ", "length"),
+				textChoice("wor", "length"),
+				textChoice("ld.", "stop"),
+			},
+			want: "Hello, world.",
+			check: func(t *testing.T, reqs []OpenAIChatCompletionRequest) {
+				last := reqs[2].Messages
+				if n := len(last); n != 3 || last[1].Role != "assistant" || last[1].Content != "Hello, wor" || last[2].Content != continuationUserPrompt {
+					t.Fatalf("continuation request messages = %+v", last)
+				}
+			},
+		},
+		{
+			name: "length with text gives up after the continuation limit",
+			responses: []OpenAIChatCompletionChoice{
+				textChoice("a", "length"), textChoice("b", "length"), textChoice("c", "length"), textChoice("d", "length"),
+			},
+			want:   "abcd",
+			notice: "truncated",
+		},
+		{
+			name: "length with a tool call retries with a larger max_tokens",
+			responses: []OpenAIChatCompletionChoice{
+				toolCallChoice(`{"pa`, "length"),
+				toolCallChoice(`{"path":"a.go"}`, "tool_calls"),
+			},
+			wantCalls: true,
+			notice:    "truncated_tool_call",
+			check: func(t *testing.T, reqs []OpenAIChatCompletionRequest) {
+				if reqs[0].MaxTokens != 2048 || reqs[1].MaxTokens != 4096 {
+					t.Fatalf("max_tokens = %d then %d, want 2048 then 4096", reqs[0].MaxTokens, reqs[1].MaxTokens)
+				}
+				if len(reqs[1].Messages) != len(reqs[0].Messages) {
+					t.Fatalf("the truncated tool call must not be sent back to the model")
+				}
+			},
+		},
+		{
+			name: "length with a tool call fails after the retry limit",
+			responses: []OpenAIChatCompletionChoice{
+				toolCallChoice(`{"pa`, "length"), toolCallChoice(`{"pa`, "length"), toolCallChoice(`{"pa`, "length"),
+			},
+			wantErr: func(err error) bool { return err != nil && strings.Contains(err.Error(), "truncated") },
+		},
+		{
+			name:      "content_filter",
+			responses: []OpenAIChatCompletionChoice{textChoice("partial", "content_filter")},
+			wantErr: func(err error) bool {
+				var cf *ContentFilterError
+				return errors.As(err, &cf) && cf.Partial == "partial"
+			},
+		},
+		{
+			name:      "content_filter after a continuation keeps the stitched text",
+			responses: []OpenAIChatCompletionChoice{textChoice("one ", "length"), textChoice("two", "content_filter")},
+			wantErr: func(err error) bool {
+				var cf *ContentFilterError
+				return errors.As(err, &cf) && cf.Partial == "one two"
+			},
+		},
+		{
+			name:      "refusal",
+			responses: []OpenAIChatCompletionChoice{refusal},
+			wantErr: func(err error) bool {
+				var re *RefusalError
+				return errors.As(err, &re) && re.Refusal == "I can't help with that."
+			},
+		},
+		{
+			name:      "empty finish_reason",
+			responses: []OpenAIChatCompletionChoice{textChoice("ok", "")},
+			want:      "ok",
+		},
+		{
+			name:      "unknown finish_reason",
+			responses: []OpenAIChatCompletionChoice{textChoice("ok", "eos")},
+			want:      "ok",
+			notice:    "warning",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, srv := newFakeEndpoint(t, tt.responses...)
+			a := New(Options{Endpoint: srv.URL, Model: "test-model"})
+			s := a.NewSession()
+			var notices []string
+			s.Subscribe(SubscriberFunc(func(e Event) {
+				if n, ok := e.(Notice); ok {
+					notices = append(notices, n.Kind)
+				}
+			}))
+
+			msg, err := s.nextAssistantMessage(context.Background(), []OpenAIChatCompletionMessage{{Role: "user", Content: "hi"}})
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Content != tt.want {
+					t.Fatalf("Content = %q, want %q", msg.Content, tt.want)
+				}
+				if got := len(msg.ToolCalls) > 0; got != tt.wantCalls {
+					t.Fatalf("has tool calls = %v, want %v", got, tt.wantCalls)
+				}
+			}
+			if len(endpoint.responses) != 0 {
+				t.Fatalf("%d scripted responses were not requested", len(endpoint.responses))
+			}
+			if tt.notice != "" && !slices.Contains(notices, tt.notice) {
+				t.Fatalf("notices = %v, want %q", notices, tt.notice)
+			}
+			if tt.check != nil {
+				tt.check(t, endpoint.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -------------------------- 按需注入的指令 --------------------------
+// 有些项目规则只适用于部分文件（例如只针对 *_test.go 的约定），一直放在系统提示中既浪费 token 也会干扰无关任务。
+// Options.ScopedInstructions 在每次工具调用成功后被调用，返回与这次调用相关的指令；
+// 本批工具调用结束后，新的指令以一条系统消息加入对话，同名指令在一个会话中只注入一次。
+
+// Instruction 是一条具名的指令
+type Instruction struct {
+	Name string // 例如规则文件的路径，用于去重与提示
+	Text string
+}
+
+// ScopedInstructionsFunc 返回与一次工具调用相关的指令
+type ScopedInstructionsFunc func(call ToolCallStarted) []Instruction
+
+// scopedInstructions 返回本会话尚未注入过的相关指令
+func (s *Session) scopedInstructions(call ToolCallStarted) []Instruction {
+	if s.agent.scopedInstructions == nil {
+		return nil
+	}
+	var fresh []Instruction
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, in := range s.agent.scopedInstructions(call) {
+		if s.instructed[in.Name] {
+			continue
+		}
+		if s.instructed == nil {
+			s.instructed = map[string]bool{}
+		}
+		s.instructed[in.Name] = true
+		fresh = append(fresh, in)
+	}
+	return fresh
+}
+
+// instructionsMessage 把指令合并为一条系统消息
+func (s *Session) instructionsMessage(list []Instruction) OpenAIChatCompletionMessage {
+	var b strings.Builder
+	b.WriteString("The following project rules apply to the files you just accessed. Follow them for the rest of the conversation.")
+	names := make([]string, 0, len(list))
+	for _, in := range list {
+		fmt.Fprintf(&b, "\n\n## %s\n\n%s", in.Name, strings.TrimSpace(in.Text))
+		names = append(names, in.Name)
+	}
+	s.notice("instructions", "applying %s", strings.Join(names, ", "))
+	return OpenAIChatCompletionMessage{Role: s.agent.systemRole(), Content: b.String()}
+}
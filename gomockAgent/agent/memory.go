@@ -0,0 +1,425 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// -------------------------- 对话记忆 --------------------------
+// Session 始终保存完整对话（Messages、恢复会话与 checkpoint 都依赖它），Memory 只决定每次请求把哪些历史发给模型。
+// 未配置时发送完整对话（buffer）。profile 中的 "memory" 可以选择：
+//   - window        只保留最近 window 段对话
+//   - token_budget  从最近的一段往前保留，直到估算的 token 数达到 max_tokens
+//   - summary       超过 max_tokens 时由模型把较早的对话压缩进滚动更新的摘要
+//   - entity        保留最近 window 段对话，较早的对话由模型整理为实体（人、文件、包、决定等）记录
+//
+// 一段对话从一条用户消息开始，包含其后的工具调用与结果，因此 tool 消息不会与发起调用的 assistant 消息分开；
+// 当前这一段总是完整发送。被丢弃部分中的系统消息（笔记、按需注入的项目规则）仍然保留。
+
+// LLM 是记忆策略生成摘要时使用的模型。*Agent 实现了该接口；测试中可以用假的实现代替
+type LLM interface {
+	Complete(ctx context.Context, systemPrompt, userPrompt string, examples ...OpenAIChatCompletionMessage) (string, error)
+}
+
+// Memory 从完整历史中选出要发送的消息。history 不含系统提示与示例，最后一段是当前这一轮。
+// 有状态的实现每个会话一个实例，不会被并发调用
+type Memory interface {
+	Context(ctx context.Context, history []OpenAIChatCompletionMessage) ([]OpenAIChatCompletionMessage, error)
+}
+
+// MemoryFactory 为每个会话创建 Memory；llm 的调用计入该会话的用量与预算
+type MemoryFactory func(llm LLM) Memory
+
+// MemoryConfig 是 profile 中的记忆配置
+type MemoryConfig struct {
+	Type        string `json:"type"`                   // buffer（默认）、window、token_budget、summary、entity
+	Window      int    `json:"window,omitempty"`       // window、entity 保留的对话段数，默认 10 / 3
+	MaxTokens   int    `json:"max_tokens,omitempty"`   // token_budget、summary 的历史 token 上限，默认 8000
+	KeepTokens  int    `json:"keep_tokens,omitempty"`  // summary 压缩后原样保留的最近对话，默认 max_tokens 的一半
+	MaxEntities int    `json:"max_entities,omitempty"` // entity 最多发送的实体数，默认 30
+}
+
+const (
+	defaultMemoryWindow       = 10
+	defaultEntityMemoryWindow = 3
+	defaultMemoryMaxTokens    = 8000
+	defaultMaxEntities        = 30
+)
+
+// Validate 检查记忆配置
+func (c *MemoryConfig) Validate() error {
+	switch c.Type {
+	case "", "buffer", "window", "token_budget", "summary", "entity":
+	default:
+		return fmt.Errorf("unknown memory type %q, expected buffer, window, token_budget, summary or entity", c.Type)
+	}
+	if c.Window < 0 || c.MaxTokens < 0 || c.KeepTokens < 0 || c.MaxEntities < 0 {
+		return fmt.Errorf("memory settings must not be negative")
+	}
+	if c.KeepTokens > 0 && c.KeepTokens > c.maxTokens() {
+		return fmt.Errorf("memory keep_tokens (%d) must not exceed max_tokens (%d)", c.KeepTokens, c.maxTokens())
+	}
+	return nil
+}
+
+func (c *MemoryConfig) maxTokens() int {
+	if c.MaxTokens > 0 {
+		return c.MaxTokens
+	}
+	return defaultMemoryMaxTokens
+}
+
+// factory 返回配置对应的 MemoryFactory，buffer 返回 nil
+func (c *MemoryConfig) factory() MemoryFactory {
+	window := func(def int) int {
+		if c.Window > 0 {
+			return c.Window
+		}
+		return def
+	}
+	switch c.Type {
+	case "window":
+		return func(LLM) Memory { return BufferWindowMemory{K: window(defaultMemoryWindow)} }
+	case "token_budget":
+		return func(LLM) Memory { return TokenBudgetMemory{MaxTokens: c.maxTokens()} }
+	case "summary":
+		keep := c.KeepTokens
+		if keep == 0 {
+			keep = c.maxTokens() / 2
+		}
+		return func(llm LLM) Memory { return &SummaryMemory{LLM: llm, MaxTokens: c.maxTokens(), KeepTokens: keep} }
+	case "entity":
+		maxEntities := c.MaxEntities
+		if maxEntities == 0 {
+			maxEntities = defaultMaxEntities
+		}
+		return func(llm LLM) Memory {
+			return &EntityMemory{LLM: llm, K: window(defaultEntityMemoryWindow), MaxEntities: maxEntities}
+		}
+	}
+	return nil
+}
+
+// exchangeStarts 返回每段对话的起始下标；第一段总是从 0 开始，即使它不以用户消息开头
+func exchangeStarts(history []OpenAIChatCompletionMessage) []int {
+	if len(history) == 0 {
+		return nil
+	}
+	starts := []int{0}
+	for i := 1; i < len(history); i++ {
+		// 紧跟在 tool 消息后的用户消息是工具返回的图片等内容，属于同一段
+		if history[i].Role == "user" && history[i-1].Role != "tool" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// pinnedMessages 返回被丢弃的历史中仍要发送的系统消息
+func pinnedMessages(messages []OpenAIChatCompletionMessage) []OpenAIChatCompletionMessage {
+	var pinned []OpenAIChatCompletionMessage
+	for _, m := range messages {
+		if m.Role == "system" || m.Role == "developer" {
+			pinned = append(pinned, m)
+		}
+	}
+	return pinned
+}
+
+// EstimateTokens 粗略估算消息的 token 数：ASCII 约 4 个字符一个 token，其他字符（如中文）约一个字符一个 token，
+// 每条消息另加 4 个，图片与音频按 765 个计算。只用于裁剪历史，不需要精确
+func EstimateTokens(messages ...OpenAIChatCompletionMessage) int {
+	total := 0
+	for _, m := range messages {
+		total += 4 + textTokens(m.Content) + textTokens(m.Name)
+		for _, p := range m.Parts {
+			if p.Type == "text" {
+				total += textTokens(p.Text)
+			} else {
+				total += 765
+			}
+		}
+		for _, call := range m.ToolCalls {
+			total += textTokens(call.Function.Name) + textTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+func textTokens(s string) int {
+	ascii, other := 0, 0
+	for i := 0; i < len(s); {
+		if s[i] < utf8.RuneSelf {
+			ascii++
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		other++
+		i += size
+	}
+	return (ascii+3)/4 + other
+}
+
+// -------------------------- window --------------------------
+
+// BufferWindowMemory 只保留最近 K 段对话
+type BufferWindowMemory struct {
+	K int
+}
+
+func (m BufferWindowMemory) Context(_ context.Context, history []OpenAIChatCompletionMessage) ([]OpenAIChatCompletionMessage, error) {
+	starts := exchangeStarts(history)
+	keep := max(m.K, 1)
+	if len(starts) <= keep {
+		return history, nil
+	}
+	cut := starts[len(starts)-keep]
+	return append(pinnedMessages(history[:cut]), history[cut:]...), nil
+}
+
+// -------------------------- token_budget --------------------------
+
+// TokenBudgetMemory 从最近的一段对话往前保留，直到估算的 token 数达到 MaxTokens。
+// 当前这一段即使超出也会完整发送
+type TokenBudgetMemory struct {
+	MaxTokens int
+}
+
+func (m TokenBudgetMemory) Context(_ context.Context, history []OpenAIChatCompletionMessage) ([]OpenAIChatCompletionMessage, error) {
+	starts := exchangeStarts(history)
+	if len(starts) <= 1 {
+		return history, nil
+	}
+	cut := starts[len(starts)-1]
+	used := EstimateTokens(history[cut:]...) + EstimateTokens(pinnedMessages(history[:cut])...)
+	for i := len(starts) - 2; i >= 0; i-- {
+		// 系统消息已经按保留计算过
+		extra := EstimateTokens(history[starts[i]:cut]...) - EstimateTokens(pinnedMessages(history[starts[i]:cut])...)
+		if used+extra > m.MaxTokens {
+			break
+		}
+		used += extra
+		cut = starts[i]
+	}
+	return append(pinnedMessages(history[:cut]), history[cut:]...), nil
+}
+
+// -------------------------- summary --------------------------
+
+const (
+	summarySystemPrompt = "You progressively summarize a conversation between a user and a coding assistant. " +
+		"Extend the current summary with the new lines of conversation and return the new summary. " +
+		"Keep what the assistant needs to continue the work: the user's goals and preferences, decisions made, " +
+		"files and functions involved, commands run and their outcome, and open questions. " +
+		"Be concise, write in the language of the conversation and respond with the summary only."
+	summaryContextPrompt = "Summary of the earlier conversation, which is no longer shown in full:\n\n"
+)
+
+// SummaryMemory 在历史超过 MaxTokens 时，把较早的对话交给 LLM 合并进摘要，
+// 只原样保留不超过 KeepTokens 的最近对话；摘要以一条系统消息放在保留的对话之前
+type SummaryMemory struct {
+	LLM        LLM
+	MaxTokens  int
+	KeepTokens int
+
+	summary string
+	covered int // 已压缩进摘要的历史消息数
+	pinned  []OpenAIChatCompletionMessage
+}
+
+// Summary 返回当前的摘要
+func (m *SummaryMemory) Summary() string { return m.summary }
+
+func (m *SummaryMemory) Context(ctx context.Context, history []OpenAIChatCompletionMessage) ([]OpenAIChatCompletionMessage, error) {
+	if len(history) < m.covered {
+		// 历史被替换（例如回退到较早的 checkpoint），重新开始
+		m.summary, m.covered, m.pinned = "", 0, nil
+	}
+	recent := history[m.covered:]
+	starts := exchangeStarts(recent)
+	if len(starts) > 1 && EstimateTokens(recent...)+textTokens(m.summary) > m.MaxTokens {
+		// 从最旧的一段开始压缩，直到剩余部分不超过 KeepTokens；当前这一段总是保留
+		cut := starts[len(starts)-1]
+		for _, start := range starts[1:] {
+			if EstimateTokens(recent[start:]...) <= m.KeepTokens {
+				cut = start
+				break
+			}
+		}
+		prompt := fmt.Sprintf("Current summary:\n%s\n\nNew lines of conversation:\n%s", orNone(m.summary), transcript(recent[:cut]))
+		summary, err := m.LLM.Complete(ctx, summarySystemPrompt, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize the conversation: %w", err)
+		}
+		m.summary = strings.TrimSpace(summary)
+		m.pinned = append(m.pinned, pinnedMessages(recent[:cut])...)
+		m.covered += cut
+		recent = recent[cut:]
+	}
+
+	messages := append([]OpenAIChatCompletionMessage(nil), m.pinned...)
+	if m.summary != "" {
+		messages = append(messages, OpenAIChatCompletionMessage{Role: "system", Content: summaryContextPrompt + m.summary})
+	}
+	return append(messages, recent...), nil
+}
+
+// -------------------------- entity --------------------------
+
+const (
+	entitySystemPrompt = "You maintain notes about the entities mentioned in a conversation between a user and a coding assistant: " +
+		"people, projects, files, packages, functions, tools, decisions and preferences. " +
+		"Given the existing notes and new lines of conversation, return a JSON object that maps the name of every entity " +
+		"whose note should change to its complete updated note of one or two sentences. " +
+		"Use an empty string to forget an entity that no longer matters, and return {} when nothing changed. " +
+		"Respond with the JSON object only."
+	entityContextPrompt = "Notes about entities from the earlier conversation, which is no longer shown in full:"
+)
+
+// EntityMemory 只原样保留最近 K 段对话；每当有对话移出窗口，就让 LLM 根据它更新实体记录，
+// 最近更新的 MaxEntities 条记录以一条系统消息放在保留的对话之前
+type EntityMemory struct {
+	LLM         LLM
+	K           int
+	MaxEntities int
+
+	entities map[string]string
+	order    []string // 按更新时间排列，最近的在后
+	covered  int
+	pinned   []OpenAIChatCompletionMessage
+}
+
+// Entities 返回当前的实体记录
+func (m *EntityMemory) Entities() map[string]string {
+	entities := make(map[string]string, len(m.entities))
+	for name, note := range m.entities {
+		entities[name] = note
+	}
+	return entities
+}
+
+func (m *EntityMemory) Context(ctx context.Context, history []OpenAIChatCompletionMessage) ([]OpenAIChatCompletionMessage, error) {
+	if len(history) < m.covered {
+		m.entities, m.order, m.covered, m.pinned = nil, nil, 0, nil
+	}
+	recent := history[m.covered:]
+	starts := exchangeStarts(recent)
+	if keep := max(m.K, 1); len(starts) > keep {
+		cut := starts[len(starts)-keep]
+		existing, _ := json.MarshalIndent(m.Entities(), "", "  ")
+		prompt := fmt.Sprintf("Existing notes:\n%s\n\nNew lines of conversation:\n%s", existing, transcript(recent[:cut]))
+		reply, err := m.LLM.Complete(ctx, entitySystemPrompt, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update entity notes: %w", err)
+		}
+		updates, err := parseEntityUpdates(reply)
+		if err != nil {
+			return nil, err
+		}
+		m.update(updates)
+		m.pinned = append(m.pinned, pinnedMessages(recent[:cut])...)
+		m.covered += cut
+		recent = recent[cut:]
+	}
+
+	messages := append([]OpenAIChatCompletionMessage(nil), m.pinned...)
+	if len(m.order) > 0 {
+		var b strings.Builder
+		b.WriteString(entityContextPrompt)
+		for _, name := range m.order[max(len(m.order)-max(m.MaxEntities, 1), 0):] {
+			fmt.Fprintf(&b, "\n- %s: %s", name, m.entities[name])
+		}
+		messages = append(messages, OpenAIChatCompletionMessage{Role: "system", Content: b.String()})
+	}
+	return append(messages, recent...), nil
+}
+
+// update 合并 LLM 返回的记录，空字符串表示删除
+func (m *EntityMemory) update(updates map[string]string) {
+	if m.entities == nil {
+		m.entities = map[string]string{}
+	}
+	names := make([]string, 0, len(updates))
+	for name := range updates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for i, n := range m.order {
+			if n == name {
+				m.order = append(m.order[:i], m.order[i+1:]...)
+				break
+			}
+		}
+		note := strings.TrimSpace(updates[name])
+		if note == "" {
+			delete(m.entities, name)
+			continue
+		}
+		m.entities[name] = note
+		m.order = append(m.order, name)
+	}
+}
+
+// parseEntityUpdates 解析 LLM 返回的 JSON 对象，容忍 ``` 代码块与前后的说明文字
+func parseEntityUpdates(reply string) (map[string]string, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("entity notes reply is not a JSON object: %q", reply)
+	}
+	var updates map[string]string
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &updates); err != nil {
+		return nil, fmt.Errorf("failed to parse entity notes: %w. Reply was: %s", err, reply)
+	}
+	return updates, nil
+}
+
+// -------------------------- transcript --------------------------
+
+const maxTranscriptFieldChars = 1000 // 工具参数与结果在文字记录中的长度上限
+
+// transcript 把对话转换为交给 LLM 整理的文字记录，系统消息不包含在内
+func transcript(messages []OpenAIChatCompletionMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case "user":
+			text := strings.TrimSpace(m.Text())
+			for _, p := range m.Parts {
+				if p.Type != "text" {
+					text += " [" + p.Type + "]"
+				}
+			}
+			fmt.Fprintf(&b, "User: %s\n", text)
+		case "assistant":
+			if m.Content != "" {
+				fmt.Fprintf(&b, "Assistant: %s\n", strings.TrimSpace(m.Content))
+			}
+			for _, call := range m.ToolCalls {
+				fmt.Fprintf(&b, "Assistant called %s(%s)\n", call.Function.Name, truncateText(call.Function.Arguments))
+			}
+		case "tool":
+			fmt.Fprintf(&b, "Tool %s returned: %s\n", m.Name, truncateText(strings.TrimSpace(m.Content)))
+		}
+	}
+	return b.String()
+}
+
+func truncateText(s string) string {
+	if utf8.RuneCountInString(s) <= maxTranscriptFieldChars {
+		return s
+	}
+	return string([]rune(s)[:maxTranscriptFieldChars]) + "…"
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,319 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeLLM 按顺序返回预设回复，并记录收到的提示
+type fakeLLM struct {
+	replies []string
+	err     error
+	prompts []string
+}
+
+func (f *fakeLLM) Complete(_ context.Context, systemPrompt, userPrompt string, _ ...OpenAIChatCompletionMessage) (string, error) {
+	f.prompts = append(f.prompts, userPrompt)
+	if f.err != nil {
+		return "", f.err
+	}
+	if len(f.replies) == 0 {
+		return "", errors.New("fakeLLM: no more replies")
+	}
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	return reply, nil
+}
+
+// exchange 返回第 n 段对话：用户提问、工具调用与结果、工具返回的图片、最终回答
+func exchange(n int) []OpenAIChatCompletionMessage {
+	id := fmt.Sprintf("call_%d", n)
+	return []OpenAIChatCompletionMessage{
+		{Role: "user", Content: fmt.Sprintf("question %d", n)},
+		{Role: "assistant", ToolCalls: []OpenAIChatCompletionToolCall{{ID: id, Type: "function", Function: OpenAIChatCompletionFunctionCall{Name: "view_image", Arguments: `{"path":"a.png"}`}}}},
+		{Role: "tool", ToolCallID: id, Name: "view_image", Content: "image attached"},
+		{Role: "user", Parts: []OpenAIContentPart{ImagePart("data:image/png;base64,AAAA")}},
+		{Role: "assistant", Content: fmt.Sprintf("answer %d", n)},
+	}
+}
+
+func history(n int) []OpenAIChatCompletionMessage {
+	var h []OpenAIChatCompletionMessage
+	for i := 1; i <= n; i++ {
+		h = append(h, exchange(i)...)
+	}
+	return h
+}
+
+// checkTurns 检查每个 tool 消息前都有发起该调用的 assistant 消息，图片消息紧跟在 tool 消息之后，
+// 且第一条非系统消息是用户提问
+func checkTurns(t *testing.T, messages []OpenAIChatCompletionMessage) {
+	t.Helper()
+	calls := map[string]bool{}
+	first := true
+	for i, m := range messages {
+		switch m.Role {
+		case "system", "developer":
+			continue
+		case "assistant":
+			for _, c := range m.ToolCalls {
+				calls[c.ID] = true
+			}
+		case "tool":
+			if !calls[m.ToolCallID] {
+				t.Errorf("message %d: tool result %s without its assistant tool call", i, m.ToolCallID)
+			}
+		case "user":
+			if len(m.Parts) > 0 && m.Content == "" && (i == 0 || messages[i-1].Role != "tool") {
+				t.Errorf("message %d: attachment separated from its tool result", i)
+			}
+		}
+		if first && (m.Role != "user" || m.Content == "") {
+			t.Errorf("message %d: context starts with %s %q instead of a user question", i, m.Role, m.Content)
+		}
+		first = false
+	}
+}
+
+func contents(messages []OpenAIChatCompletionMessage) []string {
+	var out []string
+	for _, m := range messages {
+		if m.Content != "" {
+			out = append(out, m.Content)
+		}
+	}
+	return out
+}
+
+func TestExchangeStarts(t *testing.T) {
+	h := append([]OpenAIChatCompletionMessage{{Role: "assistant", Content: "resumed"}}, history(2)...)
+	if got, want := exchangeStarts(h), []int{0, 1, 6}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("exchangeStarts = %v, want %v", got, want)
+	}
+	if got := exchangeStarts(nil); got != nil {
+		t.Fatalf("exchangeStarts(nil) = %v", got)
+	}
+}
+
+func TestBufferWindowMemory(t *testing.T) {
+	note := OpenAIChatCompletionMessage{Role: "system", Content: "note: prefer table-driven tests"}
+	h := history(4)
+	h = append(h[:5:5], append([]OpenAIChatCompletionMessage{note}, h[5:]...)...) // 笔记位于第一段末尾
+
+	for _, k := range []int{0, 1, 2, 3} {
+		t.Run(fmt.Sprint("K=", k), func(t *testing.T) {
+			got, err := BufferWindowMemory{K: k}.Context(context.Background(), h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keep := max(k, 1)
+			want := append([]OpenAIChatCompletionMessage{note}, history(4)[len(history(4))-5*keep:]...)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("Context = %q, want %q", contents(got), contents(want))
+			}
+			checkTurns(t, got)
+		})
+	}
+
+	got, _ := BufferWindowMemory{K: 10}.Context(context.Background(), h)
+	if !reflect.DeepEqual(got, h) {
+		t.Fatalf("a window larger than the history must keep everything")
+	}
+}
+
+func TestTokenBudgetMemory(t *testing.T) {
+	note := OpenAIChatCompletionMessage{Role: "system", Content: "note: the user prefers short answers"}
+	h := append([]OpenAIChatCompletionMessage{note}, history(3)...)
+	per := EstimateTokens(exchange(1)...)
+	pinned := EstimateTokens(note)
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		keep      int // 保留的对话段数
+	}{
+		{"current exchange is kept even over budget", 1, 1},
+		{"one exchange", pinned + per, 1},
+		{"two exchanges", pinned + 2*per, 2},
+		{"just below three exchanges", pinned + 3*per - 1, 2},
+		{"everything", pinned + 3*per, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TokenBudgetMemory{MaxTokens: tt.maxTokens}.Context(context.Background(), h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append([]OpenAIChatCompletionMessage{note}, history(3)[15-5*tt.keep:]...)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("Context = %q, want %q", contents(got), contents(want))
+			}
+			checkTurns(t, got)
+			if tt.keep < 3 && EstimateTokens(got...) > max(tt.maxTokens, pinned+per) {
+				t.Fatalf("estimated %d tokens, budget %d", EstimateTokens(got...), tt.maxTokens)
+			}
+		})
+	}
+}
+
+func TestSummaryMemory(t *testing.T) {
+	ctx := context.Background()
+	note := OpenAIChatCompletionMessage{Role: "system", Content: "note: module is gomockAgent"}
+	llm := &fakeLLM{replies: []string{"  S1  ", "S2"}}
+	per := EstimateTokens(exchange(1)...)
+	m := &SummaryMemory{LLM: llm, MaxTokens: 3 * per, KeepTokens: 2 * per}
+
+	// 未超出 MaxTokens 时不压缩
+	h := history(2)
+	got, err := m.Context(ctx, h)
+	if err != nil || !reflect.DeepEqual(got, h) || len(llm.prompts) != 0 {
+		t.Fatalf("Context = %q, %v, %d LLM calls; want the history unchanged", contents(got), err, len(llm.prompts))
+	}
+
+	// 超出后压缩最早的对话，只保留不超过 KeepTokens 的最近两段
+	h = append(append(history(1), note), history(4)[5:]...)
+	got, err = m.Context(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Summary() != "S1" {
+		t.Fatalf("Summary = %q", m.Summary())
+	}
+	want := append([]OpenAIChatCompletionMessage{note, {Role: "system", Content: summaryContextPrompt + "S1"}}, history(4)[10:]...)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Context = %q, want %q", contents(got), contents(want))
+	}
+	checkTurns(t, got[2:])
+	prompt := llm.prompts[0]
+	if !strings.Contains(prompt, "Current summary:\n(none)") || !strings.Contains(prompt, "User: question 2") ||
+		strings.Contains(prompt, "question 3") || strings.Contains(prompt, note.Content) {
+		t.Fatalf("summary prompt = %q", prompt)
+	}
+
+	// 再增加两段：压缩的是尚未摘要的部分，并带上已有摘要
+	h = append(h, history(6)[20:]...)
+	got, err = m.Context(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt = llm.prompts[1]
+	if !strings.Contains(prompt, "Current summary:\nS1") || !strings.Contains(prompt, "question 3") ||
+		strings.Contains(prompt, "question 2") || strings.Contains(prompt, "question 5") {
+		t.Fatalf("second summary prompt = %q", prompt)
+	}
+	if got[1].Content != summaryContextPrompt+"S2" || got[2].Content != "question 5" {
+		t.Fatalf("Context = %q", contents(got))
+	}
+
+	// 历史变短（回退到 checkpoint）后重新开始
+	h = history(1)
+	got, err = m.Context(ctx, h)
+	if err != nil || !reflect.DeepEqual(got, h) || m.Summary() != "" {
+		t.Fatalf("after shrinking: Context = %q, %v, summary %q", contents(got), err, m.Summary())
+	}
+
+	// LLM 失败时返回错误，状态不变
+	failing := &SummaryMemory{LLM: &fakeLLM{err: errors.New("boom")}, MaxTokens: per, KeepTokens: 0}
+	if _, err := failing.Context(ctx, history(3)); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected the LLM error, got %v", err)
+	}
+	if failing.Summary() != "" || failing.covered != 0 {
+		t.Fatalf("state changed after a failed summary")
+	}
+}
+
+func TestEntityMemory(t *testing.T) {
+	ctx := context.Background()
+	llm := &fakeLLM{replies: []string{
+		"Here are the notes:\n```json\n{\"main.go\": \"Entry point.\", \"Alice\": \"The user.\"}\n```",
+		`{"go.mod": "Module file.", "Alice": ""}`,
+		`{"README": "Docs."}`,
+	}}
+	m := &EntityMemory{LLM: llm, K: 1, MaxEntities: 2}
+
+	// 窗口内不调用 LLM
+	got, err := m.Context(ctx, history(1))
+	if err != nil || len(got) != 5 || len(llm.prompts) != 0 {
+		t.Fatalf("Context = %q, %v", contents(got), err)
+	}
+
+	got, err = m.Context(ctx, history(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := entityContextPrompt + "\n- Alice: The user.\n- main.go: Entry point."
+	if got[0].Role != "system" || got[0].Content != want {
+		t.Fatalf("entity message = %q, want %q", got[0].Content, want)
+	}
+	checkTurns(t, got[1:])
+	if !reflect.DeepEqual(got[1:], exchange(2)) {
+		t.Fatalf("Context = %q", contents(got))
+	}
+
+	// 空字符串删除实体；最近更新的在后
+	got, err = m.Context(ctx, history(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := entityContextPrompt + "\n- main.go: Entry point.\n- go.mod: Module file."; got[0].Content != want {
+		t.Fatalf("entity message = %q, want %q", got[0].Content, want)
+	}
+	if !strings.Contains(llm.prompts[1], `"Alice": "The user."`) {
+		t.Fatalf("existing notes missing from the prompt: %q", llm.prompts[1])
+	}
+
+	// 超过 MaxEntities 时只发送最近更新的记录，但记录本身保留
+	got, err = m.Context(ctx, history(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := entityContextPrompt + "\n- go.mod: Module file.\n- README: Docs."; got[0].Content != want {
+		t.Fatalf("entity message = %q, want %q", got[0].Content, want)
+	}
+	if len(m.Entities()) != 3 {
+		t.Fatalf("Entities = %v", m.Entities())
+	}
+
+	// 历史变短后重新开始
+	got, err = m.Context(ctx, history(1))
+	if err != nil || len(m.Entities()) != 0 || !reflect.DeepEqual(got, history(1)) {
+		t.Fatalf("after shrinking: Context = %q, %v, entities %v", contents(got), err, m.Entities())
+	}
+}
+
+func TestEntityMemoryParseErrors(t *testing.T) {
+	for _, reply := range []string{"no notes", `{"a": 1}`, `{"a": "b"`} {
+		t.Run(reply, func(t *testing.T) {
+			m := &EntityMemory{LLM: &fakeLLM{replies: []string{reply}}, K: 1, MaxEntities: 5}
+			if _, err := m.Context(context.Background(), history(2)); err == nil {
+				t.Fatalf("expected an error for reply %q", reply)
+			}
+			if m.covered != 0 || len(m.Entities()) != 0 {
+				t.Fatalf("state changed after a parse error")
+			}
+		})
+	}
+}
+
+func TestMemoryConfig(t *testing.T) {
+	for _, c := range []MemoryConfig{{Type: "bogus"}, {Type: "window", Window: -1}, {Type: "summary", MaxTokens: 100, KeepTokens: 200}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", c)
+		}
+	}
+	summary := (&MemoryConfig{Type: "summary", MaxTokens: 1000}).factory()(&fakeLLM{}).(*SummaryMemory)
+	if summary.MaxTokens != 1000 || summary.KeepTokens != 500 {
+		t.Errorf("summary memory = %+v", summary)
+	}
+	entity := (&MemoryConfig{Type: "entity"}).factory()(&fakeLLM{}).(*EntityMemory)
+	if entity.K != defaultEntityMemoryWindow || entity.MaxEntities != defaultMaxEntities {
+		t.Errorf("entity memory = %+v", entity)
+	}
+	if (&MemoryConfig{}).factory() != nil {
+		t.Errorf("buffer memory must send the full conversation")
+	}
+}
@@ -0,0 +1,51 @@
+package agent
+
+// -------------------------- 请求参数 --------------------------
+
+// Profile 是一组模型与请求参数。未指定时使用 DefaultProfile；
+// 指定的 profile 按原样发送，不与默认值合并（o 系列模型不接受 temperature、max_tokens）。
+type Profile struct {
+	Model               string                `json:"model,omitempty"`       // 覆盖 $OPENAI_MODEL
+	SystemRole          string                `json:"system_role,omitempty"` // system（默认）或 developer
+	MaxTokens           int                   `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                   `json:"max_completion_tokens,omitempty"`
+	Temperature         *float32              `json:"temperature,omitempty"`
+	TopP                *float32              `json:"top_p,omitempty"`
+	N                   int                   `json:"n,omitempty"`
+	Stop                []string              `json:"stop,omitempty"`
+	Seed                *int                  `json:"seed,omitempty"`
+	PresencePenalty     *float32              `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float32              `json:"frequency_penalty,omitempty"`
+	ResponseFormat      *OpenAIResponseFormat `json:"response_format,omitempty"`
+	ParallelToolCalls   *bool                 `json:"parallel_tool_calls,omitempty"`
+	Logprobs            bool                  `json:"logprobs,omitempty"`
+	TopLogprobs         *int                  `json:"top_logprobs,omitempty"`
+	User                string                `json:"user,omitempty"`
+	ReasoningEffort     string                `json:"reasoning_effort,omitempty"`
+	Memory              *MemoryConfig         `json:"memory,omitempty"` // 对话记忆策略，不是请求参数
+}
+
+// DefaultProfile 保持未配置 profile 时的请求参数
+func DefaultProfile() Profile {
+	temperature := float32(0.7)
+	return Profile{MaxTokens: 2048, Temperature: &temperature}
+}
+
+// applyTo 把 profile 中的参数写入请求
+func (p Profile) applyTo(req *OpenAIChatCompletionRequest) {
+	req.MaxTokens = p.MaxTokens
+	req.MaxCompletionTokens = p.MaxCompletionTokens
+	req.Temperature = p.Temperature
+	req.TopP = p.TopP
+	req.N = p.N
+	req.Stop = p.Stop
+	req.Seed = p.Seed
+	req.PresencePenalty = p.PresencePenalty
+	req.FrequencyPenalty = p.FrequencyPenalty
+	req.ResponseFormat = p.ResponseFormat
+	req.ParallelToolCalls = p.ParallelToolCalls
+	req.Logprobs = p.Logprobs
+	req.TopLogprobs = p.TopLogprobs
+	req.User = p.User
+	req.ReasoningEffort = p.ReasoningEffort
+}
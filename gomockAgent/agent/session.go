@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// -------------------------- 会话 --------------------------
+
+// Session 保存一段多轮对话及其用量。同一个 Session 的 Send 不能并发调用
+type Session struct {
+	ID       string
+	agent    *Agent
+	usage    *UsageTracker
+	subs     subscribers
+	approver approverHolder
+
+	mu         sync.Mutex
+	messages   []OpenAIChatCompletionMessage
+	prefix     int // 系统提示与示例的消息数
+	turn       int
+	instructed map[string]bool // 已注入的按需指令
+	memory     Memory          // 为 nil 时发送完整对话
+}
+
+// NewSession 创建一个只包含系统提示（及 few-shot 示例）的新会话
+func (a *Agent) NewSession() *Session {
+	messages := []OpenAIChatCompletionMessage{{Role: a.systemRole(), Content: a.systemPrompt}}
+	messages = append(messages, a.examples...)
+	s := &Session{
+		ID:       newSessionID(),
+		agent:    a,
+		usage:    NewUsageTracker(a.prices, a.budget),
+		messages: messages,
+		prefix:   len(messages),
+	}
+	if a.memory != nil {
+		s.memory = a.memory(sessionLLM{s})
+	}
+	return s
+}
+
+// ResumeSession 创建一个以 history 为已有对话的会话，history 不含 Agent 的系统提示与示例
+func (a *Agent) ResumeSession(history []OpenAIChatCompletionMessage) *Session {
+	s := a.NewSession()
+	s.messages = append(s.messages, history...)
+	return s
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Agent 返回创建该会话的 Agent
+func (s *Session) Agent() *Agent { return s.agent }
+
+// Usage 返回会话的用量统计
+func (s *Session) Usage() *UsageTracker { return s.usage }
+
+// Subscribe 只订阅该会话的事件
+func (s *Session) Subscribe(sub Subscriber) (unsubscribe func()) { return s.subs.add(sub) }
+
+// Messages 返回当前对话的副本
+func (s *Session) Messages() []OpenAIChatCompletionMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OpenAIChatCompletionMessage(nil), s.messages...)
+}
+
+// AddNote 以系统消息的形式告知模型状态变化，例如用户撤销了文件修改
+func (s *Session) AddNote(note string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, OpenAIChatCompletionMessage{Role: s.agent.systemRole(), Content: note})
+}
+
+// Send 发送一条用户消息并执行工具循环，返回模型的最终回复文本
+func (s *Session) Send(ctx context.Context, prompt string) (string, error) {
+	return s.SendParts(ctx, prompt, nil)
+}
+
+// SendParts 与 Send 相同，但在用户消息后附加内容，例如引用的文件与图片。
+// TurnStarted 事件中的 Prompt 只包含 prompt
+func (s *Session) SendParts(ctx context.Context, prompt string, parts []OpenAIContentPart) (string, error) {
+	final, err := s.run(ctx, prompt, parts)
+	if err != nil {
+		return "", err
+	}
+	return final.Content, nil
+}
+
+// run 执行一轮：追加用户消息，运行工具循环，最后发送 TurnFinished
+func (s *Session) run(ctx context.Context, prompt string, parts []OpenAIContentPart) (OpenAIChatCompletionMessage, error) {
+	s.BeginTurn(prompt)
+	s.mu.Lock()
+	conversation := append(s.messages, OpenAIChatCompletionMessage{Role: "user", Content: prompt, Parts: parts})
+	s.mu.Unlock()
+
+	conversation, err := s.runToolLoop(ctx, conversation)
+	s.mu.Lock()
+	s.messages = conversation
+	s.mu.Unlock()
+	s.finishTurn(err)
+	if err != nil {
+		return OpenAIChatCompletionMessage{}, err
+	}
+	return conversation[len(conversation)-1], nil
+}
+
+// BeginTurn 开始新的一轮并发送 TurnStarted
+func (s *Session) BeginTurn(prompt string) {
+	s.mu.Lock()
+	s.turn++
+	s.mu.Unlock()
+	s.usage.BeginTurn(prompt)
+	s.emit(TurnStarted{EventMeta: s.meta(), Prompt: prompt})
+}
+
+func (s *Session) finishTurn(err error) {
+	turn, _ := s.usage.LastTurn()
+	finished := TurnFinished{EventMeta: s.meta(), Usage: turn.Total}
+	if err != nil {
+		finished.Error = err.Error()
+		s.emit(ErrorEvent{EventMeta: s.meta(), Err: err, Message: err.Error()})
+	}
+	s.emit(finished)
+}
+
+func (s *Session) meta() EventMeta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return EventMeta{SessionID: s.ID, Turn: s.turn, Time: time.Now()}
+}
+
+// emit 先投递给会话订阅者，再投递给 Agent 订阅者
+func (s *Session) emit(e Event) {
+	s.subs.publish(e)
+	s.agent.subs.publish(e)
+}
+
+func (s *Session) notice(kind, format string, args ...any) {
+	s.emit(Notice{EventMeta: s.meta(), Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// runToolLoop 反复调用模型并执行其请求的工具，直到模型给出不含工具调用的回复。
+// 返回追加了本轮所有消息的对话，最后一条即最终回复；出错时返回已有的对话。
+func (s *Session) runToolLoop(ctx context.Context, conversation []OpenAIChatCompletionMessage, opts ...requestOption) ([]OpenAIChatCompletionMessage, error) {
+	for {
+		// 截断续写、内容过滤等由 nextAssistantMessage 处理
+		assistantMessage, err := s.nextAssistantMessage(ctx, s.requestMessages(ctx, conversation), opts...)
+		if err != nil {
+			return conversation, err // let user re-prompt
+		}
+
+		// Add assistant's message (text and/or tool calls) to conversation
+		conversation = append(conversation, assistantMessage)
+		if assistantMessage.Content != "" {
+			s.emit(AssistantTextDelta{EventMeta: s.meta(), Text: assistantMessage.Content})
+		}
+		if len(assistantMessage.ToolCalls) == 0 {
+			// No tools called, wait for next user input
+			return conversation, nil
+		}
+
+		// 如果返回了工具调用，则需要调用工具
+		var attachments []OpenAIContentPart
+		var newInstructions []Instruction
+		for _, toolCall := range assistantMessage.ToolCalls {
+			if toolCall.Type != "function" {
+				continue // Skip non-function tool calls if any
+			}
+			if err := ctx.Err(); err != nil {
+				return conversation, err
+			}
+			toolMessage, parts, instructions := s.executeTool(ctx, toolCall)
+			conversation = append(conversation, toolMessage)
+			attachments = append(attachments, parts...)
+			newInstructions = append(newInstructions, instructions...)
+		}
+		// tool 消息必须紧跟在发起调用的 assistant 消息之后，图片等内容与指令放在其后
+		if len(attachments) > 0 {
+			conversation = append(conversation, OpenAIChatCompletionMessage{Role: "user", Content: toolAttachmentsPrompt, Parts: attachments})
+		}
+		if len(newInstructions) > 0 {
+			conversation = append(conversation, s.instructionsMessage(newInstructions))
+		}
+	}
+}
+
+// requestMessages 返回本次请求发送的对话：系统提示与示例，加上 Memory 选出的历史。
+// Memory 出错时（例如生成摘要失败）发出警告并发送完整对话
+func (s *Session) requestMessages(ctx context.Context, conversation []OpenAIChatCompletionMessage) []OpenAIChatCompletionMessage {
+	if s.memory == nil || len(conversation) <= s.prefix {
+		return conversation
+	}
+	history, err := s.memory.Context(ctx, conversation[s.prefix:])
+	if err != nil {
+		s.notice("warning", "memory: %v, sending the full conversation", err)
+		return conversation
+	}
+	request := append(conversation[:s.prefix:s.prefix], history...)
+	// Memory 生成的摘要等使用 system 角色，按 profile 改为 developer
+	if role := s.agent.systemRole(); role != "system" {
+		for i := s.prefix; i < len(request); i++ {
+			if request[i].Role == "system" {
+				request[i].Role = role
+			}
+		}
+	}
+	return request
+}
+
+// sessionLLM 供 Memory 生成摘要，调用计入会话的用量与预算
+type sessionLLM struct{ s *Session }
+
+func (l sessionLLM) Complete(ctx context.Context, systemPrompt, userPrompt string, examples ...OpenAIChatCompletionMessage) (string, error) {
+	conversation := []OpenAIChatCompletionMessage{{Role: l.s.agent.systemRole(), Content: systemPrompt}}
+	conversation = append(conversation, examples...)
+	conversation = append(conversation, OpenAIChatCompletionMessage{Role: "user", Content: userPrompt})
+	l.s.notice("memory", "condensing the earlier conversation")
+	message, err := l.s.nextAssistantMessage(ctx, conversation, withoutTools)
+	if err != nil {
+		return "", err
+	}
+	return message.Content, nil
+}
+
+// toolAttachmentsPrompt 引出工具返回的多模态内容
+const toolAttachmentsPrompt = "Content returned by the tool calls above:"
+
+type sessionIDKey struct{}
+
+// SessionIDFromContext 返回发起工具调用的会话 ID，工具可据此把状态（例如文件快照）按会话隔离
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionIDKey{}).(string)
+	return id, ok
+}
+
+// executeTool 执行一次工具调用，返回回传给模型的 tool 消息、工具返回的多模态内容，以及新的按需指令
+func (s *Session) executeTool(ctx context.Context, toolCall OpenAIChatCompletionToolCall) (OpenAIChatCompletionMessage, []OpenAIContentPart, []Instruction) {
+	toolName := toolCall.Function.Name
+	toolArgs := toolCall.Function.Arguments // This is a JSON *string*
+	started := ToolCallStarted{EventMeta: s.meta(), CallID: toolCall.ID, Name: toolName, Arguments: toolArgs}
+	finished := ToolCallFinished{EventMeta: started.EventMeta, CallID: toolCall.ID, Name: toolName}
+
+	var output string
+	var parts []OpenAIContentPart
+	var err error
+	toolDef, found := s.agent.tools[toolName]
+	if !found {
+		s.emit(started)
+		err = fmt.Errorf("tool '%s' not found by agent", toolName)
+	} else {
+		// 执行函数前先修复常见的 JSON 错误
+		args, repairs, repairErr := RepairToolArguments(toolName, toolArgs, toolDef.InputSchema)
+		s.agent.repairs.Record(s.agent.model, repairs, repairErr != nil)
+		if repairErr == nil && len(repairs) > 0 {
+			started.Arguments = string(args)
+			started.RawArguments = toolArgs
+			started.Repairs = repairs
+		}
+		s.emit(started)
+		if repairErr != nil {
+			err = fmt.Errorf("error executing tool '%s': %w", toolName, repairErr)
+		} else if err = s.approve(ctx, started); err == nil {
+			// 等待审批的时间不计入工具耗时；被拒绝时 err 原样回传给模型
+			start := time.Now()
+			var result ToolResult
+			result, err = toolDef.Call(context.WithValue(ctx, sessionIDKey{}, s.ID), args)
+			output, parts = result.Text, result.Parts
+			finished.Duration = time.Since(start)
+			if err != nil {
+				err = fmt.Errorf("error executing tool '%s': %w", toolName, err)
+			}
+		}
+	}
+
+	content := output
+	var instructions []Instruction
+	if err != nil {
+		finished.Error = err.Error()
+		content = err.Error() // Report error back to OpenAI
+		parts = nil
+	} else {
+		finished.Output = output
+		instructions = s.scopedInstructions(started)
+	}
+	finished.Time = time.Now()
+	s.emit(finished)
+	return OpenAIChatCompletionMessage{
+		Role:       "tool",
+		ToolCallID: toolCall.ID,
+		Content:    content,
+		Name:       toolName,
+	}, parts, instructions
+}
+
+// call 发送一次请求并记录用量
+func (s *Session) call(ctx context.Context, conversation []OpenAIChatCompletionMessage, opts ...requestOption) (*OpenAIChatCompletionResponse, error) {
+	reply, err := s.agent.callOpenAICompletion(ctx, conversation, opts...)
+	if err != nil {
+		return nil, err
+	}
+	model := reply.Model
+	if model == "" {
+		model = s.agent.model
+	}
+	call := s.usage.Record(model, reply.Usage)
+	turn, _ := s.usage.LastTurn()
+	s.emit(UsageUpdated{EventMeta: s.meta(), Call: call, Turn: turn.Total, Session: s.usage.Session()})
+	return reply, nil
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// -------------------------- strict 模式 schema --------------------------
+// OpenAI 的 strict function calling 与 json_schema response_format 要求：
+//   - 每一层对象都声明 additionalProperties: false
+//   - 所有属性都出现在 required 中，可选字段用 ["T", "null"] 表示
+//   - 不能出现没有固定属性的对象（map）或无类型的值
+//   - 只支持部分校验关键字
+// StrictSchema 把 GenerateSchema 的结果转换成满足上述约束的形式。
+// 参考 https://platform.openai.com/docs/guides/structured-outputs
+
+// strictUnsupportedKeywords 在 strict 模式下会被拒绝的关键字，转换时直接去掉
+var strictUnsupportedKeywords = []string{
+	"$schema", "$id", "default", "examples",
+	"minLength", "maxLength",
+	"minProperties", "maxProperties", "patternProperties", "propertyNames", "unevaluatedProperties",
+	"uniqueItems", "contains", "if", "then", "else", "not", "dependentRequired", "dependentSchemas",
+}
+
+// GenerateStrictSchema 为 T 生成 strict 模式可用的 schema
+func GenerateStrictSchema[T any]() (map[string]any, error) {
+	return StrictSchema(GenerateSchema[T]())
+}
+
+// StrictSchema 返回 schema 的 strict 版本，不修改入参
+func StrictSchema(schema map[string]any) (map[string]any, error) {
+	copied, err := cloneSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := strictify(copied, "$"); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+func cloneSchema(schema map[string]any) (map[string]any, error) {
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy schema: %w", err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("failed to copy schema: %w", err)
+	}
+	return out, nil
+}
+
+func strictify(node map[string]any, path string) error {
+	for _, k := range strictUnsupportedKeywords {
+		delete(node, k)
+	}
+
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		branches, ok := node[key].([]any)
+		if !ok {
+			continue
+		}
+		for i, b := range branches {
+			bs, ok := b.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s.%s[%d]: schema must be an object", path, key, i)
+			}
+			if err := strictify(bs, fmt.Sprintf("%s.%s[%d]", path, key, i)); err != nil {
+				return err
+			}
+		}
+		// strict 模式只支持 anyOf
+		if key == "oneOf" {
+			node["anyOf"] = append(asSlice(node["anyOf"]), branches...)
+			delete(node, "oneOf")
+		}
+	}
+	if defs, ok := node["$defs"].(map[string]any); ok {
+		for name, d := range defs {
+			if ds, ok := d.(map[string]any); ok {
+				if err := strictify(ds, path+".$defs."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	types := schemaTypes(node)
+	_, hasRef := node["$ref"]
+	_, hasAnyOf := node["anyOf"]
+	if len(types) == 0 && !hasRef && !hasAnyOf && node["enum"] == nil && node["const"] == nil {
+		return fmt.Errorf("%s: value without a fixed type is not supported in strict mode", path)
+	}
+
+	for _, t := range types {
+		switch t {
+		case "object":
+			if err := strictifyObject(node, path); err != nil {
+				return err
+			}
+		case "array":
+			items, ok := node["items"].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: array without an items schema is not supported in strict mode", path)
+			}
+			if err := strictify(items, path+"[]"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func strictifyObject(node map[string]any, path string) error {
+	props, _ := node["properties"].(map[string]any)
+	if len(props) == 0 {
+		if extra, ok := node["additionalProperties"]; ok && extra != false {
+			return fmt.Errorf("%s: map types are not supported in strict mode; use a struct or a list of key/value objects", path)
+		}
+	}
+
+	required := make(map[string]bool)
+	for _, r := range asSlice(node["required"]) {
+		if name, ok := r.(string); ok {
+			required[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	allRequired := make([]any, 0, len(names))
+	for _, name := range names {
+		prop, ok := props[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s.%s: property schema must be an object", path, name)
+		}
+		if err := strictify(prop, path+"."+name); err != nil {
+			return err
+		}
+		if !required[name] {
+			makeNullable(prop)
+		}
+		allRequired = append(allRequired, name)
+	}
+	node["properties"] = props
+	node["required"] = allRequired
+	node["additionalProperties"] = false
+	return nil
+}
+
+// makeNullable 允许属性取 null，用来表达“可选”
+func makeNullable(prop map[string]any) {
+	if enum, ok := prop["enum"].([]any); ok && !containsJSONValue(enum, nil) {
+		prop["enum"] = append(enum, nil)
+	}
+	switch t := prop["type"].(type) {
+	case string:
+		if t != "null" {
+			prop["type"] = []any{t, "null"}
+		}
+		return
+	case []any:
+		for _, v := range t {
+			if v == "null" {
+				return
+			}
+		}
+		prop["type"] = append(t, "null")
+		return
+	}
+	if branches, ok := prop["anyOf"].([]any); ok {
+		prop["anyOf"] = append(branches, map[string]any{"type": "null"})
+		return
+	}
+	// 只有 $ref / enum / const 时包一层 anyOf
+	inner := make(map[string]any, len(prop))
+	for k, v := range prop {
+		if k != "description" {
+			inner[k] = v
+			delete(prop, k)
+		}
+	}
+	prop["anyOf"] = []any{inner, map[string]any{"type": "null"}}
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// dropNulls 去掉对象中值为 null 的属性。
+// strict 模式下模型用 null 表示未提供的可选参数，校验与反序列化前按缺省处理。
+func dropNulls(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if val == nil {
+				delete(t, k)
+				continue
+			}
+			t[k] = dropNulls(val)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = dropNulls(val)
+		}
+	}
+	return v
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+type strictInner struct {
+	Value int    `json:"value" jsonschema:"required"`
+	Note  string `json:"note,omitempty"`
+}
+
+type strictNested struct {
+	Name  string       `json:"name" jsonschema:"required,minLength=1"`
+	Inner strictInner  `json:"inner" jsonschema:"required"`
+	Opt   *strictInner `json:"opt,omitempty"`
+	Mode  string       `json:"mode,omitempty" jsonschema:"enum=fast,enum=slow"`
+}
+
+type strictSlice struct {
+	Items []strictInner `json:"items" jsonschema:"required"`
+	Tags  []string      `json:"tags,omitempty"`
+}
+
+type strictMap struct {
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type strictBase struct {
+	ID   string `json:"id" jsonschema:"required"`
+	Rev  int    `json:"rev,omitempty"`
+	Seen bool   `json:"seen,omitempty"`
+}
+
+type strictEmbedded struct {
+	strictBase
+	Title string `json:"title" jsonschema:"required"`
+}
+
+// strictCase 是一个 golden 用例；map 不能用于 strict 模式，golden 中记录的是错误
+type strictCase struct {
+	name   string
+	schema map[string]any // GenerateSchema 的结果
+	strict func() (map[string]any, error)
+	sample string // strict 模式下模型可能给出的参数，可选字段为 null
+	decode func(json.RawMessage) (any, error)
+}
+
+func newStrictCase[T any](name, sample string) strictCase {
+	return strictCase{
+		name:   name,
+		schema: GenerateSchema[T](),
+		strict: GenerateStrictSchema[T],
+		sample: sample,
+		decode: func(raw json.RawMessage) (any, error) {
+			var v T
+			err := json.Unmarshal(raw, &v)
+			return v, err
+		},
+	}
+}
+
+var strictCases = []strictCase{
+	newStrictCase[strictNested]("nested", `{"name":"a","inner":{"value":1,"note":null},"opt":null,"mode":null}`),
+	newStrictCase[strictSlice]("slice", `{"items":[{"value":1,"note":null},{"value":2,"note":"x"}],"tags":null}`),
+	newStrictCase[strictMap]("map", ""),
+	newStrictCase[strictEmbedded]("embedded", `{"id":"x","rev":null,"seen":null,"title":"t"}`),
+}
+
+func TestStrictSchemaGolden(t *testing.T) {
+	for _, tc := range strictCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []byte
+			schema, err := tc.strict()
+			if err != nil {
+				got = []byte("error: " + err.Error() + "\n")
+			} else {
+				got, _ = json.MarshalIndent(schema, "", "  ")
+				got = append(got, '\n')
+			}
+			golden := filepath.Join("testdata", "strict", tc.name+".golden")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("schema differs from %s (run go test -update if the change is intended)\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestStrictSchemaInvariants(t *testing.T) {
+	for _, tc := range strictCases {
+		if tc.sample == "" {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			strict, err := tc.strict()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStrictObject(t, "$", strict, tc.schema)
+		})
+	}
+}
+
+// checkStrictObject 检查 strict 中的每个对象：additionalProperties 为 false、所有属性都 required，
+// 原 schema 中的可选属性可以取 null
+func checkStrictObject(t *testing.T, path string, strict, original map[string]any) {
+	t.Helper()
+	if slices.Contains(schemaTypes(strict), "array") {
+		items, _ := original["items"].(map[string]any)
+		checkStrictObject(t, path+"[]", strict["items"].(map[string]any), items)
+		return
+	}
+	if !slices.Contains(schemaTypes(strict), "object") {
+		return
+	}
+	if strict["additionalProperties"] != false {
+		t.Errorf("%s: additionalProperties = %v, want false", path, strict["additionalProperties"])
+	}
+	props, _ := strict["properties"].(map[string]any)
+	originalProps, _ := original["properties"].(map[string]any)
+	var names []string
+	for name := range props {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var required []string
+	for _, r := range asSlice(strict["required"]) {
+		required = append(required, r.(string))
+	}
+	slices.Sort(required)
+	if !slices.Equal(names, required) {
+		t.Errorf("%s: required = %v, want all properties %v", path, required, names)
+	}
+
+	originalRequired := asSlice(original["required"])
+	for _, name := range names {
+		prop := props[name].(map[string]any)
+		originalProp, _ := originalProps[name].(map[string]any)
+		optional := !slices.Contains(originalRequired, any(name))
+		if optional != acceptsNull(prop) {
+			t.Errorf("%s.%s: optional = %v but accepts null = %v", path, name, optional, acceptsNull(prop))
+		}
+		if branches, ok := prop["anyOf"].([]any); ok {
+			prop = branches[0].(map[string]any)
+		}
+		checkStrictObject(t, path+"."+name, prop, originalProp)
+	}
+}
+
+func acceptsNull(prop map[string]any) bool {
+	return len(ValidateSchema(prop, nil)) == 0
+}
+
+// strict 模式的参数经 dropNulls 后应当通过原 schema 的校验，并反序列化为同样的值
+func TestStrictSchemaDropNullsRoundTrip(t *testing.T) {
+	for _, tc := range strictCases {
+		if tc.sample == "" {
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			strict, err := tc.strict()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tc.sample), &value); err != nil {
+				t.Fatal(err)
+			}
+			if problems := ValidateSchema(strict, value); len(problems) > 0 {
+				t.Fatalf("sample does not match the strict schema: %v", problems)
+			}
+			if problems := ValidateSchema(tc.schema, value); len(problems) == 0 {
+				t.Fatalf("nulls should not match the original schema")
+			}
+			dropped := dropNulls(value)
+			if problems := ValidateSchema(tc.schema, dropped); len(problems) > 0 {
+				t.Fatalf("sample without nulls does not match the original schema: %v", problems)
+			}
+
+			withoutNulls, _ := json.Marshal(dropped)
+			got, err := tc.decode(withoutNulls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := tc.decode(json.RawMessage(tc.sample))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("decoded %+v, want %+v", got, want)
+			}
+			// 再次序列化后的值仍然满足原 schema
+			again, _ := json.Marshal(got)
+			var back any
+			_ = json.Unmarshal(again, &back)
+			if problems := ValidateSchema(tc.schema, back); len(problems) > 0 {
+				t.Fatalf("re-encoded value does not match the original schema: %v", problems)
+			}
+		})
+	}
+}
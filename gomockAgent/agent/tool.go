@@ -0,0 +1,414 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+)
+
+// ToolDefinition 描述一个可供模型调用的工具
+type ToolDefinition struct {
+	Name        string
+	Description string
+	// InputSchema now map[string]any to match OpenAI's parameter schema format
+	InputSchema map[string]any
+	// Function 的 ctx 随会话取消（Ctrl-C、serve 的 cancel 等），耗时的工具应当遵守
+	Function func(ctx context.Context, input json.RawMessage) (string, error) // Input is JSON string from OpenAI args
+	// ContentFunction 用于返回图片等多模态内容的工具，设置后 Session 用它代替 Function。
+	// NewTool 在结果类型为 ToolResult 时自动设置
+	ContentFunction func(ctx context.Context, input json.RawMessage) (ToolResult, error)
+}
+
+// ToolResult 是带多模态内容的工具结果。Chat Completions 的 tool 消息只能包含文本，
+// 因此 Text 作为 tool 消息回传，Parts 在本批工具调用之后以一条用户消息附加
+type ToolResult struct {
+	Text  string
+	Parts []OpenAIContentPart
+}
+
+func (r ToolResult) String() string { return r.Text }
+
+// Call 执行工具，优先使用 ContentFunction
+func (t ToolDefinition) Call(ctx context.Context, input json.RawMessage) (ToolResult, error) {
+	if t.ContentFunction != nil {
+		return t.ContentFunction(ctx, input)
+	}
+	output, err := t.Function(ctx, input)
+	return ToolResult{Text: output}, err
+}
+
+// GenerateSchema adapted to return map[string]any
+func GenerateSchema[T any]() map[string]any {
+	reflector := jsonschema.Reflector{
+		AllowAdditionalProperties:  false,
+		DoNotReference:             true, // Keep definitions inline for OpenAI
+		RequiredFromJSONSchemaTags: true, // Respect `jsonschema:"required"`
+	}
+	var v T
+	schema := reflector.Reflect(v)
+
+	// Convert the jsonschema.Schema to map[string]any expected by OpenAI
+	// This is a simplification; a full conversion might be more complex
+	schemaBytes, _ := json.Marshal(schema)
+	var schemaMap map[string]any
+	_ = json.Unmarshal(schemaBytes, &schemaMap)
+
+	// OpenAI expects parameters schema directly, remove unnecessary outer layers if present
+	if props, ok := schemaMap["properties"]; ok {
+		schemaMap["properties"] = props
+	}
+	if req, ok := schemaMap["required"]; ok {
+		schemaMap["required"] = req
+	}
+	schemaMap["type"] = "object" // Ensure root type is object
+
+	return schemaMap
+}
+
+// -------------------------- 泛型工具构造 --------------------------
+// NewTool 把 func(ctx, T) (R, error) 包装成 ToolDefinition：
+//   - InputSchema 由 GenerateSchema[T] 生成
+//   - 参数先按 schema 校验，再反序列化为 T
+//   - 结果为 string 时原样返回，ToolResult 同时设置 ContentFunction，其余类型序列化为 JSON
+// 校验失败时返回统一格式的错误，列出所有问题并附上期望的 schema，方便模型自行修正。
+
+// NewTool 创建一个强类型工具
+func NewTool[T any, R any](name, description string, fn func(ctx context.Context, input T) (R, error)) ToolDefinition {
+	schema := GenerateSchema[T]()
+	def := ToolDefinition{
+		Name:        name,
+		Description: description,
+		InputSchema: schema,
+		Function: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			input, err := decodeToolInput[T](name, schema, raw)
+			if err != nil {
+				return "", err
+			}
+			result, err := fn(ctx, input)
+			if err != nil {
+				return "", err
+			}
+			return encodeToolResult(name, result)
+		},
+	}
+	if _, ok := any(*new(R)).(ToolResult); ok {
+		def.ContentFunction = func(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+			input, err := decodeToolInput[T](name, schema, raw)
+			if err != nil {
+				return ToolResult{}, err
+			}
+			result, err := fn(ctx, input)
+			if err != nil {
+				return ToolResult{}, err
+			}
+			return any(result).(ToolResult), nil
+		}
+	}
+	return def
+}
+
+// decodeToolInput 校验参数并反序列化为 T
+func decodeToolInput[T any](name string, schema map[string]any, raw json.RawMessage) (T, error) {
+	var input T
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		raw = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return input, fmt.Errorf("failed to parse input for %s: %w. Input was: %s", name, err, string(raw))
+	}
+	// strict 模式下可选参数以 null 出现，按未提供处理
+	if problems := ValidateSchema(schema, dropNulls(value)); len(problems) > 0 {
+		return input, &ToolInputError{Tool: name, Problems: problems, Schema: schema}
+	}
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return input, fmt.Errorf("failed to parse input for %s: %w. Input was: %s", name, err, string(raw))
+	}
+	return input, nil
+}
+
+func encodeToolResult(name string, result any) (string, error) {
+	switch v := result.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s result to JSON: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// ToolInputError 描述参数未通过 schema 校验
+type ToolInputError struct {
+	Tool     string
+	Problems []SchemaProblem
+	Schema   map[string]any
+}
+
+func (e *ToolInputError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid arguments for %s:\n", e.Tool)
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "  - %s\n", p)
+	}
+	if schema, err := json.Marshal(compactSchema(e.Schema)); err == nil {
+		fmt.Fprintf(&b, "Expected arguments schema: %s", schema)
+	}
+	return b.String()
+}
+
+// compactSchema 去掉对模型没有意义的元信息
+func compactSchema(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		if k == "$schema" || k == "$id" {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// -------------------------- schema 校验 --------------------------
+// 只实现工具参数用得到的 JSON Schema 子集：type、properties、required、
+// additionalProperties、items、enum、const、anyOf/oneOf 以及长度与数值范围。
+
+// SchemaProblem 是一条校验错误，Path 使用 $.a.b[0] 形式
+type SchemaProblem struct {
+	Path    string
+	Message string
+}
+
+func (p SchemaProblem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// ValidateSchema 校验 value（由 json.Decoder 配合 UseNumber 解码）是否满足 schema
+func ValidateSchema(schema map[string]any, value any) []SchemaProblem {
+	var problems []SchemaProblem
+	validateValue(schema, value, "$", &problems)
+	return problems
+}
+
+func validateValue(schema map[string]any, value any, path string, problems *[]SchemaProblem) {
+	add := func(format string, args ...any) {
+		*problems = append(*problems, SchemaProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if branches, ok := schema[key].([]any); ok && len(branches) > 0 {
+			matched := false
+			for _, b := range branches {
+				if bs, ok := b.(map[string]any); ok {
+					var sub []SchemaProblem
+					validateValue(bs, value, path, &sub)
+					if len(sub) == 0 {
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				add("does not match any of the allowed schemas")
+				return
+			}
+		}
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		actual := jsonType(value)
+		if !typeAllowed(types, actual, value) {
+			add("expected %s, got %s", strings.Join(types, " or "), actual)
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !containsJSONValue(enum, value) {
+		add("must be one of %s", formatEnum(enum))
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		add("must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		validateObject(schema, v, path, problems)
+	case []any:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < n {
+			add("must contain at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > n {
+			add("must contain at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema["minLength"]); ok && length < n {
+			if n == 1 {
+				add("must not be empty")
+			} else {
+				add("must be at least %v characters", n)
+			}
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && length > n {
+			add("must be at most %v characters", n)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(schema["minimum"]); ok && f < n {
+			add("must be >= %v", n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && f > n {
+			add("must be <= %v", n)
+		}
+	}
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, problems *[]SchemaProblem) {
+	props, _ := schema["properties"].(map[string]any)
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*problems = append(*problems, SchemaProblem{Path: path + "." + name, Message: "missing required property"})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := path + "." + k
+		if ps, ok := props[k].(map[string]any); ok {
+			validateValue(ps, obj[k], child, problems)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*problems = append(*problems, SchemaProblem{Path: child, Message: fmt.Sprintf("unknown property (allowed: %s)", strings.Join(sortedKeys(props), ", "))})
+			}
+		case map[string]any:
+			validateValue(extra, obj[k], child, problems)
+		}
+	}
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeAllowed(types []string, actual string, value any) bool {
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "integer" && actual == "number" {
+			if f, ok := schemaNumber(value); ok && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func containsJSONValue(values []any, value any) bool {
+	for _, v := range values {
+		if jsonEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEqual 比较两个 JSON 值，数字按数值比较
+func jsonEqual(a, b any) bool {
+	if fa, ok := schemaNumber(a); ok {
+		fb, ok := schemaNumber(b)
+		return ok && fa == fb
+	}
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && bytes.Equal(ab, bb)
+}
+
+func formatEnum(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		parts[i] = string(b)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestNewToolPassesContext(t *testing.T) {
+	type input struct {
+		Name string `json:"name" jsonschema:"required"`
+	}
+	tool := NewTool("echo", "echo", func(ctx context.Context, in input) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		v, _ := ctx.Value(ctxKey{}).(string)
+		return v + ":" + in.Name, nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "session")
+	result, err := tool.Call(ctx, json.RawMessage(`{"name":"x"}`))
+	if err != nil || result.Text != "session:x" {
+		t.Fatalf("Call = %q, %v, want %q", result.Text, err, "session:x")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := tool.Call(cancelled, json.RawMessage(`{"name":"x"}`)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Call with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestExecuteToolPassesSessionID(t *testing.T) {
+	tool := NewTool("whoami", "whoami", func(ctx context.Context, _ struct{}) (string, error) {
+		id, ok := SessionIDFromContext(ctx)
+		if !ok {
+			return "", errors.New("no session in context")
+		}
+		return id, nil
+	})
+	a := New(Options{Endpoint: "http://127.0.0.1:0", Tools: []ToolDefinition{tool}})
+	s := a.NewSession()
+	msg, _, _ := s.executeTool(context.Background(), OpenAIChatCompletionToolCall{
+		ID: "call_1", Type: "function", Function: OpenAIChatCompletionFunctionCall{Name: "whoami", Arguments: "{}"},
+	})
+	if msg.Content != s.ID {
+		t.Fatalf("tool saw session %q, want %q", msg.Content, s.ID)
+	}
+	if _, ok := SessionIDFromContext(context.Background()); ok {
+		t.Fatal("a plain context must not carry a session ID")
+	}
+}
+
+const validateSchemaJSON = `{
+	"type": "object",
+	"properties": {
+		"path": {"type": "string", "minLength": 1},
+		"mode": {"type": "string", "enum": ["fast", "slow"]},
+		"count": {"type": "integer", "minimum": 1, "maximum": 10},
+		"edits": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"properties": {
+					"line": {"type": "integer"},
+					"tags": {"type": "array", "items": {"type": "string"}}
+				},
+				"required": ["line"],
+				"additionalProperties": false
+			}
+		},
+		"meta": {"type": "object", "additionalProperties": {"type": "string"}}
+	},
+	"required": ["path"],
+	"additionalProperties": false
+}`
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(validateSchemaJSON), &schema); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  []string // SchemaProblem.String()，按出现顺序
+	}{
+		{"valid", `{"path":"a.go","mode":"fast","count":3,"edits":[{"line":1,"tags":["x"]}],"meta":{"k":"v"}}`, nil},
+		{"wrong top-level type", `["a.go"]`, []string{"$: expected object, got array"}},
+		{"missing required", `{}`, []string{"$.path: missing required property"}},
+		{"wrong property type", `{"path":3}`, []string{"$.path: expected string, got number"}},
+		{"empty string", `{"path":""}`, []string{"$.path: must not be empty"}},
+		{"enum", `{"path":"a","mode":"medium"}`, []string{`$.mode: must be one of ["fast", "slow"]`}},
+		{"integer", `{"path":"a","count":1.5}`, []string{"$.count: expected integer, got number"}},
+		{"range", `{"path":"a","count":11}`, []string{"$.count: must be <= 10"}},
+		{"unknown property", `{"path":"a","force":true}`, []string{"$.force: unknown property (allowed: count, edits, meta, mode, path)"}},
+		{"additionalProperties schema", `{"path":"a","meta":{"k":1}}`, []string{"$.meta.k: expected string, got number"}},
+		{"empty array", `{"path":"a","edits":[]}`, []string{"$.edits: must contain at least 1 items"}},
+		{"nested object in array", `{"path":"a","edits":[{"line":1},{"tags":["x"],"extra":1}]}`, []string{
+			"$.edits[1].line: missing required property",
+			"$.edits[1].extra: unknown property (allowed: line, tags)",
+		}},
+		{"nested array", `{"path":"a","edits":[{"line":1,"tags":["x",2]}]}`, []string{"$.edits[0].tags[1]: expected string, got number"}},
+		{"several problems", `{"mode":"x","count":0}`, []string{
+			"$.path: missing required property",
+			"$.count: must be >= 1",
+			`$.mode: must be one of ["fast", "slow"]`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := decodeJSONValue(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range ValidateSchema(schema, value) {
+				got = append(got, p.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolInputErrorFormat(t *testing.T) {
+	type input struct {
+		Path  string `json:"path" jsonschema:"required,minLength=1"`
+		Count int    `json:"count,omitempty"`
+	}
+	tool := NewTool("edit", "edit", func(ctx context.Context, in input) (string, error) { return "ok", nil })
+	_, err := tool.Call(context.Background(), json.RawMessage(`{"path":"","count":"x"}`))
+	var inputErr *ToolInputError
+	if !errors.As(err, &inputErr) {
+		t.Fatalf("expected a ToolInputError, got %v", err)
+	}
+	if inputErr.Tool != "edit" || len(inputErr.Problems) != 2 {
+		t.Fatalf("error = %+v", inputErr)
+	}
+	want := "invalid arguments for edit:\n" +
+		"  - $.count: expected integer, got string\n" +
+		"  - $.path: must not be empty\n" +
+		"Expected arguments schema: "
+	if msg := err.Error(); !strings.HasPrefix(msg, want) {
+		t.Fatalf("error =\n%s\nwant prefix\n%s", msg, want)
+	}
+	schema := strings.TrimPrefix(err.Error(), want)
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(schema), &decoded); err != nil {
+		t.Fatalf("schema in the error is not JSON: %v\n%s", err, schema)
+	}
+	if _, ok := decoded["$schema"]; ok {
+		t.Errorf("the schema sent to the model must not include $schema: %s", schema)
+	}
+}
@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type OpenAIChatCompletionFunctionDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"` // Use map[string]any to represent JSON schema object
+	Strict      bool           `json:"strict,omitempty"`
+}
+
+type OpenAIChatCompletionTool struct {
+	Type     string                                 `json:"type"` // Always "function" for now
+	Function OpenAIChatCompletionFunctionDefinition `json:"function"`
+}
+
+// OpenAIChatCompletionRequest 对应 POST /v1/chat/completions 的请求体。
+// 0 有意义的采样参数（temperature、penalty、seed 等）使用指针，nil 表示不发送、由服务端取默认值。
+type OpenAIChatCompletionRequest struct {
+	Model               string                        `json:"model"`
+	Messages            []OpenAIChatCompletionMessage `json:"messages"`
+	ToolChoice          any                           `json:"tool_choice,omitempty"` // "auto" or specific tool
+	MaxTokens           int                           `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                           `json:"max_completion_tokens,omitempty"` // o 系列模型使用，包含推理 token
+	Temperature         *float32                      `json:"temperature,omitempty"`
+	TopP                *float32                      `json:"top_p,omitempty"`
+	N                   int                           `json:"n,omitempty"`
+	Stop                []string                      `json:"stop,omitempty"`
+	Seed                *int                          `json:"seed,omitempty"`
+	PresencePenalty     *float32                      `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float32                      `json:"frequency_penalty,omitempty"`
+	ResponseFormat      *OpenAIResponseFormat         `json:"response_format,omitempty"`
+	ParallelToolCalls   *bool                         `json:"parallel_tool_calls,omitempty"`
+	Logprobs            bool                          `json:"logprobs,omitempty"`
+	TopLogprobs         *int                          `json:"top_logprobs,omitempty"`
+	User                string                        `json:"user,omitempty"`
+	ReasoningEffort     string                        `json:"reasoning_effort,omitempty"` // low, medium, high
+	Tools               []OpenAIChatCompletionTool    `json:"tools,omitempty"`
+}
+
+// OpenAIResponseFormat 约束回复格式：text、json_object 或 json_schema
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      bool           `json:"strict,omitempty"`
+}
+
+type OpenAIChatCompletionMessage struct {
+	Role       string                         `json:"role"`                   // "system", "developer", "user", "assistant", "tool"
+	Content    string                         `json:"content,omitempty"`      // For text content or tool result
+	Refusal    string                         `json:"refusal,omitempty"`      // 模型拒绝回答时的说明
+	ToolCalls  []OpenAIChatCompletionToolCall `json:"tool_calls,omitempty"`   // For assistant requesting tools
+	ToolCallID string                         `json:"tool_call_id,omitempty"` // For tool role messages
+	Name       string                         `json:"name,omitempty"`         // For tool role messages (function name) - Optional by OpenAI spec but sometimes useful
+
+	// Parts 附加在 Content 之后，例如用户 @ 引用的文件、图片与音频。
+	// 线上的 content 既可以是字符串也可以是内容数组：
+	//   - 发送时 Parts 只含文本则与 Content 合并为字符串，否则以数组发送（Content 为第一个文本部分）
+	//   - 接收数组时第一个文本部分放入 Content，其余放入 Parts
+	Parts []OpenAIContentPart `json:"-"`
+}
+
+// OpenAIContentPart 是多模态消息内容的一部分
+type OpenAIContentPart struct {
+	Type       string            `json:"type"` // "text", "image_url" or "input_audio"
+	Text       string            `json:"text,omitempty"`
+	ImageURL   *OpenAIImageURL   `json:"image_url,omitempty"`
+	InputAudio *OpenAIInputAudio `json:"input_audio,omitempty"`
+}
+
+type OpenAIImageURL struct {
+	URL    string `json:"url"`              // http(s) URL 或 data:image/png;base64,...
+	Detail string `json:"detail,omitempty"` // auto, low, high
+}
+
+type OpenAIInputAudio struct {
+	Data   string `json:"data"`   // base64
+	Format string `json:"format"` // wav, mp3
+}
+
+// TextPart 返回文本内容
+func TextPart(text string) OpenAIContentPart {
+	return OpenAIContentPart{Type: "text", Text: text}
+}
+
+// ImagePart 返回图片内容，url 可以是 data URL
+func ImagePart(url string) OpenAIContentPart {
+	return OpenAIContentPart{Type: "image_url", ImageURL: &OpenAIImageURL{URL: url}}
+}
+
+// AudioPart 返回音频内容，format 为 wav 或 mp3
+func AudioPart(data []byte, format string) OpenAIContentPart {
+	return OpenAIContentPart{Type: "input_audio", InputAudio: &OpenAIInputAudio{Data: base64.StdEncoding.EncodeToString(data), Format: format}}
+}
+
+// Text 返回消息中的全部文本
+func (m OpenAIChatCompletionMessage) Text() string {
+	var texts []string
+	if m.Content != "" {
+		texts = append(texts, m.Content)
+	}
+	for _, p := range m.Parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func (m OpenAIChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	type plain OpenAIChatCompletionMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	var content any = m.Text()
+	for _, p := range m.Parts {
+		if p.Type != "text" {
+			parts := m.Parts
+			if m.Content != "" {
+				parts = append([]OpenAIContentPart{TextPart(m.Content)}, parts...)
+			}
+			content = parts
+			break
+		}
+	}
+	return json.Marshal(struct {
+		plain
+		Content any `json:"content"`
+	}{plain(m), content})
+}
+
+func (m *OpenAIChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	type plain OpenAIChatCompletionMessage
+	raw := struct {
+		*plain
+		Content json.RawMessage `json:"content"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Content, m.Parts = "", nil
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || string(content) == "null":
+		return nil
+	case content[0] == '"':
+		return json.Unmarshal(content, &m.Content)
+	}
+	var parts []OpenAIContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("message content must be a string or an array of content parts: %w", err)
+	}
+	if len(parts) > 0 && parts[0].Type == "text" {
+		m.Content, parts = parts[0].Text, parts[1:]
+	}
+	if len(parts) > 0 {
+		m.Parts = parts
+	}
+	return nil
+}
+
+type OpenAIChatCompletionToolCall struct {
+	ID       string                           `json:"id"`   // ID to match with tool response
+	Type     string                           `json:"type"` // Always "function"
+	Function OpenAIChatCompletionFunctionCall `json:"function"`
+}
+
+type OpenAIChatCompletionFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // Arguments are a *string* containing JSON
+}
+
+type OpenAIChatCompletionResponse struct {
+	ID                string                       `json:"id"`
+	Object            string                       `json:"object"`
+	Created           int64                        `json:"created"`
+	Model             string                       `json:"model"`
+	SystemFingerprint string                       `json:"system_fingerprint,omitempty"`
+	Choices           []OpenAIChatCompletionChoice `json:"choices"`
+	Usage             *OpenAIUsage                 `json:"usage,omitempty"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens            int                            `json:"prompt_tokens"`
+	CompletionTokens        int                            `json:"completion_tokens"`
+	TotalTokens             int                            `json:"total_tokens"`
+	PromptTokensDetails     *OpenAIPromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *OpenAICompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type OpenAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type OpenAICompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+type OpenAIChatCompletionChoice struct {
+	Index        int                         `json:"index"`
+	Message      OpenAIChatCompletionMessage `json:"message"`
+	FinishReason string                      `json:"finish_reason"`
+	Logprobs     *OpenAIChoiceLogprobs       `json:"logprobs,omitempty"`
+}
+
+type OpenAIChoiceLogprobs struct {
+	Content []OpenAITokenLogprob `json:"content"`
+	Refusal []OpenAITokenLogprob `json:"refusal,omitempty"`
+}
+
+type OpenAITokenLogprob struct {
+	Token       string               `json:"token"`
+	Logprob     float64              `json:"logprob"`
+	Bytes       []int                `json:"bytes,omitempty"`
+	TopLogprobs []OpenAITokenLogprob `json:"top_logprobs,omitempty"`
+}
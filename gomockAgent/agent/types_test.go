@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata 中的请求与响应样例反序列化后再序列化，应当与原文语义相同（null 与缺省视为相同）
+func TestOpenAIWireRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no samples found: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v any
+			if strings.HasPrefix(filepath.Base(file), "request_") {
+				v = &OpenAIChatCompletionRequest{}
+			} else {
+				v = &OpenAIChatCompletionResponse{}
+			}
+			if err := json.Unmarshal(data, v); err != nil {
+				t.Fatal(err)
+			}
+			out, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, got any
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dropNulls(want), dropNulls(got)) {
+				t.Fatalf("round trip changed the payload\nwant: %s\ngot:  %s", data, out)
+			}
+		})
+	}
+}
+
+func readSample[T any](t *testing.T, name string) T {
+	t.Helper()
+	var v T
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestOpenAIWireFields(t *testing.T) {
+	t.Run("reasoning request", func(t *testing.T) {
+		req := readSample[OpenAIChatCompletionRequest](t, "request_reasoning.json")
+		if req.MaxCompletionTokens != 4096 || req.MaxTokens != 0 {
+			t.Errorf("max_completion_tokens = %d, max_tokens = %d", req.MaxCompletionTokens, req.MaxTokens)
+		}
+		if req.ReasoningEffort != "high" {
+			t.Errorf("reasoning_effort = %q", req.ReasoningEffort)
+		}
+		rf := req.ResponseFormat
+		if rf == nil || rf.Type != "json_schema" || rf.JSONSchema == nil || !rf.JSONSchema.Strict || rf.JSONSchema.Name != "answer" {
+			t.Errorf("response_format = %+v", rf)
+		}
+		if req.Seed == nil || *req.Seed != 0 {
+			t.Errorf("seed 0 must be kept, got %v", req.Seed)
+		}
+		if req.ParallelToolCalls == nil || *req.ParallelToolCalls {
+			t.Errorf("parallel_tool_calls = %v", req.ParallelToolCalls)
+		}
+		user := req.Messages[1]
+		if user.Content != "What does this screenshot show?" || len(user.Parts) != 1 || user.Parts[0].ImageURL.Detail != "low" {
+			t.Errorf("user message = %+v", user)
+		}
+		if len(req.Tools) != 1 || !req.Tools[0].Function.Strict {
+			t.Errorf("tools = %+v", req.Tools)
+		}
+	})
+
+	t.Run("sampling request", func(t *testing.T) {
+		req := readSample[OpenAIChatCompletionRequest](t, "request_sampling.json")
+		if req.Temperature == nil || *req.Temperature != 0 || req.PresencePenalty == nil || *req.PresencePenalty != 0 {
+			t.Errorf("zero temperature and presence_penalty must be kept: %v %v", req.Temperature, req.PresencePenalty)
+		}
+		if req.TopLogprobs == nil || *req.TopLogprobs != 0 || !req.Logprobs {
+			t.Errorf("logprobs = %v, top_logprobs = %v", req.Logprobs, req.TopLogprobs)
+		}
+		if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" || req.ResponseFormat.JSONSchema != nil {
+			t.Errorf("response_format = %+v", req.ResponseFormat)
+		}
+		if calls := req.Messages[2].ToolCalls; len(calls) != 1 || calls[0].Function.Arguments != `{"path":"."}` {
+			t.Errorf("tool calls = %+v", calls)
+		}
+		if audio := req.Messages[4].Parts; len(audio) != 1 || audio[0].InputAudio == nil || audio[0].InputAudio.Format != "wav" {
+			t.Errorf("audio parts = %+v", audio)
+		}
+	})
+
+	t.Run("tool call response", func(t *testing.T) {
+		resp := readSample[OpenAIChatCompletionResponse](t, "response_tool_calls.json")
+		u := resp.Usage
+		if u == nil || u.TotalTokens != 1540 || u.PromptTokensDetails == nil || u.PromptTokensDetails.CachedTokens != 1024 ||
+			u.CompletionTokensDetails == nil || u.CompletionTokensDetails.ReasoningTokens != 256 {
+			t.Errorf("usage = %+v", u)
+		}
+		choice := resp.Choices[0]
+		if choice.FinishReason != "tool_calls" || choice.Message.Content != "" || len(choice.Message.ToolCalls) != 2 {
+			t.Errorf("choice = %+v", choice)
+		}
+	})
+
+	t.Run("refusal response", func(t *testing.T) {
+		resp := readSample[OpenAIChatCompletionResponse](t, "response_refusal.json")
+		choice := resp.Choices[0]
+		if choice.Message.Refusal != "I'm sorry, I can't help with that." || choice.Message.Content != "" {
+			t.Errorf("message = %+v", choice.Message)
+		}
+		if choice.Logprobs == nil || len(choice.Logprobs.Refusal) != 1 || len(choice.Logprobs.Refusal[0].TopLogprobs) != 1 {
+			t.Errorf("logprobs = %+v", choice.Logprobs)
+		}
+	})
+}
+
+func TestMessageText(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  OpenAIChatCompletionMessage
+		want string
+	}{
+		{"content only", OpenAIChatCompletionMessage{Content: "hi"}, "hi"},
+		{"empty", OpenAIChatCompletionMessage{}, ""},
+		{"content and parts", OpenAIChatCompletionMessage{Content: "a", Parts: []OpenAIContentPart{TextPart("b"), ImagePart("http://x/y.png"), TextPart("c")}}, "a\n\nb\n\nc"},
+		{"parts without content", OpenAIChatCompletionMessage{Parts: []OpenAIContentPart{TextPart("b"), TextPart("c")}}, "b\n\nc"},
+		{"image only", OpenAIChatCompletionMessage{Parts: []OpenAIContentPart{ImagePart("http://x/y.png")}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.Text(); got != tt.want {
+				t.Fatalf("Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// -------------------------- token 用量与费用 --------------------------
+// 每次 API 调用的 usage 都会记录下来，并汇总到当前轮（一次用户输入及其工具循环）和整个会话。
+// 费用按模型价格表计算，价格单位为美元 / 百万 token，可在配置文件的 pricing 中覆盖。
+
+// ModelPrice 是某个模型的单价（USD / 1M tokens）
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cached_input,omitempty"` // 为 0 时按 Input 计费
+	Output      float64 `json:"output"`
+}
+
+// defaultModelPrices 按模型名前缀匹配，最长前缀优先
+var defaultModelPrices = map[string]ModelPrice{
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+	"gpt-4o":        {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":   {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"gpt-4.1":       {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini":  {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano":  {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"o3-mini":       {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o4-mini":       {Input: 1.10, CachedInput: 0.275, Output: 4.40},
+}
+
+// BudgetConfig 限制会话的总用量，超出后停止工具循环；0 表示不限制
+type BudgetConfig struct {
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+	MaxTokens  int     `json:"max_tokens,omitempty"`
+}
+
+// TokenUsage 是若干次调用的累计用量
+type TokenUsage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd"`
+	Unpriced         bool    `json:"unpriced,omitempty"` // 有调用的模型不在价格表中
+}
+
+func (u TokenUsage) TotalTokens() int { return u.PromptTokens + u.CompletionTokens }
+
+func (u *TokenUsage) Add(o TokenUsage) {
+	u.Calls += o.Calls
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CachedTokens += o.CachedTokens
+	u.ReasoningTokens += o.ReasoningTokens
+	u.CostUSD += o.CostUSD
+	u.Unpriced = u.Unpriced || o.Unpriced
+}
+
+func (u TokenUsage) String() string {
+	s := fmt.Sprintf("%d prompt (%d cached) + %d completion = %d tokens, $%.4f",
+		u.PromptTokens, u.CachedTokens, u.CompletionTokens, u.TotalTokens(), u.CostUSD)
+	if u.Unpriced {
+		s += " (some calls unpriced)"
+	}
+	return s
+}
+
+// TurnUsage 是一轮对话的用量，Calls 按工具循环中的调用顺序排列
+type TurnUsage struct {
+	Turn   int          `json:"turn"`
+	Calls  []TokenUsage `json:"calls"`
+	Total  TokenUsage   `json:"total"`
+	Prompt string       `json:"prompt,omitempty"`
+}
+
+// UsageTracker 记录会话的 token 用量
+type UsageTracker struct {
+	mu      sync.Mutex
+	prices  map[string]ModelPrice
+	budget  BudgetConfig
+	turns   []*TurnUsage
+	session TokenUsage
+}
+
+func NewUsageTracker(prices map[string]ModelPrice, budget BudgetConfig) *UsageTracker {
+	merged := make(map[string]ModelPrice, len(defaultModelPrices)+len(prices))
+	for k, v := range defaultModelPrices {
+		merged[k] = v
+	}
+	for k, v := range prices {
+		merged[k] = v
+	}
+	return &UsageTracker{prices: merged, budget: budget}
+}
+
+// BeginTurn 开始新的一轮，之后的调用都计入该轮
+func (t *UsageTracker) BeginTurn(prompt string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turns = append(t.turns, &TurnUsage{Turn: len(t.turns) + 1, Prompt: prompt})
+}
+
+// Record 记录一次 API 调用的 usage，返回本次调用的用量
+func (t *UsageTracker) Record(model string, usage *OpenAIUsage) TokenUsage {
+	call := TokenUsage{Calls: 1}
+	if usage != nil {
+		call.PromptTokens = usage.PromptTokens
+		call.CompletionTokens = usage.CompletionTokens
+		if d := usage.PromptTokensDetails; d != nil {
+			call.CachedTokens = d.CachedTokens
+		}
+		if d := usage.CompletionTokensDetails; d != nil {
+			call.ReasoningTokens = d.ReasoningTokens
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if price, ok := t.priceFor(model); ok {
+		call.CostUSD = price.Cost(call)
+	} else if call.TotalTokens() > 0 {
+		call.Unpriced = true
+	}
+	if len(t.turns) == 0 {
+		t.turns = append(t.turns, &TurnUsage{Turn: 1}) // 例如 commit 子命令这类没有对话轮次的调用
+	}
+	turn := t.turns[len(t.turns)-1]
+	turn.Calls = append(turn.Calls, call)
+	turn.Total.Add(call)
+	t.session.Add(call)
+	return call
+}
+
+// priceFor 先精确匹配模型名，再按最长前缀匹配（例如 gpt-4o-2024-08-06 → gpt-4o）
+func (t *UsageTracker) priceFor(model string) (ModelPrice, bool) {
+	if p, ok := t.prices[model]; ok {
+		return p, true
+	}
+	best := ""
+	for name := range t.prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return t.prices[best], true
+}
+
+// Cost 计算一次调用的费用
+func (p ModelPrice) Cost(u TokenUsage) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	uncached := u.PromptTokens - u.CachedTokens
+	return (float64(uncached)*p.Input + float64(u.CachedTokens)*cachedPrice + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// Session 返回会话累计用量
+func (t *UsageTracker) Session() TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// LastTurn 返回最近一轮的用量
+func (t *UsageTracker) LastTurn() (TurnUsage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.turns) == 0 {
+		return TurnUsage{}, false
+	}
+	turn := *t.turns[len(t.turns)-1]
+	turn.Calls = append([]TokenUsage(nil), turn.Calls...)
+	return turn, true
+}
+
+// Budget 返回当前预算
+func (t *UsageTracker) Budget() BudgetConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budget
+}
+
+// SetBudget 修改预算，例如在 REPL 中用 /budget 提高上限
+func (t *UsageTracker) SetBudget(b BudgetConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.budget = b
+}
+
+// BudgetExceeded 在会话用量达到预算时返回原因
+func (t *UsageTracker) BudgetExceeded() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.budget.MaxCostUSD > 0 && t.session.CostUSD >= t.budget.MaxCostUSD {
+		return fmt.Sprintf("session cost $%.4f reached the budget of $%.4f", t.session.CostUSD, t.budget.MaxCostUSD), true
+	}
+	if t.budget.MaxTokens > 0 && t.session.TotalTokens() >= t.budget.MaxTokens {
+		return fmt.Sprintf("session used %d tokens, budget is %d", t.session.TotalTokens(), t.budget.MaxTokens), true
+	}
+	return "", false
+}
+
+// UsageReport 是 /usage json 输出的结构
+type UsageReport struct {
+	Session TokenUsage   `json:"session"`
+	Budget  BudgetConfig `json:"budget"`
+	Turns   []TurnUsage  `json:"turns"`
+}
+
+func (t *UsageTracker) Report() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := UsageReport{Session: t.session, Budget: t.budget, Turns: make([]TurnUsage, 0, len(t.turns))}
+	for _, turn := range t.turns {
+		c := *turn
+		c.Calls = append([]TokenUsage(nil), turn.Calls...)
+		report.Turns = append(report.Turns, c)
+	}
+	return report
+}
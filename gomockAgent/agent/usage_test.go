@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func usage(prompt, cached, completion int) *OpenAIUsage {
+	return &OpenAIUsage{
+		PromptTokens:        prompt,
+		CompletionTokens:    completion,
+		TotalTokens:         prompt + completion,
+		PromptTokensDetails: &OpenAIPromptTokensDetails{CachedTokens: cached},
+	}
+}
+
+func TestUsageTrackerPrices(t *testing.T) {
+	tracker := NewUsageTracker(map[string]ModelPrice{"local-model": {Input: 1, Output: 2}}, BudgetConfig{})
+	tests := []struct {
+		name     string
+		model    string
+		want     float64
+		unpriced bool
+	}{
+		// gpt-4o：1M 未缓存输入 $2.50，1M 缓存输入 $1.25，1M 输出 $10
+		{"exact match", "gpt-4o", (1e6*2.50 + 1e6*1.25 + 1e6*10) / 1e6, false},
+		{"dated model uses the prefix", "gpt-4o-2024-08-06", (1e6*2.50 + 1e6*1.25 + 1e6*10) / 1e6, false},
+		{"longest prefix wins", "gpt-4o-mini-2024-07-18", (1e6*0.15 + 1e6*0.075 + 1e6*0.60) / 1e6, false},
+		{"configured price, cached input billed as input", "local-model", (2e6*1 + 1e6*2) / 1e6, false},
+		{"unknown model", "mystery-1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := tracker.Record(tt.model, usage(2_000_000, 1_000_000, 1_000_000))
+			if math.Abs(call.CostUSD-tt.want) > 1e-9 || call.Unpriced != tt.unpriced {
+				t.Fatalf("cost = %v, unpriced = %v, want %v, %v", call.CostUSD, call.Unpriced, tt.want, tt.unpriced)
+			}
+		})
+	}
+	if !tracker.Session().Unpriced {
+		t.Error("the session total must be marked unpriced after an unpriced call")
+	}
+	if !strings.Contains(tracker.Session().String(), "some calls unpriced") {
+		t.Errorf("String() = %q", tracker.Session().String())
+	}
+
+	// 没有 token 的调用不算未定价
+	if call := NewUsageTracker(nil, BudgetConfig{}).Record("mystery-1", nil); call.Unpriced || call.Calls != 1 {
+		t.Errorf("empty usage = %+v", call)
+	}
+}
+
+func TestUsageTrackerTotals(t *testing.T) {
+	tracker := NewUsageTracker(nil, BudgetConfig{})
+	if _, ok := tracker.LastTurn(); ok {
+		t.Fatal("a new tracker has no turns")
+	}
+
+	tracker.BeginTurn("first")
+	tracker.Record("gpt-4o", usage(100, 0, 10))
+	tracker.Record("gpt-4o", usage(200, 50, 20))
+	tracker.BeginTurn("second")
+	tracker.Record("gpt-4o", usage(300, 100, 30))
+	tracker.Record("gpt-4o", &OpenAIUsage{PromptTokens: 400, CompletionTokens: 40, CompletionTokensDetails: &OpenAICompletionTokensDetails{ReasoningTokens: 25}})
+	tracker.Record("gpt-4o", nil)
+
+	turn, ok := tracker.LastTurn()
+	if !ok || turn.Turn != 2 || turn.Prompt != "second" || len(turn.Calls) != 3 {
+		t.Fatalf("last turn = %+v", turn)
+	}
+	wantTurn := TokenUsage{Calls: 3, PromptTokens: 700, CompletionTokens: 70, CachedTokens: 100, ReasoningTokens: 25}
+	wantTurn.CostUSD = turn.Total.CostUSD
+	if turn.Total != wantTurn {
+		t.Errorf("turn total = %+v, want %+v", turn.Total, wantTurn)
+	}
+
+	session := tracker.Session()
+	if session.Calls != 5 || session.PromptTokens != 1000 || session.CompletionTokens != 100 || session.CachedTokens != 150 || session.TotalTokens() != 1100 {
+		t.Errorf("session total = %+v", session)
+	}
+	// 会话费用等于各轮之和
+	report := tracker.Report()
+	var sum float64
+	for _, tu := range report.Turns {
+		sum += tu.Total.CostUSD
+	}
+	if len(report.Turns) != 2 || math.Abs(sum-session.CostUSD) > 1e-12 {
+		t.Errorf("turn costs add up to %v, session cost %v", sum, session.CostUSD)
+	}
+
+	// LastTurn 返回副本
+	turn.Calls[0].PromptTokens = -1
+	if again, _ := tracker.LastTurn(); again.Calls[0].PromptTokens != 300 {
+		t.Error("LastTurn must return a copy")
+	}
+}
+
+func TestUsageTrackerBudget(t *testing.T) {
+	tracker := NewUsageTracker(nil, BudgetConfig{MaxTokens: 1000})
+	tracker.Record("gpt-4o", usage(900, 0, 99))
+	if reason, exceeded := tracker.BudgetExceeded(); exceeded {
+		t.Fatalf("999 tokens must be within the budget: %s", reason)
+	}
+	tracker.Record("gpt-4o", usage(1, 0, 0))
+	if reason, exceeded := tracker.BudgetExceeded(); !exceeded || reason != "session used 1000 tokens, budget is 1000" {
+		t.Fatalf("BudgetExceeded = %q, %v", reason, exceeded)
+	}
+
+	tracker.SetBudget(BudgetConfig{MaxCostUSD: 0.001})
+	if reason, exceeded := tracker.BudgetExceeded(); !exceeded || !strings.Contains(reason, "reached the budget of $0.0010") {
+		t.Fatalf("BudgetExceeded = %q, %v", reason, exceeded)
+	}
+}
+
+// 预算在工具循环中途用完：已发出的调用计入用量，下一次请求不再发送
+func TestBudgetExceededMidTurn(t *testing.T) {
+	endpoint, srv := newFakeEndpoint(t,
+		toolCallChoice(`{"path":"a.go"}`, "tool_calls"),
+		textChoice("never sent", "stop"),
+	)
+	a := New(Options{Endpoint: srv.URL, Model: "gpt-4o", Budget: BudgetConfig{MaxTokens: 15}})
+	s := a.NewSession()
+
+	_, err := s.Send(context.Background(), "read a.go")
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) || !strings.Contains(budgetErr.Reason, "15 tokens") {
+		t.Fatalf("Send error = %v, want a BudgetExceededError", err)
+	}
+	if n := len(endpoint.requests); n != 1 {
+		t.Fatalf("%d requests sent, want 1", n)
+	}
+	turn, _ := s.Usage().LastTurn()
+	if turn.Turn != 1 || len(turn.Calls) != 1 || turn.Total.TotalTokens() != 15 {
+		t.Fatalf("last turn = %+v", turn)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- checkpoints --------------------------
+// 工具修改文件之前先保存快照，按对话轮次分组，用于 /undo 与 /rewind。
+// 快照保存在内存中，不依赖 git，因此在非 git 目录下同样可用。
+
+type fileSnapshot struct {
+	existed bool
+	content []byte
+	mode    fs.FileMode
+}
+
+// TurnCheckpoint 记录一轮对话中被修改文件的初始状态
+type TurnCheckpoint struct {
+	Turn   int
+	Prompt string
+	files  map[string]fileSnapshot
+	order  []string
+}
+
+// Files 返回本轮修改过的文件（按首次修改顺序）
+func (t *TurnCheckpoint) Files() []string {
+	return append([]string(nil), t.order...)
+}
+
+type CheckpointStore struct {
+	mu    sync.Mutex
+	turns []*TurnCheckpoint
+	next  int
+}
+
+func NewCheckpointStore() *CheckpointStore {
+	return &CheckpointStore{next: 1}
+}
+
+// checkpointStores 按会话 ID 保存快照，serve 中的多个会话互不影响，/undo 只撤销本会话的轮次
+type checkpointStores struct {
+	mu     sync.Mutex
+	stores map[string]*CheckpointStore
+}
+
+// fileCheckpoints 是所有会话的快照存储，工具通过 writeFileWithCheckpoint 写文件
+var fileCheckpoints = &checkpointStores{stores: map[string]*CheckpointStore{}}
+
+// Session 返回会话的快照存储，不存在时创建
+func (c *checkpointStores) Session(id string) *CheckpointStore {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	store, ok := c.stores[id]
+	if !ok {
+		store = NewCheckpointStore()
+		c.stores[id] = store
+	}
+	return store
+}
+
+// Remove 丢弃会话的快照，在会话删除时调用
+func (c *checkpointStores) Remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.stores, id)
+}
+
+// snapshot 在发起工具调用的会话中快照 path；不在会话中（例如直接调用工具）时不做记录
+func (c *checkpointStores) snapshot(ctx context.Context, path string) error {
+	id, ok := agent.SessionIDFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return c.Session(id).Snapshot(path)
+}
+
+// BeginTurn 开始新的一轮，返回轮次编号
+func (s *CheckpointStore) BeginTurn(prompt string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	turn := s.next
+	s.next++
+	s.turns = append(s.turns, &TurnCheckpoint{Turn: turn, Prompt: prompt, files: map[string]fileSnapshot{}})
+	return turn
+}
+
+// Snapshot 在本轮首次修改 path 前保存其内容；同一轮内重复调用只保留最早的状态
+func (s *CheckpointStore) Snapshot(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s': %w", path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.turns) == 0 {
+		return nil // 非交互模式下没有轮次，不做记录
+	}
+	current := s.turns[len(s.turns)-1]
+	if _, ok := current.files[abs]; ok {
+		return nil
+	}
+
+	snap := fileSnapshot{}
+	info, err := os.Stat(abs)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to stat '%s': %w", path, err)
+	default:
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("error reading file '%s': %w", path, err)
+		}
+		snap = fileSnapshot{existed: true, content: content, mode: info.Mode().Perm()}
+	}
+	current.files[abs] = snap
+	current.order = append(current.order, abs)
+	return nil
+}
+
+// Turns 返回有文件变更的轮次
+func (s *CheckpointStore) Turns() []*TurnCheckpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var turns []*TurnCheckpoint
+	for _, t := range s.turns {
+		if len(t.order) > 0 {
+			turns = append(turns, t)
+		}
+	}
+	return turns
+}
+
+// Undo 撤销最近一次有文件变更的轮次，返回恢复产生的 diff
+func (s *CheckpointStore) Undo() (int, string, error) {
+	turns := s.Turns()
+	if len(turns) == 0 {
+		return 0, "", fmt.Errorf("nothing to undo")
+	}
+	turn := turns[len(turns)-1].Turn
+	diff, err := s.Rewind(turn)
+	return turn, diff, err
+}
+
+// Rewind 把文件恢复到第 turn 轮开始之前的状态，并丢弃该轮及之后的快照
+func (s *CheckpointStore) Rewind(turn int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := sort.Search(len(s.turns), func(i int) bool { return s.turns[i].Turn >= turn })
+	if idx == len(s.turns) || s.turns[idx].Turn != turn {
+		return "", fmt.Errorf("turn %d not found", turn)
+	}
+
+	// 每个文件取最早一次快照，即第 turn 轮之前的状态
+	target := map[string]fileSnapshot{}
+	var order []string
+	for _, t := range s.turns[idx:] {
+		for _, path := range t.order {
+			if _, ok := target[path]; !ok {
+				target[path] = t.files[path]
+				order = append(order, path)
+			}
+		}
+	}
+	sort.Strings(order)
+
+	var diffs []string
+	for _, path := range order {
+		diff, err := restoreSnapshot(path, target[path])
+		if err != nil {
+			return strings.Join(diffs, ""), err
+		}
+		diffs = append(diffs, diff)
+	}
+	s.turns = s.turns[:idx]
+	return strings.Join(diffs, ""), nil
+}
+
+func restoreSnapshot(path string, snap fileSnapshot) (string, error) {
+	current, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading file '%s': %w", path, err)
+	}
+
+	oldName, newName := diffNames(path)
+	if !snap.existed {
+		if !exists {
+			return "", nil
+		}
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("failed to remove '%s': %w", path, err)
+		}
+		return UnifiedDiff(oldName, "/dev/null", string(current), ""), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory for '%s': %w", path, err)
+	}
+	if err := os.WriteFile(path, snap.content, snap.mode); err != nil {
+		return "", fmt.Errorf("error writing file '%s': %w", path, err)
+	}
+	if !exists {
+		oldName = "/dev/null"
+	}
+	return UnifiedDiff(oldName, newName, string(current), string(snap.content)), nil
+}
+
+// diffNames 返回 git 风格的 a/ b/ 文件名，工作目录之外的文件保留绝对路径
+func diffNames(path string) (string, string) {
+	name := displayPath(path)
+	if filepath.IsAbs(name) {
+		return name, name
+	}
+	name = filepath.ToSlash(name)
+	return "a/" + name, "b/" + name
+}
+
+// displayPath 尽量显示相对当前目录的路径
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// writeFileWithCheckpoint 是工具写文件的统一入口：先快照再写入
+func writeFileWithCheckpoint(ctx context.Context, path string, data []byte, perm fs.FileMode) error {
+	if err := fileCheckpoints.snapshot(ctx, path); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// removeFileWithCheckpoint 先快照再删除文件
+func removeFileWithCheckpoint(ctx context.Context, path string) error {
+	if err := fileCheckpoints.snapshot(ctx, path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
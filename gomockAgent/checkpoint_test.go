@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 两个会话交替修改文件，/undo 只撤销本会话的轮次
+func TestCheckpointsAreScopedToSessions(t *testing.T) {
+	dir := t.TempDir()
+	fileA, fileB := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, f := range []string{fileA, fileB} {
+		if err := os.WriteFile(f, []byte("original\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stores := &checkpointStores{stores: map[string]*CheckpointStore{}}
+	edit := func(session, path string) {
+		t.Helper()
+		store := stores.Session(session)
+		store.BeginTurn("edit " + filepath.Base(path))
+		if err := store.Snapshot(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("edited by "+session+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit("a", fileA)
+	edit("b", fileB)
+
+	turn, _, err := stores.Session("a").Undo()
+	if err != nil || turn != 1 {
+		t.Fatalf("Undo = turn %d, %v", turn, err)
+	}
+	if got, _ := os.ReadFile(fileA); string(got) != "original\n" {
+		t.Errorf("a.txt = %q, want it restored", got)
+	}
+	if got, _ := os.ReadFile(fileB); string(got) != "edited by b\n" {
+		t.Errorf("b.txt = %q, session b's change must be kept", got)
+	}
+	if _, _, err := stores.Session("a").Undo(); err == nil {
+		t.Error("session a has nothing left to undo")
+	}
+	if turns := stores.Session("b").Turns(); len(turns) != 1 {
+		t.Errorf("session b has %d turns, want 1", len(turns))
+	}
+
+	stores.Remove("b")
+	if turns := stores.Session("b").Turns(); len(turns) != 0 {
+		t.Errorf("removed session still has %d turns", len(turns))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// -------------------------- 子命令 --------------------------
+// 子命令在这里分发，未匹配时进入交互式 REPL。
+
+// runSubcommand 返回 handled=false 表示 args 不是已知子命令
+func runSubcommand(args []string) (handled bool, err error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "mutate":
+		return true, runMutateCommand(args[1:])
+	case "commit":
+		return true, runCommitCommand(args[1:])
+	case "changelog":
+		return true, runChangelogCommand(args[1:])
+	case "run":
+		return true, runOneShotCommand(args[1:])
+	case "mcp-serve":
+		return true, runMCPServeCommand(args[1:])
+	case "serve":
+		return true, runServeCommand(args[1:])
+	case "prompts":
+		return true, runPromptsCommand(args[1:])
+	}
+	return false, nil
+}
+
+func runMutateCommand(args []string) error {
+	fs := flag.NewFlagSet("mutate", flag.ContinueOnError)
+	maxMutants := fs.Int("max", 0, "maximum number of mutants to evaluate (0 = all)")
+	timeout := fs.Duration("timeout", 60*time.Second, "per-mutant test timeout")
+	asJSON := fs.Bool("json", false, "print the full report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	report, err := RunMutationTesting(context.Background(), dir, MutationOptions{
+		MaxMutants: *maxMutants,
+		Timeout:    *timeout,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Print(FormatMutationReport(report))
+	return nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- commit & changelog --------------------------
+// commit：根据暂存区 diff 让模型生成 Conventional Commits 格式的提交信息，确认或编辑后提交。
+// changelog：把两个 tag 之间的提交整理成按类型分组的 Markdown。
+
+const defaultCommitTemplate = `<type>(<optional scope>): <subject>
+
+<body>
+
+<optional footer>
+
+Rules:
+- type is one of: feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert
+- append "!" after the type/scope for breaking changes
+- subject is imperative, lower case, without a trailing period, at most 72 characters
+- body explains what changed and why, wrapped at 72 columns; omit it for trivial changes
+- footer holds "BREAKING CHANGE: ..." notes and issue references`
+
+const maxCommitDiffBytes = 30000
+
+// askUser 由交互式入口设置，用于工具执行前向用户确认；为 nil 时表示无法交互
+var askUser func(question string) (string, bool)
+
+// runEditor 运行 $EDITOR；全屏界面会替换它，在编辑器运行期间交出终端
+var runEditor = func(cmd *exec.Cmd) error { return cmd.Run() }
+
+// commitTemplate 返回配置的模板，未配置时使用默认模板
+func commitTemplate(cfg CommitConfig) (string, error) {
+	if cfg.TemplateFile != "" {
+		content, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading commit template '%s': %w", cfg.TemplateFile, err)
+		}
+		return string(content), nil
+	}
+	if cfg.Template != "" {
+		return cfg.Template, nil
+	}
+	return defaultCommitTemplate, nil
+}
+
+// stagedChanges 返回暂存区的统计与 diff；没有暂存内容时报错
+func stagedChanges() (string, string, error) {
+	stat, err := runGit("diff", "--cached", "--stat", "--no-color")
+	if err != nil {
+		return "", "", err
+	}
+	if strings.TrimSpace(stat) == "" {
+		return "", "", fmt.Errorf("no staged changes, use 'git add' first")
+	}
+	diff, err := runGit("diff", "--cached", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return "", "", err
+	}
+	return stat, diff, nil
+}
+
+func generateCommitMessage(ctx context.Context, ag *agent.Agent, template string) (string, error) {
+	stat, diff, err := stagedChanges()
+	if err != nil {
+		return "", err
+	}
+	system, err := renderPrompt("commit", map[string]any{"template": template})
+	if err != nil {
+		return "", err
+	}
+	request, err := renderPrompt("commit_request", map[string]any{"stat": stat, "diff": truncateOutput(diff, maxCommitDiffBytes)})
+	if err != nil {
+		return "", err
+	}
+	message, err := ag.Complete(ctx, system.Text, request.Text, exampleMessages(system)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %w", err)
+	}
+	return cleanCommitMessage(message), nil
+}
+
+// cleanCommitMessage 去掉模型偶尔附带的代码块标记与多余空白
+func cleanCommitMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if strings.HasPrefix(message, "```") {
+		message = strings.TrimPrefix(message, "```")
+		if i := strings.IndexByte(message, '\n'); i >= 0 {
+			message = message[i+1:]
+		}
+		message = strings.TrimSuffix(strings.TrimSpace(message), "```")
+	}
+	return strings.TrimSpace(message)
+}
+
+// reviewCommitMessage 展示提交信息并让用户确认、编辑或放弃
+func reviewCommitMessage(message string) (string, bool) {
+	if askUser == nil {
+		return "", false
+	}
+	for {
+		fmt.Printf("\n\u001b[93mCommit message\u001b[0m:\n%s\n\n", message)
+		answer, ok := askUser("Commit with this message? [y]es / [e]dit / [n]o: ")
+		if !ok {
+			return "", false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return message, true
+		case "n", "no":
+			return "", false
+		case "e", "edit":
+			edited, err := editCommitMessage(message)
+			if err != nil {
+				fmt.Printf("\u001b[91mEdit Error\u001b[0m: %s\n", err.Error())
+				continue
+			}
+			message = edited
+		}
+	}
+}
+
+// editCommitMessage 优先使用 $EDITOR，否则逐行读取新的提交信息，以单独一行 "." 结束
+func editCommitMessage(message string) (string, error) {
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		f, err := os.CreateTemp("", "gomockagent-commit-*.txt")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.WriteString(message + "\n"); err != nil {
+			f.Close()
+			return "", fmt.Errorf("failed to write temp file: %w", err)
+		}
+		f.Close()
+		cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := runEditor(cmd); err != nil {
+			return "", fmt.Errorf("editor failed: %w", err)
+		}
+		content, err := os.ReadFile(f.Name())
+		if err != nil {
+			return "", fmt.Errorf("failed to read edited message: %w", err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	fmt.Println("Enter the new commit message, finish with a single '.' line:")
+	var lines []string
+	for {
+		line, ok := askUser("")
+		if !ok || line == "." {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return message, nil
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// createCommit 提交暂存区，返回新提交的简短描述
+func createCommit(message string) (string, error) {
+	f, err := os.CreateTemp("", "gomockagent-commit-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(message + "\n"); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	f.Close()
+	if _, err := runGit("commit", "--quiet", "-F", f.Name()); err != nil {
+		return "", err
+	}
+	summary, err := runGit("log", "-1", "--format=%h %s")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+func runCommitCommand(args []string) error {
+	fs := flag.NewFlagSet("commit", flag.ContinueOnError)
+	yes := fs.Bool("y", false, "commit without asking for confirmation")
+	templateFile := fs.String("template", "", "commit message template file (overrides config)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if *templateFile != "" {
+		config.Commit.TemplateFile = *templateFile
+	}
+	template, err := commitTemplate(config.Commit)
+	if err != nil {
+		return err
+	}
+	if err := checkOpenAIConfig(); err != nil {
+		return err
+	}
+
+	ag, err := NewConfiguredAgent(nil, config)
+	if err != nil {
+		return err
+	}
+	message, err := generateCommitMessage(context.Background(), ag, template)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		readLine := stdinReader()
+		askUser = func(question string) (string, bool) {
+			fmt.Print(question)
+			return readLine()
+		}
+		var ok bool
+		if message, ok = reviewCommitMessage(message); !ok {
+			fmt.Println("Commit aborted.")
+			return nil
+		}
+	}
+	summary, err := createCommit(message)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created commit %s\n", summary)
+	return nil
+}
+
+// -------------------------- git_commit --------------------------
+type GitCommitInput struct {
+	Message string `json:"message" jsonschema_description:"The full commit message following the template in the tool description." jsonschema:"required,minLength=1"`
+}
+
+// NewGitCommitDefinition 把提交模板写进工具描述，让模型按模板撰写提交信息
+func NewGitCommitDefinition(cfg CommitConfig) agent.ToolDefinition {
+	template, err := commitTemplate(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s, using the default commit template\n", err)
+		template = defaultCommitTemplate
+	}
+	return agent.NewTool(
+		"git_commit",
+		"Create a git commit from the currently staged changes. Inspect them first with git_diff (mode 'staged'). "+
+			"The user reviews the message and may edit or reject it. The message must follow this template:\n\n"+template,
+		GitCommitTool,
+	)
+}
+
+func GitCommitTool(ctx context.Context, gitCommitInput GitCommitInput) (string, error) {
+	// 只有代码围栏或空白的消息清理后为空，schema 的 minLength 挡不住
+	message := cleanCommitMessage(gitCommitInput.Message)
+	if message == "" {
+		return "", fmt.Errorf("commit message for git_commit is empty after removing code fences and whitespace")
+	}
+	if _, _, err := stagedChanges(); err != nil {
+		return "", err
+	}
+	if askUser == nil {
+		return "", fmt.Errorf("git_commit requires interactive user approval, which is not available")
+	}
+	message, ok := reviewCommitMessage(message)
+	if !ok {
+		return "The user rejected the commit. Nothing was committed.", nil
+	}
+	summary, err := createCommit(message)
+	if err != nil {
+		return "", err
+	}
+	return "Created commit " + summary, nil
+}
+
+// -------------------------- changelog --------------------------
+
+var conventionalSubjectRe = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// changelogSections 定义 Markdown 中各小节的顺序与标题
+var changelogSections = []struct {
+	types []string
+	title string
+}{
+	{[]string{"feat"}, "Features"},
+	{[]string{"fix"}, "Bug Fixes"},
+	{[]string{"perf"}, "Performance"},
+	{[]string{"refactor"}, "Refactoring"},
+	{[]string{"docs"}, "Documentation"},
+	{[]string{"test", "build", "ci", "chore", "style", "revert"}, "Maintenance"},
+}
+
+type changelogEntry struct {
+	hash     string
+	typ      string
+	scope    string
+	subject  string
+	body     string
+	breaking bool
+}
+
+func collectChangelogEntries(from, to string) ([]changelogEntry, error) {
+	for _, rev := range []string{from, to} {
+		if _, err := runGit("rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("unknown revision %q", rev)
+		}
+	}
+	out, err := runGit("log", "--no-merges", "--format=%x1e%h%x1f%s%x1f%b", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+	var entries []changelogEntry
+	for _, record := range strings.Split(out, "\x1e") {
+		f := strings.SplitN(strings.TrimSpace(record), "\x1f", 3)
+		if len(f) < 2 {
+			continue
+		}
+		e := changelogEntry{hash: f[0], subject: f[1], typ: "other"}
+		if len(f) == 3 {
+			e.body = strings.TrimSpace(f[2])
+		}
+		if m := conventionalSubjectRe.FindStringSubmatch(f[1]); m != nil {
+			e.typ, e.scope, e.breaking, e.subject = strings.ToLower(m[1]), m[2], m[3] == "!", m[4]
+		}
+		if strings.Contains(e.body, "BREAKING CHANGE") {
+			e.breaking = true
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// renderChangelog 按提交类型分组生成 Markdown
+func renderChangelog(title string, entries []changelogEntry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s\n", title)
+	line := func(e changelogEntry) string {
+		if e.scope != "" {
+			return fmt.Sprintf("- **%s:** %s (%s)\n", e.scope, e.subject, e.hash)
+		}
+		return fmt.Sprintf("- %s (%s)\n", e.subject, e.hash)
+	}
+	section := func(name string, match func(changelogEntry) bool) {
+		var lines []string
+		for _, e := range entries {
+			if match(e) {
+				lines = append(lines, line(e))
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&sb, "\n### %s\n\n%s", name, strings.Join(lines, ""))
+		}
+	}
+
+	section("Breaking Changes", func(e changelogEntry) bool { return e.breaking })
+	known := map[string]bool{}
+	for _, s := range changelogSections {
+		types := map[string]bool{}
+		for _, t := range s.types {
+			types[t], known[t] = true, true
+		}
+		section(s.title, func(e changelogEntry) bool { return types[e.typ] })
+	}
+	section("Other Changes", func(e changelogEntry) bool { return !known[e.typ] })
+	return sb.String()
+}
+
+func runChangelogCommand(args []string) error {
+	fs := flag.NewFlagSet("changelog", flag.ContinueOnError)
+	noLLM := fs.Bool("no-llm", false, "only group commits, do not ask the model to summarize them")
+	output := fs.String("o", "", "write the changelog to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("usage: gomockAgent changelog [-no-llm] [-o file] <from-tag> [to-tag]")
+	}
+	from, to := fs.Arg(0), "HEAD"
+	if fs.NArg() == 2 {
+		to = fs.Arg(1)
+	}
+
+	entries, err := collectChangelogEntries(from, to)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no commits between %s and %s", from, to)
+	}
+	changelog := renderChangelog(to, entries)
+
+	// stdout 只输出 changelog，过程信息改写到 stderr
+	changelogOut := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = changelogOut }()
+
+	if !*noLLM {
+		if err := checkOpenAIConfig(); err != nil {
+			return err
+		}
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		ag, err := NewConfiguredAgent(nil, config)
+		if err != nil {
+			return err
+		}
+		var bodies strings.Builder
+		for _, e := range entries {
+			if e.body != "" {
+				fmt.Fprintf(&bodies, "%s %s\n%s\n\n", e.hash, e.subject, e.body)
+			}
+		}
+		system, err := renderPrompt("changelog", nil)
+		if err != nil {
+			return err
+		}
+		userPrompt := changelog
+		if bodies.Len() > 0 {
+			userPrompt += "\n\nCommit message bodies for context:\n\n" + truncateOutput(bodies.String(), maxCommitDiffBytes)
+		}
+		summary, err := ag.Complete(context.Background(), system.Text, userPrompt, exampleMessages(system)...)
+		if err != nil {
+			return fmt.Errorf("failed to summarize changelog: %w", err)
+		}
+		changelog = cleanCommitMessage(summary) + "\n"
+	}
+
+	if *output != "" {
+		return os.WriteFile(*output, []byte(changelog), 0o644)
+	}
+	fmt.Fprint(changelogOut, changelog)
+	return nil
+}
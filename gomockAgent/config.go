@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- 配置文件 --------------------------
+// 环境变量负责连接信息（OPENAI_API_KEY 等），其余可选配置放在 JSON 文件中。
+// 查找顺序：$GOMOCKAGENT_CONFIG、./.gomockagent.json、~/.config/gomockagent/config.json
+
+// Config 存储 gomockAgent 的可选配置
+type Config struct {
+	Commit     CommitConfig               `json:"commit"`
+	MCPServers map[string]MCPServerConfig `json:"mcp_servers,omitempty"`
+	// StrictTools 以 OpenAI strict 模式发送工具定义，模型必须严格按 schema 生成参数
+	StrictTools bool `json:"strict_tools,omitempty"`
+	// Pricing 覆盖或补充内置的模型价格（USD / 1M tokens），key 为模型名或前缀
+	Pricing map[string]agent.ModelPrice `json:"pricing,omitempty"`
+	Budget  agent.BudgetConfig          `json:"budget,omitempty"`
+	// Profile 是默认使用的 profile，可被 $GOMOCKAGENT_PROFILE 覆盖
+	Profile  string                   `json:"profile,omitempty"`
+	Profiles map[string]agent.Profile `json:"profiles,omitempty"`
+	// DisableInstructions 不加载 AGENTS.md 与 .cursor/rules 中的项目指令
+	DisableInstructions bool `json:"disable_instructions,omitempty"`
+}
+
+// ActiveProfile 返回 $GOMOCKAGENT_PROFILE 或 profile 指定的配置
+func (c *Config) ActiveProfile() (agent.Profile, error) {
+	name := os.Getenv("GOMOCKAGENT_PROFILE")
+	if name == "" {
+		name = c.Profile
+	}
+	if name == "" {
+		return agent.DefaultProfile(), nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return agent.Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	switch p.SystemRole {
+	case "", "system", "developer":
+	default:
+		return agent.Profile{}, fmt.Errorf("profile %q: system_role must be \"system\" or \"developer\"", name)
+	}
+	if p.Memory != nil {
+		if err := p.Memory.Validate(); err != nil {
+			return agent.Profile{}, fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// CommitConfig 控制提交信息的生成
+type CommitConfig struct {
+	Template     string `json:"template,omitempty"`      // 直接写在配置中的模板
+	TemplateFile string `json:"template_file,omitempty"` // 或者从文件读取，相对配置文件所在目录
+}
+
+// MCPServerConfig 描述一个 MCP 服务器；command 与 url 二选一
+type MCPServerConfig struct {
+	Command        string            `json:"command,omitempty"` // stdio 方式启动的可执行文件
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`     // 支持 ${VAR} 引用环境变量
+	URL            string            `json:"url,omitempty"`     // streamable HTTP 端点
+	Headers        map[string]string `json:"headers,omitempty"` // 例如 Authorization，支持 ${VAR}
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Disabled       bool              `json:"disabled,omitempty"`
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	return &Config{}
+}
+
+// configPaths 返回按优先级排列的候选配置文件
+func configPaths() []string {
+	if p := os.Getenv("GOMOCKAGENT_CONFIG"); p != "" {
+		return []string{p}
+	}
+	paths := []string{".gomockagent.json"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "gomockagent", "config.json"))
+	}
+	return paths
+}
+
+// LoadConfig 加载第一个存在的配置文件；都不存在时返回默认配置
+func LoadConfig() (*Config, error) {
+	for _, path := range configPaths() {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		return loadConfigFile(path)
+	}
+	if p := os.Getenv("GOMOCKAGENT_CONFIG"); p != "" {
+		return nil, fmt.Errorf("config file does not exist: %s", p)
+	}
+	return DefaultConfig(), nil
+}
+
+func loadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	// 相对路径以配置文件所在目录为基准
+	base := filepath.Dir(path)
+	if config.Commit.TemplateFile != "" && !filepath.IsAbs(config.Commit.TemplateFile) {
+		config.Commit.TemplateFile = filepath.Join(base, config.Commit.TemplateFile)
+	}
+	return config, nil
+}
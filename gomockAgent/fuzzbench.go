@@ -0,0 +1,606 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- fuzz & benchmark --------------------------
+// 为选定函数生成 FuzzXxx / BenchmarkXxx，并在有限时间内运行、解析结果。
+// 基准对比（工作区 vs HEAD）采用 benchstat 的统计方法：
+// 去除离群值后的均值 ± 波动，以及 Mann-Whitney U 检验的 p 值。
+
+const (
+	defaultFuzzTime  = 10 * time.Second
+	maxFuzzTime      = 120 * time.Second
+	defaultBenchTime = "1s"
+	defaultBenchRuns = 5
+	benchAlpha       = 0.05
+)
+
+// fuzzableTypes 是 testing.F 支持的参数类型及其零值种子；
+// f.Add 要求种子与参数类型完全一致，数值类型必须写成带类型的零值
+var fuzzableTypes = map[string]string{
+	"string": `""`, "[]byte": `[]byte("")`, "bool": "false",
+	"int": "int(0)", "int8": "int8(0)", "int16": "int16(0)", "int32": "int32(0)", "int64": "int64(0)", "rune": "rune(0)",
+	"uint": "uint(0)", "uint8": "uint8(0)", "uint16": "uint16(0)", "uint32": "uint32(0)", "uint64": "uint64(0)", "byte": "byte(0)",
+	"float32": "float32(0)", "float64": "float64(0)",
+}
+
+type funcParam struct {
+	Name string
+	Type string
+}
+
+// findFunc 在包目录中查找顶层函数，返回包名与参数列表
+func findFunc(dir, name string) (pkgName string, params []funcParam, err error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse package in '%s': %w", dir, err)
+	}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || fn.Name.Name != name {
+					continue
+				}
+				for i, field := range fn.Type.Params.List {
+					var typ bytes.Buffer
+					if err := format.Node(&typ, fset, field.Type); err != nil {
+						return "", nil, fmt.Errorf("failed to format parameter type: %w", err)
+					}
+					if len(field.Names) == 0 {
+						params = append(params, funcParam{Name: fmt.Sprintf("arg%d", i), Type: typ.String()})
+					}
+					for _, n := range field.Names {
+						pname := n.Name
+						if pname == "_" {
+							pname = fmt.Sprintf("arg%d", len(params))
+						}
+						params = append(params, funcParam{Name: pname, Type: typ.String()})
+					}
+				}
+				return pkg.Name, params, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("function '%s' not found in '%s'", name, dir)
+}
+
+func exportedSuffix(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// writeGoTestFile 格式化并写入生成的测试文件，拒绝覆盖已有文件
+func writeGoTestFile(ctx context.Context, path string, src string) error {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return fmt.Errorf("generated code does not parse: %w\n%s", err, src)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("file '%s' already exists", path)
+	}
+	if err := writeFileWithCheckpoint(ctx, path, formatted, 0o644); err != nil {
+		return fmt.Errorf("error writing file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// runGoTest 在 dir 中执行 go test 并返回合并输出；测试失败不视为 error
+func runGoTest(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"test"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return string(out), fmt.Errorf("failed to run go test: %w", err)
+	}
+	return string(out), nil
+}
+
+// -------------------------- generate_fuzz_test --------------------------
+type GenerateFuzzTestInput struct {
+	Path     string     `json:"path" jsonschema_description:"Relative path of the Go package directory." jsonschema:"required,minLength=1"`
+	Function string     `json:"function" jsonschema_description:"Name of the top-level function to fuzz." jsonschema:"required,minLength=1"`
+	Seeds    [][]string `json:"seeds,omitempty" jsonschema_description:"Optional seed corpus. Each seed is a list of Go expressions, one per function parameter, e.g. [[\"\\\"hello\\\"\", \"3\"]]."`
+}
+
+var GenerateFuzzTestDefinition = agent.NewTool(
+	"generate_fuzz_test",
+	"Generate a FuzzXxx target with a seed corpus for a Go function. Only parameters of fuzzable types (string, []byte, bool, integers, floats) are supported. The target is written to fuzz_<function>_test.go in the package directory.",
+	GenerateFuzzTest,
+)
+
+func GenerateFuzzTest(ctx context.Context, fuzzInput GenerateFuzzTestInput) (string, error) {
+	pkgName, params, err := findFunc(fuzzInput.Path, fuzzInput.Function)
+	if err != nil {
+		return "", err
+	}
+	if len(params) == 0 {
+		return "", fmt.Errorf("function '%s' has no parameters to fuzz", fuzzInput.Function)
+	}
+
+	zeroSeed := make([]string, 0, len(params))
+	names := make([]string, 0, len(params))
+	signature := make([]string, 0, len(params))
+	for _, p := range params {
+		zero, ok := fuzzableTypes[p.Type]
+		if !ok {
+			return "", fmt.Errorf("parameter '%s' has type %s which is not supported by go fuzzing", p.Name, p.Type)
+		}
+		zeroSeed = append(zeroSeed, zero)
+		// 不沿用原参数名：名为 t、f 或 _ 的参数会与 fuzz 函数冲突或无法引用
+		name := fmt.Sprintf("arg%d", len(names))
+		names = append(names, name)
+		signature = append(signature, name+" "+p.Type)
+	}
+	seeds := [][]string{zeroSeed}
+	for _, seed := range fuzzInput.Seeds {
+		if len(seed) != len(params) {
+			return "", fmt.Errorf("seed %v has %d values but %s takes %d parameters", seed, len(seed), fuzzInput.Function, len(params))
+		}
+		// 无类型常量（如 3）在 f.Add 中会被推断为 int，转换为参数类型后才能匹配
+		typed := make([]string, len(seed))
+		for i, expr := range seed {
+			typed[i] = fmt.Sprintf("%s(%s)", params[i].Type, expr)
+		}
+		seeds = append(seeds, typed)
+	}
+
+	target := "Fuzz" + exportedSuffix(fuzzInput.Function)
+	var src strings.Builder
+	fmt.Fprintf(&src, "package %s\n\nimport \"testing\"\n\n", pkgName)
+	fmt.Fprintf(&src, "func %s(f *testing.F) {\n", target)
+	for _, seed := range seeds {
+		fmt.Fprintf(&src, "\tf.Add(%s)\n", strings.Join(seed, ", "))
+	}
+	fmt.Fprintf(&src, "\tf.Fuzz(func(t *testing.T, %s) {\n", strings.Join(signature, ", "))
+	fmt.Fprintf(&src, "\t\t%s(%s)\n\t})\n}\n", fuzzInput.Function, strings.Join(names, ", "))
+
+	file := filepath.Join(fuzzInput.Path, "fuzz_"+strings.ToLower(fuzzInput.Function)+"_test.go")
+	if err := writeGoTestFile(ctx, file, src.String()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Created %s with target %s and %d seed(s).", file, target, len(seeds)), nil
+}
+
+// -------------------------- run_fuzz --------------------------
+type RunFuzzInput struct {
+	Path            string `json:"path" jsonschema_description:"Relative path of the Go package directory." jsonschema:"required,minLength=1"`
+	Target          string `json:"target" jsonschema_description:"Name of the fuzz target, e.g. FuzzParse." jsonschema:"required,minLength=1"`
+	FuzzTimeSeconds int    `json:"fuzz_time_seconds,omitempty" jsonschema_description:"Optional fuzzing duration in seconds. Defaults to 10, capped at 120."`
+}
+
+// FuzzResult 是解析后的 go test -fuzz 输出
+type FuzzResult struct {
+	Target         string `json:"target"`
+	Passed         bool   `json:"passed"`
+	Execs          int64  `json:"execs"`
+	NewInteresting int64  `json:"new_interesting"`
+	Elapsed        string `json:"elapsed"`
+	FailingInput   string `json:"failing_input,omitempty"` // 失败输入在 testdata/fuzz 下的路径
+	Failure        string `json:"failure,omitempty"`
+}
+
+var RunFuzzDefinition = agent.NewTool(
+	"run_fuzz",
+	"Run a Go fuzz target for a bounded time and return the parsed result. Failing inputs are saved under testdata/fuzz/<target>/ in the package directory so they become regression seeds.",
+	RunFuzz,
+)
+
+var (
+	fuzzProgressRe = regexp.MustCompile(`elapsed: (\S+), execs: (\d+) .*?new interesting: (\d+)`)
+	fuzzFailingRe  = regexp.MustCompile(`Failing input written to (\S+)`)
+)
+
+func RunFuzz(ctx context.Context, runFuzzInput RunFuzzInput) (FuzzResult, error) {
+	fuzzTime := time.Duration(runFuzzInput.FuzzTimeSeconds) * time.Second
+	if fuzzTime <= 0 {
+		fuzzTime = defaultFuzzTime
+	}
+	fuzzTime = min(fuzzTime, maxFuzzTime)
+
+	// 额外留出编译与最小化失败输入的时间
+	ctx, cancel := context.WithTimeout(ctx, fuzzTime+2*time.Minute)
+	defer cancel()
+	out, err := runGoTest(ctx, runFuzzInput.Path,
+		"-run=^$", "-fuzz=^"+regexp.QuoteMeta(runFuzzInput.Target)+"$", "-fuzztime="+fuzzTime.String(), ".")
+	if err != nil {
+		return FuzzResult{}, err
+	}
+
+	result := parseFuzzOutput(runFuzzInput.Target, out)
+	if result.FailingInput != "" {
+		result.FailingInput = filepath.Join(runFuzzInput.Path, result.FailingInput)
+	}
+	return result, nil
+}
+
+func parseFuzzOutput(target, out string) FuzzResult {
+	result := FuzzResult{Target: target, Passed: true}
+	for _, m := range fuzzProgressRe.FindAllStringSubmatch(out, -1) {
+		result.Elapsed = m[1]
+		result.Execs, _ = strconv.ParseInt(m[2], 10, 64)
+		result.NewInteresting, _ = strconv.ParseInt(m[3], 10, 64)
+	}
+	if m := fuzzFailingRe.FindStringSubmatch(out); m != nil {
+		result.FailingInput = m[1]
+	}
+	if strings.Contains(out, "\nFAIL") || strings.HasPrefix(out, "FAIL") || strings.Contains(out, "--- FAIL") {
+		result.Passed = false
+		result.Failure = truncateOutput(out, 4000)
+	}
+	return result
+}
+
+func truncateOutput(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + fmt.Sprintf("\n... (%d bytes truncated)", len(s)-limit)
+}
+
+// -------------------------- generate_benchmark --------------------------
+type GenerateBenchmarkInput struct {
+	Path     string   `json:"path" jsonschema_description:"Relative path of the Go package directory." jsonschema:"required,minLength=1"`
+	Function string   `json:"function" jsonschema_description:"Name of the top-level function to benchmark." jsonschema:"required,minLength=1"`
+	Args     []string `json:"args,omitempty" jsonschema_description:"Go expressions passed as arguments, one per parameter. Defaults to zero values for fuzzable types."`
+}
+
+var GenerateBenchmarkDefinition = agent.NewTool(
+	"generate_benchmark",
+	"Generate a BenchmarkXxx function calling a Go function with the given argument expressions. The benchmark is written to bench_<function>_test.go in the package directory.",
+	GenerateBenchmark,
+)
+
+func GenerateBenchmark(ctx context.Context, benchInput GenerateBenchmarkInput) (string, error) {
+	pkgName, params, err := findFunc(benchInput.Path, benchInput.Function)
+	if err != nil {
+		return "", err
+	}
+	args := benchInput.Args
+	if len(args) == 0 {
+		for _, p := range params {
+			zero, ok := fuzzableTypes[p.Type]
+			if !ok {
+				return "", fmt.Errorf("no default value for parameter '%s' of type %s, please provide args", p.Name, p.Type)
+			}
+			args = append(args, zero)
+		}
+	}
+	if len(args) != len(params) {
+		return "", fmt.Errorf("got %d args but %s takes %d parameters", len(args), benchInput.Function, len(params))
+	}
+
+	name := "Benchmark" + exportedSuffix(benchInput.Function)
+	src := fmt.Sprintf("package %s\n\nimport \"testing\"\n\nfunc %s(b *testing.B) {\n\tb.ReportAllocs()\n\tfor i := 0; i < b.N; i++ {\n\t\t%s(%s)\n\t}\n}\n",
+		pkgName, name, benchInput.Function, strings.Join(args, ", "))
+
+	file := filepath.Join(benchInput.Path, "bench_"+strings.ToLower(benchInput.Function)+"_test.go")
+	if err := writeGoTestFile(ctx, file, src); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Created %s with %s.", file, name), nil
+}
+
+// -------------------------- run_benchmark --------------------------
+type RunBenchmarkInput struct {
+	Path        string `json:"path" jsonschema_description:"Relative path of the Go package directory." jsonschema:"required,minLength=1"`
+	Pattern     string `json:"pattern,omitempty" jsonschema_description:"Optional -bench regexp. Defaults to all benchmarks."`
+	BenchTime   string `json:"bench_time,omitempty" jsonschema_description:"Optional -benchtime value such as 500ms or 1000x. Defaults to 1s."`
+	Count       int    `json:"count,omitempty" jsonschema_description:"Optional number of runs per benchmark used for statistics. Defaults to 5."`
+	CompareHead bool   `json:"compare_head,omitempty" jsonschema_description:"Also run the benchmarks against the HEAD commit and report benchstat-style deltas."`
+}
+
+// BenchmarkSummary 是单个基准某一指标的统计
+type BenchmarkSummary struct {
+	Name   string    `json:"name"`
+	Unit   string    `json:"unit"`
+	Mean   float64   `json:"mean"`
+	Spread float64   `json:"spread_pct"` // 去除离群值后相对均值的最大偏差
+	Values []float64 `json:"values"`
+}
+
+// BenchmarkDelta 是 HEAD 与工作区之间的对比
+type BenchmarkDelta struct {
+	Name        string  `json:"name"`
+	Unit        string  `json:"unit"`
+	Head        float64 `json:"head"`
+	Working     float64 `json:"working"`
+	DeltaPct    float64 `json:"delta_pct"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+type BenchmarkResult struct {
+	Working []BenchmarkSummary `json:"working"`
+	Head    []BenchmarkSummary `json:"head,omitempty"`
+	Deltas  []BenchmarkDelta   `json:"deltas,omitempty"`
+	Table   string             `json:"table"`
+}
+
+var RunBenchmarkDefinition = agent.NewTool(
+	"run_benchmark",
+	"Run Go benchmarks with a bounded -benchtime and return parsed statistics. With compare_head, the same benchmarks are also run on the HEAD commit and compared benchstat-style (mean ± spread, delta and Mann-Whitney p-value).",
+	RunBenchmark,
+)
+
+func RunBenchmark(ctx context.Context, benchInput RunBenchmarkInput) (BenchmarkResult, error) {
+	if benchInput.Pattern == "" {
+		benchInput.Pattern = "."
+	}
+	if benchInput.BenchTime == "" {
+		benchInput.BenchTime = defaultBenchTime
+	}
+	if benchInput.Count <= 0 {
+		benchInput.Count = defaultBenchRuns
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	result := BenchmarkResult{}
+	var err error
+	result.Working, err = runBenchmarks(ctx, benchInput.Path, benchInput)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	if benchInput.CompareHead {
+		headDir, cleanup, err := checkoutHead(ctx, benchInput.Path)
+		if err != nil {
+			return BenchmarkResult{}, err
+		}
+		defer cleanup()
+		result.Head, err = runBenchmarks(ctx, headDir, benchInput)
+		if err != nil {
+			return BenchmarkResult{}, fmt.Errorf("benchmarks failed on HEAD: %w", err)
+		}
+		result.Deltas = compareBenchmarks(result.Head, result.Working)
+	}
+	result.Table = formatBenchmarkTable(result)
+	return result, nil
+}
+
+func runBenchmarks(ctx context.Context, dir string, in RunBenchmarkInput) ([]BenchmarkSummary, error) {
+	out, err := runGoTest(ctx, dir, "-run=^$", "-bench="+in.Pattern, "-benchtime="+in.BenchTime,
+		"-count="+strconv.Itoa(in.Count), "-benchmem", ".")
+	if err != nil {
+		return nil, err
+	}
+	summaries := parseBenchmarkOutput(out)
+	if len(summaries) == 0 {
+		return nil, fmt.Errorf("no benchmark results found:\n%s", truncateOutput(out, 4000))
+	}
+	return summaries, nil
+}
+
+// parseBenchmarkOutput 解析标准 benchmark 行：
+// BenchmarkFoo-8   1000000   1234 ns/op   16 B/op   1 allocs/op
+func parseBenchmarkOutput(out string) []BenchmarkSummary {
+	type key struct{ name, unit string }
+	values := map[key][]float64{}
+	var order []key
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			continue
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			k := key{fields[0], fields[i+1]}
+			if _, seen := values[k]; !seen {
+				order = append(order, k)
+			}
+			values[k] = append(values[k], v)
+		}
+	}
+	summaries := make([]BenchmarkSummary, 0, len(order))
+	for _, k := range order {
+		mean, spread := meanAndSpread(values[k])
+		summaries = append(summaries, BenchmarkSummary{Name: k.name, Unit: k.unit, Mean: mean, Spread: spread, Values: values[k]})
+	}
+	return summaries
+}
+
+// meanAndSpread 参考 benchstat：先按 1.5*IQR 去除离群值，再计算均值与最大相对偏差
+func meanAndSpread(values []float64) (float64, float64) {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	lo, hi := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	var kept []float64
+	for _, v := range sorted {
+		if v >= lo && v <= hi {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, v := range kept {
+		sum += v
+	}
+	mean := sum / float64(len(kept))
+	if mean == 0 {
+		return 0, 0
+	}
+	spread := math.Max(mean-kept[0], kept[len(kept)-1]-mean) / mean * 100
+	return mean, spread
+}
+
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[i]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+func compareBenchmarks(head, working []BenchmarkSummary) []BenchmarkDelta {
+	base := map[string]BenchmarkSummary{}
+	for _, s := range head {
+		base[s.Name+"\x00"+s.Unit] = s
+	}
+	var deltas []BenchmarkDelta
+	for _, w := range working {
+		h, ok := base[w.Name+"\x00"+w.Unit]
+		if !ok {
+			continue
+		}
+		d := BenchmarkDelta{Name: w.Name, Unit: w.Unit, Head: h.Mean, Working: w.Mean, PValue: mannWhitneyU(h.Values, w.Values)}
+		if h.Mean != 0 {
+			d.DeltaPct = (w.Mean - h.Mean) / h.Mean * 100
+		}
+		d.Significant = d.PValue < benchAlpha
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// mannWhitneyU 返回双侧 p 值，使用带并列校正的正态近似
+func mannWhitneyU(x, y []float64) float64 {
+	n1, n2 := float64(len(x)), float64(len(y))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type sample struct {
+		v     float64
+		fromX bool
+	}
+	all := make([]sample, 0, len(x)+len(y))
+	for _, v := range x {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range y {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	rankSumX, tieTerm := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // 并列值取平均秩
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankSumX += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+	u := rankSumX - n1*(n1+1)/2
+	n := n1 + n2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-n1*n2/2) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+func formatBenchmarkTable(r BenchmarkResult) string {
+	var sb strings.Builder
+	if len(r.Deltas) == 0 {
+		for _, s := range r.Working {
+			fmt.Fprintf(&sb, "%-40s %14.4g %-10s ±%3.0f%%\n", s.Name, s.Mean, s.Unit, s.Spread)
+		}
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%-40s %14s %14s %-10s %s\n", "name", "HEAD", "working", "unit", "delta")
+	for _, d := range r.Deltas {
+		delta := "~"
+		if d.Significant {
+			delta = fmt.Sprintf("%+.2f%%", d.DeltaPct)
+		}
+		fmt.Fprintf(&sb, "%-40s %14.4g %14.4g %-10s %s (p=%.3f)\n", d.Name, d.Head, d.Working, d.Unit, delta, d.PValue)
+	}
+	return sb.String()
+}
+
+// checkoutHead 在临时 git worktree 中检出 HEAD，并复制工作区中该包的 _test.go，
+// 保证两边运行相同的基准函数。返回 HEAD 中对应的包目录。
+func checkoutHead(ctx context.Context, dir string) (string, func(), error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve '%s': %w", dir, err)
+	}
+	top, err := exec.CommandContext(ctx, "git", "-C", absDir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("'%s' is not inside a git repository: %w", dir, err)
+	}
+	root := strings.TrimSpace(string(top))
+	rel, err := filepath.Rel(root, absDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get relative path for %s: %w", absDir, err)
+	}
+
+	tmp, err := os.MkdirTemp("", "gomockagent-head-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	worktree := filepath.Join(tmp, "head")
+	if out, err := exec.CommandContext(ctx, "git", "-C", root, "worktree", "add", "--detach", worktree, "HEAD").CombinedOutput(); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, fmt.Errorf("failed to check out HEAD: %w: %s", err, out)
+	}
+	cleanup := func() {
+		_ = exec.Command("git", "-C", root, "worktree", "remove", "--force", worktree).Run()
+		os.RemoveAll(tmp)
+	}
+
+	headDir := filepath.Join(worktree, rel)
+	testFiles, _ := filepath.Glob(filepath.Join(absDir, "*_test.go"))
+	for _, f := range testFiles {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("error reading file '%s': %w", f, err)
+		}
+		if err := os.WriteFile(filepath.Join(headDir, filepath.Base(f)), content, 0o644); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to copy %s to HEAD checkout: %w", f, err)
+		}
+	}
+	return headDir, cleanup, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 生成的 fuzz 目标必须能通过 go vet，并且种子语料能实际运行：
+// f.Add 的种子类型与参数类型不一致时只会在运行时报错
+func TestGenerateFuzzTestTypedSeeds(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module fuzztarget\n\ngo 1.21\n",
+		"scale.go": `package fuzztarget
+
+func scale(n int64, factor float64, label string, flags uint8, data []byte) float64 {
+	return float64(n) * factor
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := GenerateFuzzTest(context.Background(), GenerateFuzzTestInput{
+		Path:     dir,
+		Function: "scale",
+		Seeds:    [][]string{{"3", "1.5", `"x"`, "7", `"raw"`}, {"-1", "2", `""`, "0xff", `"\x00"`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(filepath.Join(dir, "fuzz_scale_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"int64(0), float64(0)", "int64(3), float64(1.5)", `[]byte("raw")`} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated target does not contain %q:\n%s", want, src)
+		}
+	}
+
+	for _, args := range [][]string{{"vet", "./..."}, {"test", "-run=^FuzzScale$", "./..."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOFLAGS=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s\n%s", strings.Join(args, " "), err, out, src)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- 本地 git 工具 --------------------------
+// get_merge_diff 只能访问 GitLab；这些工具直接读取本地仓库，离线可用。
+// 输出为结构化 JSON，并限制大小，避免撑爆上下文。
+
+const (
+	gitTimeout         = 30 * time.Second
+	defaultGitMaxBytes = 20000
+	defaultGitLogCount = 20
+	maxGitLogCount     = 200
+	maxGitBlameLines   = 500
+)
+
+// checkRevision 拒绝以 - 开头的版本：模型给出的值会作为 git 的参数，
+// 例如 --output=<file> 会让 git 写入任意文件
+func checkRevision(tool, param, rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid parameter '%s' for %s: revision %q must not start with '-'", param, tool, rev)
+	}
+	return nil
+}
+
+// runGit 在当前目录执行 git，失败时把 stderr 带进错误信息
+func runGit(args ...string) (string, error) {
+	return runGitContext(context.Background(), args...)
+}
+
+// runGitContext 与 runGit 相同，ctx 取消时终止 git；供工具传入会话的 ctx
+func runGitContext(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+func gitMaxBytes(n int) int {
+	if n <= 0 {
+		return defaultGitMaxBytes
+	}
+	return n
+}
+
+// -------------------------- git_status --------------------------
+type GitStatusInput struct{}
+
+type GitStatusFile struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"orig_path,omitempty"` // 重命名前的路径
+	Staged   string `json:"staged,omitempty"`    // 暂存区状态：M A D R C U
+	Unstaged string `json:"unstaged,omitempty"`  // 工作区状态
+	State    string `json:"state"`               // tracked, untracked, conflict
+}
+
+type GitStatusResult struct {
+	Branch   string          `json:"branch"`
+	Upstream string          `json:"upstream,omitempty"`
+	Ahead    int             `json:"ahead,omitempty"`
+	Behind   int             `json:"behind,omitempty"`
+	Files    []GitStatusFile `json:"files"`
+}
+
+var GitStatusDefinition = agent.NewTool(
+	"git_status",
+	"Show the local git working tree status: current branch, upstream ahead/behind counts, and changed, staged and untracked files as JSON.",
+	GitStatus,
+)
+
+func GitStatus(ctx context.Context, _ GitStatusInput) (GitStatusResult, error) {
+	out, err := runGitContext(ctx, "status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return GitStatusResult{}, err
+	}
+	result := GitStatusResult{Files: []GitStatusFile{}}
+	entries := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		switch {
+		case strings.HasPrefix(e, "# branch.head "):
+			result.Branch = strings.TrimPrefix(e, "# branch.head ")
+		case strings.HasPrefix(e, "# branch.upstream "):
+			result.Upstream = strings.TrimPrefix(e, "# branch.upstream ")
+		case strings.HasPrefix(e, "# branch.ab "):
+			fmt.Sscanf(strings.TrimPrefix(e, "# branch.ab "), "+%d -%d", &result.Ahead, &result.Behind)
+		case strings.HasPrefix(e, "1 "):
+			// 1 XY sub mH mI mW hH hI path
+			f := strings.SplitN(e, " ", 9)
+			result.Files = append(result.Files, statusFile(f[1], f[8], "", "tracked"))
+		case strings.HasPrefix(e, "2 "):
+			// 2 XY sub mH mI mW hH hI Xscore path，紧随其后的条目是原路径
+			f := strings.SplitN(e, " ", 10)
+			orig := ""
+			if i+1 < len(entries) {
+				orig = entries[i+1]
+				i++
+			}
+			result.Files = append(result.Files, statusFile(f[1], f[9], orig, "tracked"))
+		case strings.HasPrefix(e, "u "):
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			f := strings.SplitN(e, " ", 11)
+			result.Files = append(result.Files, statusFile(f[1], f[10], "", "conflict"))
+		case strings.HasPrefix(e, "? "):
+			result.Files = append(result.Files, GitStatusFile{Path: e[2:], State: "untracked"})
+		}
+	}
+	return result, nil
+}
+
+func statusFile(xy, path, orig, state string) GitStatusFile {
+	f := GitStatusFile{Path: path, OrigPath: orig, State: state}
+	if xy[0] != '.' {
+		f.Staged = xy[:1]
+	}
+	if xy[1] != '.' {
+		f.Unstaged = xy[1:]
+	}
+	return f
+}
+
+// -------------------------- git_diff --------------------------
+type GitDiffInput struct {
+	Mode     string   `json:"mode,omitempty" jsonschema:"enum=working,enum=staged,enum=refs" jsonschema_description:"'working' (default) diffs the working tree against the index, 'staged' diffs the index against HEAD, 'refs' diffs 'from' against 'to'."`
+	From     string   `json:"from,omitempty" jsonschema_description:"Base revision for mode 'refs'."`
+	To       string   `json:"to,omitempty" jsonschema_description:"Target revision for mode 'refs'. Defaults to HEAD."`
+	Paths    []string `json:"paths,omitempty" jsonschema_description:"Optional paths to limit the diff to."`
+	StatOnly bool     `json:"stat_only,omitempty" jsonschema_description:"Only return per-file line counts, without the patch."`
+	MaxBytes int      `json:"max_bytes,omitempty" jsonschema_description:"Optional limit for the patch text. Defaults to 20000."`
+}
+
+type GitDiffFile struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+type GitDiffResult struct {
+	Files     []GitDiffFile `json:"files"`
+	Patch     string        `json:"patch,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+var GitDiffDefinition = agent.NewTool(
+	"git_diff",
+	"Show a local git diff of the working tree, the staged changes, or between two revisions, optionally limited to paths. Returns per-file line counts and a size-limited unified patch as JSON.",
+	GitDiff,
+)
+
+func GitDiff(ctx context.Context, gitDiffInput GitDiffInput) (GitDiffResult, error) {
+	args, err := gitDiffArgs(gitDiffInput)
+	if err != nil {
+		return GitDiffResult{}, err
+	}
+	pathArgs := append([]string{"--"}, gitDiffInput.Paths...)
+
+	numstat, err := runGitContext(ctx, append(append(args, "--numstat"), pathArgs...)...)
+	if err != nil {
+		return GitDiffResult{}, err
+	}
+	result := GitDiffResult{Files: parseNumstat(numstat)}
+	if !gitDiffInput.StatOnly {
+		patch, err := runGitContext(ctx, append(args, pathArgs...)...)
+		if err != nil {
+			return GitDiffResult{}, err
+		}
+		limit := gitMaxBytes(gitDiffInput.MaxBytes)
+		result.Truncated = len(patch) > limit
+		result.Patch = truncateOutput(patch, limit)
+	}
+	return result, nil
+}
+
+func gitDiffArgs(in GitDiffInput) ([]string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	switch in.Mode {
+	case "", "working":
+	case "staged":
+		args = append(args, "--cached")
+	case "refs":
+		if in.From == "" {
+			return nil, fmt.Errorf("missing required parameter 'from' for git_diff mode 'refs'")
+		}
+		to := in.To
+		if to == "" {
+			to = "HEAD"
+		}
+		if err := checkRevision("git_diff", "from", in.From); err != nil {
+			return nil, err
+		}
+		if err := checkRevision("git_diff", "to", to); err != nil {
+			return nil, err
+		}
+		args = append(args, in.From, to)
+	default:
+		return nil, fmt.Errorf("unknown git_diff mode %q, expected working, staged or refs", in.Mode)
+	}
+	return args, nil
+}
+
+func parseNumstat(out string) []GitDiffFile {
+	files := []GitDiffFile{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		f := strings.SplitN(line, "\t", 3)
+		if len(f) != 3 {
+			continue
+		}
+		file := GitDiffFile{Path: f[2]}
+		if f[0] == "-" {
+			file.Binary = true
+		} else {
+			file.Additions, _ = strconv.Atoi(f[0])
+			file.Deletions, _ = strconv.Atoi(f[1])
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// -------------------------- git_log --------------------------
+type GitLogInput struct {
+	Rev      string   `json:"rev,omitempty" jsonschema_description:"Optional revision or range, e.g. main or v1.0..HEAD. Defaults to HEAD."`
+	Paths    []string `json:"paths,omitempty" jsonschema_description:"Optional paths; only commits touching them are listed."`
+	MaxCount int      `json:"max_count,omitempty" jsonschema_description:"Optional number of commits to return. Defaults to 20, at most 200."`
+	Author   string   `json:"author,omitempty" jsonschema_description:"Optional author name or email pattern."`
+	Since    string   `json:"since,omitempty" jsonschema_description:"Optional date such as 2024-01-01 or '2 weeks ago'."`
+}
+
+type GitCommit struct {
+	Hash    string   `json:"hash"`
+	Author  string   `json:"author"`
+	Email   string   `json:"email"`
+	Date    string   `json:"date"`
+	Subject string   `json:"subject"`
+	Files   []string `json:"files,omitempty"`
+}
+
+var GitLogDefinition = agent.NewTool(
+	"git_log",
+	"List local git commits as JSON (hash, author, date, subject and changed files), optionally filtered by revision range, paths, author and date.",
+	GitLog,
+)
+
+func GitLog(ctx context.Context, gitLogInput GitLogInput) ([]GitCommit, error) {
+	count := gitLogInput.MaxCount
+	if count <= 0 {
+		count = defaultGitLogCount
+	}
+	count = min(count, maxGitLogCount)
+
+	args := []string{"log", "--no-color", "--name-only", "--format=%x1e%H%x1f%an%x1f%ae%x1f%aI%x1f%s", "-n", strconv.Itoa(count)}
+	if gitLogInput.Author != "" {
+		args = append(args, "--author="+gitLogInput.Author)
+	}
+	if gitLogInput.Since != "" {
+		args = append(args, "--since="+gitLogInput.Since)
+	}
+	if gitLogInput.Rev != "" {
+		if err := checkRevision("git_log", "rev", gitLogInput.Rev); err != nil {
+			return nil, err
+		}
+		args = append(args, gitLogInput.Rev)
+	}
+	args = append(append(args, "--"), gitLogInput.Paths...)
+	out, err := runGitContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitLog(out), nil
+}
+
+func parseGitLog(out string) []GitCommit {
+	commits := []GitCommit{}
+	for _, record := range strings.Split(out, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		header := strings.Split(lines[0], "\x1f")
+		if len(header) != 5 {
+			continue
+		}
+		c := GitCommit{Hash: header[0], Author: header[1], Email: header[2], Date: header[3], Subject: header[4]}
+		for _, f := range lines[1:] {
+			if f = strings.TrimSpace(f); f != "" {
+				c.Files = append(c.Files, f)
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+// -------------------------- git_blame --------------------------
+type GitBlameInput struct {
+	Path      string `json:"path" jsonschema_description:"Relative path of the file." jsonschema:"required,minLength=1"`
+	StartLine int    `json:"start_line" jsonschema_description:"First line of the range (1-based)." jsonschema:"required,minimum=1"`
+	EndLine   int    `json:"end_line" jsonschema_description:"Last line of the range, inclusive. At most 500 lines per call." jsonschema:"required,minimum=1"`
+	Rev       string `json:"rev,omitempty" jsonschema_description:"Optional revision to blame. Defaults to the working tree."`
+}
+
+type GitBlameLine struct {
+	Line    int    `json:"line"`
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+	Content string `json:"content"`
+}
+
+var GitBlameDefinition = agent.NewTool(
+	"git_blame",
+	"Show who last changed each line in a line range of a file (commit, author, date, summary and content) as JSON.",
+	GitBlame,
+)
+
+func GitBlame(ctx context.Context, gitBlameInput GitBlameInput) ([]GitBlameLine, error) {
+	start, end := gitBlameInput.StartLine, gitBlameInput.EndLine
+	if start <= 0 || end < start {
+		return nil, fmt.Errorf("invalid line range %d-%d for git_blame", start, end)
+	}
+	if end-start+1 > maxGitBlameLines {
+		return nil, fmt.Errorf("line range %d-%d is too large, at most %d lines per call", start, end, maxGitBlameLines)
+	}
+
+	args := []string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end)}
+	if gitBlameInput.Rev != "" {
+		if err := checkRevision("git_blame", "rev", gitBlameInput.Rev); err != nil {
+			return nil, err
+		}
+		args = append(args, gitBlameInput.Rev)
+	}
+	out, err := runGitContext(ctx, append(args, "--", gitBlameInput.Path)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseGitBlame(out), nil
+}
+
+// parseGitBlame 解析 --porcelain 输出；提交信息只在每个提交第一次出现时给出
+func parseGitBlame(out string) []GitBlameLine {
+	type commitInfo struct{ author, date, summary string }
+	commits := map[string]*commitInfo{}
+	lines := []GitBlameLine{}
+	var cur *GitBlameLine
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if cur != nil {
+				info := commits[cur.Commit]
+				cur.Author, cur.Date, cur.Summary = info.author, info.date, info.summary
+				cur.Content = line[1:]
+				if len(cur.Commit) > 12 {
+					cur.Commit = cur.Commit[:12]
+				}
+				lines = append(lines, *cur)
+				cur = nil
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && len(fields[0]) == 40 {
+			n, _ := strconv.Atoi(fields[2])
+			cur = &GitBlameLine{Line: n, Commit: fields[0]}
+			if commits[fields[0]] == nil {
+				commits[fields[0]] = &commitInfo{}
+			}
+			continue
+		}
+		if cur == nil || len(fields) == 0 {
+			continue
+		}
+		info := commits[cur.Commit]
+		value := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		switch fields[0] {
+		case "author":
+			info.author = value
+		case "author-time":
+			if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+				info.date = time.Unix(ts, 0).UTC().Format(time.RFC3339)
+			}
+		case "summary":
+			info.summary = value
+		}
+	}
+	return lines
+}
+
+// -------------------------- git_show --------------------------
+type GitShowInput struct {
+	Rev      string `json:"rev" jsonschema_description:"Revision, e.g. HEAD~2, a tag or a commit hash." jsonschema:"required,minLength=1"`
+	Path     string `json:"path,omitempty" jsonschema_description:"Optional file path; returns the file content at that revision (git show <rev>:<path>). Without a path the commit itself is shown."`
+	MaxBytes int    `json:"max_bytes,omitempty" jsonschema_description:"Optional output limit. Defaults to 20000."`
+}
+
+type GitShowResult struct {
+	Rev       string `json:"rev"`
+	Path      string `json:"path,omitempty"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+var GitShowDefinition = agent.NewTool(
+	"git_show",
+	"Show a file as it was at a git revision (rev + path), or a commit with its message and patch (rev only). Output is size-limited.",
+	GitShow,
+)
+
+func GitShow(ctx context.Context, gitShowInput GitShowInput) (GitShowResult, error) {
+	if err := checkRevision("git_show", "rev", gitShowInput.Rev); err != nil {
+		return GitShowResult{}, err
+	}
+	object := gitShowInput.Rev
+	args := []string{"show", "--no-color"}
+	if gitShowInput.Path != "" {
+		// "./" 前缀让路径相对当前目录，而不是仓库根目录
+		object += ":./" + strings.TrimPrefix(gitShowInput.Path, "./")
+	} else {
+		args = append(args, "--stat", "--patch")
+	}
+	out, err := runGitContext(ctx, append(args, object)...)
+	if err != nil {
+		return GitShowResult{}, err
+	}
+	limit := gitMaxBytes(gitShowInput.MaxBytes)
+	return GitShowResult{
+		Rev:       gitShowInput.Rev,
+		Path:      gitShowInput.Path,
+		Content:   truncateOutput(out, limit),
+		Truncated: len(out) > limit,
+	}, nil
+}
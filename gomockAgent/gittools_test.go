@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gomockAgent/agent"
+)
+
+func TestGitToolsRejectOptionRevisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		tool  agent.ToolDefinition
+		input string
+	}{
+		{"git_diff from", GitDiffDefinition, `{"mode":"refs","from":"--output=/tmp/pwned"}`},
+		{"git_diff to", GitDiffDefinition, `{"mode":"refs","from":"main","to":"-p"}`},
+		{"git_log", GitLogDefinition, `{"rev":"--output=/tmp/pwned"}`},
+		{"git_blame", GitBlameDefinition, `{"path":"main.go","start_line":1,"end_line":2,"rev":"--contents=/etc/passwd"}`},
+		{"git_show", GitShowDefinition, `{"rev":"--output=/tmp/pwned"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.tool.Call(context.Background(), json.RawMessage(tt.input))
+			if err == nil || !strings.Contains(err.Error(), "must not start with '-'") {
+				t.Fatalf("expected the revision to be rejected, got %v", err)
+			}
+		})
+	}
+}
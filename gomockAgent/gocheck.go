@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/imports"
+)
+
+// -------------------------- Go post-edit pipeline --------------------------
+// 每次工具修改 .go 文件后：gofmt + goimports 格式化，再对所在包执行 go vet 与 go build。
+// 诊断信息会附加在工具结果中返回给模型，让它在同一轮内修正自己的错误。
+
+const goCheckTimeout = 2 * time.Minute
+
+// PostEditGoFiles 依次处理被修改的 Go 文件，返回需要反馈给模型的诊断文本。
+// 没有任何问题时返回空字符串。
+func PostEditGoFiles(ctx context.Context, paths ...string) string {
+	var diagnostics []string
+	dirs := map[string]bool{}
+	var dirOrder []string
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".go") {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue // 文件已被删除
+		}
+		if msg := formatGoFile(ctx, path); msg != "" {
+			diagnostics = append(diagnostics, msg)
+		}
+		dir := filepath.Dir(path)
+		if !dirs[dir] {
+			dirs[dir] = true
+			dirOrder = append(dirOrder, dir)
+		}
+	}
+	for _, dir := range dirOrder {
+		if ctx.Err() != nil {
+			break // 工具调用已取消，结果不会再回传给模型
+		}
+		diagnostics = append(diagnostics, checkGoPackage(ctx, dir)...)
+	}
+	return strings.Join(diagnostics, "\n")
+}
+
+// formatGoFile 用 goimports 规则重写文件：格式化并补齐/移除 import
+func formatGoFile(ctx context.Context, path string) string {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("format %s: %s", path, err)
+	}
+	formatted, err := imports.Process(path, src, nil)
+	if err != nil {
+		// 语法错误时保留原内容，让模型根据错误位置修复
+		return fmt.Sprintf("format %s: %s", path, err)
+	}
+	if string(formatted) == string(src) {
+		return ""
+	}
+	if err := writeFileWithCheckpoint(ctx, path, formatted, 0o644); err != nil {
+		return fmt.Sprintf("format %s: %s", path, err)
+	}
+	return ""
+}
+
+// checkGoPackage 对目录中的包运行 go build 与 go vet，只返回失败的输出
+func checkGoPackage(ctx context.Context, dir string) []string {
+	for _, args := range [][]string{
+		{"build", "-o", os.DevNull, "."},
+		{"vet", "."},
+	} {
+		out, err := runGoCommand(ctx, dir, args...)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		text := strings.TrimSpace(out)
+		if text == "" {
+			text = err.Error()
+		}
+		// 编译失败时 vet 只会重复相同的类型错误，不再继续
+		return []string{fmt.Sprintf("go %s (in %s):\n%s", args[0], dir, truncateOutput(text, 4000))}
+	}
+	return nil
+}
+
+// runGoCommand 在 dir 中执行 go 命令；工具调用被取消时随之终止，最长 goCheckTimeout
+func runGoCommand(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, goCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return string(out), fmt.Errorf("go %s: %w", args[0], ctx.Err())
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return string(out), fmt.Errorf("go %s timed out after %s", args[0], goCheckTimeout)
+	}
+	return string(out), err
+}
+
+// withGoDiagnostics 把诊断附加到成功的工具结果之后
+func withGoDiagnostics(ctx context.Context, result string, paths ...string) string {
+	diagnostics := PostEditGoFiles(ctx, paths...)
+	if diagnostics == "" {
+		return result
+	}
+	return result + "\n\nGo diagnostics after edit (please fix):\n" + diagnostics
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostEditGoFilesHonoursContext(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "broken.go")
+	if err := os.WriteFile(file, []byte("package broken\n\nfunc f() int { return \"x\" }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module broken\n\ngo 1.21\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := runGoCommand(ctx, dir, "build", "."); !errors.Is(err, context.Canceled) {
+		t.Fatalf("runGoCommand with a cancelled context = %v, want context.Canceled", err)
+	}
+	if diagnostics := PostEditGoFiles(ctx, file); diagnostics != "" {
+		t.Fatalf("a cancelled edit must not report diagnostics, got:\n%s", diagnostics)
+	}
+}
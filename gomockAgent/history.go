@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// -------------------------- 输入历史 --------------------------
+// 历史保存在 ~/.config/gomockagent/history.jsonl，每行一个 JSON 字符串，因此可以包含多行输入。
+// 可用 $GOMOCKAGENT_HISTORY 指定其他文件。
+
+const maxHistoryEntries = 1000
+
+type inputHistory struct {
+	mu      sync.Mutex
+	path    string
+	entries []string
+}
+
+func historyPath() string {
+	if p := os.Getenv("GOMOCKAGENT_HISTORY"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gomockagent", "history.jsonl")
+}
+
+// loadInputHistory 读取历史文件；文件不存在时返回空历史，path 为空时不保存
+func loadInputHistory(path string) (*inputHistory, error) {
+	h := &inputHistory{path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInputLineBytes)
+	for scanner.Scan() {
+		var entry string
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("failed to read history file: %w", err)
+	}
+	if len(h.entries) > 2*maxHistoryEntries {
+		// 文件只追加，过长时重写为最近的记录
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+		return h, h.rewrite()
+	}
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+	}
+	return h, nil
+}
+
+func (h *inputHistory) rewrite() error {
+	var data []byte
+	for _, entry := range h.entries {
+		line, _ := json.Marshal(entry)
+		data = append(append(data, line...), '\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// Entries 返回从旧到新的历史
+func (h *inputHistory) Entries() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.entries...)
+}
+
+// Add 追加一条历史并写入文件，与上一条相同时忽略
+func (h *inputHistory) Add(entry string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+	line, _ := json.Marshal(entry)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
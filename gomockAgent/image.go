@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- 图片 --------------------------
+// @ 引用与 view_image 工具共用：读取本地图片，以 base64 data URL 作为 image_url 内容发送给视觉模型。
+
+const maxImageBytes = 5 << 20
+
+var imageMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+func isImagePath(path string) bool {
+	return imageMediaTypes[strings.ToLower(filepath.Ext(path))] != ""
+}
+
+// loadImagePart 读取图片并返回 image_url 内容与一行描述，例如 "1280x720 png, 120.5 KB"
+func loadImagePart(path, detail string) (agent.OpenAIContentPart, string, error) {
+	mediaType := imageMediaTypes[strings.ToLower(filepath.Ext(path))]
+	if mediaType == "" {
+		return agent.OpenAIContentPart{}, "", fmt.Errorf("%s is not a PNG, JPEG, GIF or WebP image", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return agent.OpenAIContentPart{}, "", err
+	}
+	if info.Size() > maxImageBytes {
+		return agent.OpenAIContentPart{}, "", fmt.Errorf("%s is %d KB, images are limited to %d MB", path, info.Size()>>10, maxImageBytes>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return agent.OpenAIContentPart{}, "", err
+	}
+	summary := fmt.Sprintf("%s, %.1f KB", mediaType, float64(len(data))/1024)
+	// webp 没有内置解码器，只检查 png、jpeg、gif 是否为有效图片
+	if mediaType != "image/webp" {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return agent.OpenAIContentPart{}, "", fmt.Errorf("failed to decode image %s: %w", path, err)
+		}
+		summary = fmt.Sprintf("%dx%d %s, %.1f KB", cfg.Width, cfg.Height, format, float64(len(data))/1024)
+	}
+	part := agent.ImagePart("data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data))
+	part.ImageURL.Detail = detail
+	return part, summary, nil
+}
+
+// -------------------------- view_image --------------------------
+type ViewImageInput struct {
+	Path   string `json:"path" jsonschema_description:"The relative path of a PNG, JPEG, GIF or WebP image in the working directory, for example a screenshot attached to a merge request." jsonschema:"required,minLength=1"`
+	Detail string `json:"detail,omitempty" jsonschema_description:"Image detail level: low is cheaper, high is needed to read small text. Defaults to auto." jsonschema:"enum=auto,enum=low,enum=high"`
+}
+
+var ViewImageDefinition = agent.NewTool(
+	"view_image",
+	"Look at a local image file, such as a UI screenshot or a visual diff. The image is attached to the conversation after the tool result. Requires a vision-capable model.",
+	ViewImage,
+)
+
+func ViewImage(ctx context.Context, input ViewImageInput) (agent.ToolResult, error) {
+	part, summary, err := loadImagePart(input.Path, input.Detail)
+	if err != nil {
+		return agent.ToolResult{}, err
+	}
+	return agent.ToolResult{
+		Text:  fmt.Sprintf("Loaded %s (%s). The image is attached below.", input.Path, summary),
+		Parts: []agent.OpenAIContentPart{agent.TextPart(fmt.Sprintf("<image path=%q/>", input.Path)), part},
+	}, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- 项目指令 --------------------------
+// 启动时收集指令文件，合并进系统提示：
+//   - 用户级：~/.config/gomockagent/AGENTS.md
+//   - 项目级：从仓库根目录（最近的含 .git 的上级目录）到当前目录，每一级的 AGENTS.md
+//   - Cursor 规则：同样每一级的 .cursor/rules/*.mdc，按 frontmatter 决定何时生效
+//     alwaysApply: true        合并进系统提示
+//     globs: "*.go, docs/**"   工具读取或修改匹配的文件时才注入对话（glob 相对于 .cursor 所在目录）
+//     两者都没有的规则需要手动引用，这里忽略
+//
+// 越靠近当前目录的文件越靠后，冲突时以它为准。配置 "disable_instructions": true 可关闭。
+
+const maxInstructionFileBytes = 32 << 10
+
+// projectRule 是只对部分文件生效的 Cursor 规则
+type projectRule struct {
+	name  string // 显示名称，例如 .cursor/rules/testing.mdc
+	base  string // glob 的基准目录
+	globs []*regexp.Regexp
+	text  string
+}
+
+// projectInstructions 是收集到的全部指令
+type projectInstructions struct {
+	always   []agent.Instruction
+	scoped   []projectRule
+	warnings []string
+}
+
+// ruleFrontmatter 是 .mdc 文件开头的 YAML
+type ruleFrontmatter struct {
+	Description string `yaml:"description"`
+	Globs       any    `yaml:"globs"` // "a, b" 或列表
+	AlwaysApply bool   `yaml:"alwaysApply"`
+}
+
+// loadProjectInstructions 从当前目录开始收集指令文件
+func loadProjectInstructions() *projectInstructions {
+	p := &projectInstructions{}
+	cwd, err := os.Getwd()
+	if err != nil {
+		p.warnings = append(p.warnings, err.Error())
+		return p
+	}
+	root := findRepoRoot(cwd)
+	if home, err := os.UserHomeDir(); err == nil {
+		p.addAgentsFile(filepath.Join(home, ".config", "gomockagent", "AGENTS.md"), "~/.config/gomockagent/AGENTS.md")
+	}
+	for _, dir := range dirsBetween(root, cwd) {
+		display := func(path string) string {
+			rel, _ := filepath.Rel(root, path)
+			return filepath.ToSlash(rel)
+		}
+		p.addAgentsFile(filepath.Join(dir, "AGENTS.md"), display(filepath.Join(dir, "AGENTS.md")))
+		rules, _ := filepath.Glob(filepath.Join(dir, ".cursor", "rules", "*.mdc"))
+		sort.Strings(rules)
+		for _, path := range rules {
+			p.addCursorRule(path, display(path), dir)
+		}
+	}
+	return p
+}
+
+// findRepoRoot 返回含 .git 的最近上级目录，找不到时返回 dir
+func findRepoRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// dirsBetween 返回从 root 到 dir（包含两端）的目录
+func dirsBetween(root, dir string) []string {
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+		if d == root || filepath.Dir(d) == d {
+			return dirs
+		}
+	}
+}
+
+// readInstructionFile 读取指令文件，过长时截断并记录警告；文件不存在时返回 false
+func (p *projectInstructions) readInstructionFile(path, name string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false
+	}
+	if err != nil {
+		p.warnings = append(p.warnings, fmt.Sprintf("skipping %s: %v", name, err))
+		return "", false
+	}
+	if len(data) > maxInstructionFileBytes {
+		data = data[:maxInstructionFileBytes]
+		p.warnings = append(p.warnings, fmt.Sprintf("%s truncated to %d KB", name, maxInstructionFileBytes>>10))
+	}
+	return string(data), true
+}
+
+func (p *projectInstructions) addAgentsFile(path, name string) {
+	if text, ok := p.readInstructionFile(path, name); ok && strings.TrimSpace(text) != "" {
+		p.always = append(p.always, agent.Instruction{Name: name, Text: text})
+	}
+}
+
+func (p *projectInstructions) addCursorRule(path, name, base string) {
+	text, ok := p.readInstructionFile(path, name)
+	if !ok {
+		return
+	}
+	front, body, err := parseFrontmatter(text)
+	if err != nil {
+		p.warnings = append(p.warnings, fmt.Sprintf("skipping %s: %v", name, err))
+		return
+	}
+	if strings.TrimSpace(body) == "" {
+		return
+	}
+	if front.AlwaysApply {
+		p.always = append(p.always, agent.Instruction{Name: name, Text: body})
+		return
+	}
+	var patterns []string
+	switch g := front.Globs.(type) {
+	case string:
+		patterns = strings.Split(g, ",")
+	case []any:
+		for _, v := range g {
+			patterns = append(patterns, fmt.Sprint(v))
+		}
+	}
+	rule := projectRule{name: name, base: base, text: body}
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			rule.globs = append(rule.globs, globRegexp(pattern))
+		}
+	}
+	if len(rule.globs) > 0 {
+		p.scoped = append(p.scoped, rule)
+	}
+}
+
+// parseFrontmatter 拆分 "---" 包围的 YAML frontmatter 与正文，没有 frontmatter 时正文为全文
+func parseFrontmatter(text string) (ruleFrontmatter, string, error) {
+	var front ruleFrontmatter
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return front, text, nil
+	}
+	rest := text[strings.Index(text, "\n")+1:]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return front, "", fmt.Errorf("unterminated frontmatter")
+	}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &front); err != nil {
+		return front, "", fmt.Errorf("invalid frontmatter: %w", err)
+	}
+	body := rest[end+len("\n---"):]
+	if i := strings.Index(body, "\n"); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	return front, body, nil
+}
+
+// globRegexp 把 glob 转换为正则：* 不跨目录，** 匹配任意层目录，{a,b} 匹配其一；
+// 不含 / 的模式匹配任意目录下的文件名
+func globRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(pattern, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	braces := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '{':
+			braces++
+			b.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			b.WriteString(")")
+		case c == ',' && braces > 0:
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return re
+}
+
+// systemPrompt 把总是生效的指令追加到 base 之后
+func (p *projectInstructions) systemPrompt(base string) string {
+	if len(p.always) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	b.WriteString("\n\n# Project instructions\n\nThe user and the project maintainers provided the following instructions. Later sections are more specific and take precedence.")
+	for _, in := range p.always {
+		fmt.Fprintf(&b, "\n\n## %s\n\n%s", in.Name, strings.TrimSpace(in.Text))
+	}
+	return b.String()
+}
+
+// forToolCall 返回与工具调用涉及的文件匹配的规则，用作 agent.Options.ScopedInstructions
+func (p *projectInstructions) forToolCall(call agent.ToolCallStarted) []agent.Instruction {
+	if len(p.scoped) == 0 {
+		return nil
+	}
+	var matched []agent.Instruction
+	for _, path := range toolCallPaths(call) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		for _, rule := range p.scoped {
+			rel, err := filepath.Rel(rule.base, abs)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			for _, re := range rule.globs {
+				if re.MatchString(filepath.ToSlash(rel)) {
+					matched = append(matched, agent.Instruction{Name: rule.name, Text: rule.text})
+					break
+				}
+			}
+		}
+	}
+	return matched
+}
+
+// toolCallPaths 提取工具参数中的文件路径：path / paths 字段，以及 apply_patch 补丁涉及的文件
+func toolCallPaths(call agent.ToolCallStarted) []string {
+	var args map[string]any
+	dec := json.NewDecoder(bytes.NewReader([]byte(call.Arguments)))
+	if dec.Decode(&args) != nil {
+		return nil
+	}
+	var paths []string
+	if p, ok := args["path"].(string); ok && p != "" {
+		paths = append(paths, p)
+	}
+	if list, ok := args["paths"].([]any); ok {
+		for _, v := range list {
+			if p, ok := v.(string); ok && p != "" {
+				paths = append(paths, p)
+			}
+		}
+	}
+	if patch, ok := args["patch"].(string); ok {
+		if files, err := parsePatch(patch); err == nil {
+			for _, f := range files {
+				for _, p := range []string{f.oldPath, f.newPath} {
+					if p != "" && p != "/dev/null" {
+						paths = append(paths, p)
+					}
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// loadedNames 返回已加载的指令文件，用于启动时提示
+func (p *projectInstructions) loadedNames() []string {
+	var names []string
+	for _, in := range p.always {
+		names = append(names, in.Name)
+	}
+	for _, rule := range p.scoped {
+		names = append(names, rule.name+" (scoped)")
+	}
+	return names
+}
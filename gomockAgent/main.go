@@ -3,12 +3,12 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
-	"github.com/go-resty/resty/v2"
+	"gomockAgent/agent"
 )
 
 // --- Configuration ---
@@ -17,185 +17,242 @@ var (
 	openaiAPIKey      = os.Getenv("OPENAI_API_KEY")                           // Use OPENAI_API_KEY now
 	openaiAPIEndpoint = os.Getenv("OPENAI_API_BASE") + "/v1/chat/completions" // Allow overriding base URL
 	openaiModel       = os.Getenv("OPENAI_MODEL")                             // Allow specifying model
-)
-
-type Agent struct {
-	restyClient    *resty.Client // Use standard HTTP client
-	getUserMessage func() (string, bool)
-	model          string                    // Store the target model name
-	tools          map[string]ToolDefinition // Map of tool names to tool definitions
-	systemPrompt   string                    // Store the system prompt
-}
-
-func NewAgent(
-	getUserMessage func() (string, bool),
-	model string,
-	tools []ToolDefinition,
-) *Agent {
-
-	restyClient := resty.New().SetTimeout(60 * time.Second)
-	toolMap := make(map[string]ToolDefinition)
-	for _, tool := range tools {
-		toolMap[tool.Name] = tool
-	}
-	return &Agent{
-		restyClient:    restyClient, // Add a timeout
-		getUserMessage: getUserMessage,
-		model:          model,
-		tools:          toolMap,
-		// Define the system prompt here or pass it in
-		systemPrompt: "You are a helpful Go programmer assistant. You have access to tools to interact with the local filesystem (read, list, edit files). Use them when appropriate to fulfill the user's request. When editing, be precise about the changes. Respond ONLY with tool calls if you need to use tools, otherwise respond with text.",
-	}
-}
 
-// callOpenAICompletion uses standard library http client
-func (a *Agent) callOpenAICompletion(ctx context.Context, conversation []OpenAIChatCompletionMessage) (*OpenAIChatCompletionResponse, error) {
-
-	// Prepare tools in OpenAI format
-	openaiTools := []OpenAIChatCompletionTool{}
-	for _, toolDef := range a.tools {
-		openaiTools = append(openaiTools, OpenAIChatCompletionTool{
-			Type: "function",
-			Function: OpenAIChatCompletionFunctionDefinition{
-				Name:        toolDef.Name,
-				Description: toolDef.Description,
-				Parameters:  toolDef.InputSchema,
-			},
-		})
-	}
-
-	// Build request payload
-	requestPayload := OpenAIChatCompletionRequest{
-		Model:       a.model,
-		Messages:    conversation,
-		Tools:       openaiTools,
-		ToolChoice:  "auto", // Let the model decide when to use tools
-		MaxTokens:   2048,   // Or make configurable
-		Temperature: 0.7,    // Reasonable default
-	}
-	reply := &OpenAIChatCompletionResponse{}
-	resp, err := a.restyClient.SetDebug(true).R().
-		SetContext(ctx).
-		SetBody(requestPayload).
-		SetAuthToken(openaiAPIKey).
-		SetResult(reply).
-		Post(openaiAPIEndpoint)
+	httpDebug = true // 打印请求与响应，全屏界面中关闭
+)
 
+// NewConfiguredAgent 按配置文件创建 Agent：profile、价格与预算、strict 工具
+func NewConfiguredAgent(tools []agent.ToolDefinition, config *Config) (*agent.Agent, error) {
+	profile, err := config.ActiveProfile()
 	if err != nil {
-		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+		return nil, err
 	}
+	instructions := &projectInstructions{}
+	if !config.DisableInstructions {
+		instructions = loadProjectInstructions()
+		for _, w := range instructions.warnings {
+			fmt.Fprintf(os.Stderr, "\u001b[93mWarning: %s\u001b[0m\n", w)
+		}
+		if names := instructions.loadedNames(); len(names) > 0 {
+			fmt.Fprintf(os.Stderr, "Info: loaded instructions from %s\n", strings.Join(names, ", "))
+		}
+	}
+	systemPrompt, examples := agent.DefaultSystemPrompt, []agent.OpenAIChatCompletionMessage(nil)
+	if r, err := renderPrompt("system", nil); err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[93mWarning: %v, using the default system prompt\u001b[0m\n", err)
+	} else {
+		systemPrompt, examples = r.Text, exampleMessages(r)
+	}
+	a := agent.New(agent.Options{
+		APIKey:      openaiAPIKey,
+		Endpoint:    openaiAPIEndpoint,
+		Model:       openaiModel,
+		Tools:       tools,
+		Profile:     &profile,
+		Prices:      config.Pricing,
+		Budget:      config.Budget,
+		StrictTools: config.StrictTools,
+		Debug:       httpDebug,
 
-	if resp.IsError() {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode(), string(resp.Body()))
+		SystemPrompt:       instructions.systemPrompt(systemPrompt),
+		Examples:           examples,
+		ScopedInstructions: instructions.forToolCall,
+	})
+	// 无法转换为 strict schema 的工具（例如参数含 map）保持普通模式
+	for name, err := range a.NonStrictTools() {
+		fmt.Fprintf(os.Stderr, "\u001b[93mWarning: tool %s is sent without strict mode: %v\u001b[0m\n", name, err)
 	}
+	// 文件检查点按会话与轮次记录
+	a.Subscribe(agent.SubscriberFunc(func(e agent.Event) {
+		if started, ok := e.(agent.TurnStarted); ok {
+			fileCheckpoints.Session(started.SessionID).BeginTurn(started.Prompt)
+		}
+	}))
+	return a, nil
+}
+
+// -------------------------- REPL --------------------------
 
-	return reply, nil
+// repl 是交互式入口：读取用户输入，处理斜杠命令，其余发送给会话
+type repl struct {
+	agent          *agent.Agent
+	session        *agent.Session
+	getUserMessage func() (string, bool)
 }
 
-func (a *Agent) Run(ctx context.Context) error {
+func newREPL(a *agent.Agent, getUserMessage func() (string, bool)) *repl {
+	return &repl{agent: a, session: a.NewSession(), getUserMessage: getUserMessage}
+}
 
-	conversation := []OpenAIChatCompletionMessage{
-		{Role: "system", Content: a.systemPrompt}, // Start with system prompt
-	}
-	fmt.Println("Chat with AI (use 'ctrl-c' to quit)")
+func (r *repl) Run(ctx context.Context) error {
+	r.session.Subscribe(agent.SubscriberFunc(printEvent))
+	fmt.Println("Chat with AI (use 'ctrl-c' to quit, /undo or /rewind <turn> to restore files, /usage for token costs, @path to attach files)")
 	for {
 		fmt.Print("\u001b[94mYou\u001b[0m: ") // Blue prompt for user
-		userMessage, ok := a.getUserMessage()
+		userMessage, ok := r.getUserMessage()
 		if !ok {
 			return fmt.Errorf("failed to get user message")
 		}
 		if userMessage == "" {
 			continue
 		}
-
-		conversation = append(conversation, OpenAIChatCompletionMessage{Role: "user", Content: userMessage})
-		// 如果需要使用工具，则需要多次调用OpenAI API
-		for {
-			resp, err := a.callOpenAICompletion(ctx, conversation)
-			if err != nil {
-				fmt.Printf("\u001b[91mAPI Error\u001b[0m: %s\n", err.Error())
-				break
-			}
-			// Process the response
-			if len(resp.Choices) == 0 {
-				fmt.Println("\u001b[91mError\u001b[0m: OpenAI response contained no choices.")
-				break // Break inner loop, let user re-prompt
-			}
-			assistantMessage := resp.Choices[0].Message
-
-			// Add assistant's message (text and/or tool calls) to conversation
-			conversation = append(conversation, assistantMessage)
-			// 如果返回了内容，则直接输出
-			if assistantMessage.Content != "" {
-				fmt.Printf("\u001b[93mAI\u001b[0m: %s\n", assistantMessage.Content) // Yellow for AI
-			}
-			if len(assistantMessage.ToolCalls) == 0 {
-				// No tools called, break inner loop and wait for next user input
-				break
-			}
-
-			// 如果返回了工具调用，则需要调用工具
-			// Execute tools and collect results
-			toolResults := []OpenAIChatCompletionMessage{}
-			for _, toolCall := range assistantMessage.ToolCalls {
-				if toolCall.Type != "function" {
-					continue // Skip non-function tool calls if any
+		if strings.HasPrefix(userMessage, "/") {
+			if note, handled := r.handleSlashCommand(userMessage); handled {
+				if note != "" {
+					r.session.AddNote(note)
 				}
+				continue
+			}
+		}
+		exp := expandMentions(userMessage)
+		if len(exp.attached) > 0 {
+			fmt.Printf("\u001b[90mAttached: %s\u001b[0m\n", strings.Join(exp.attached, ", "))
+		}
+		for _, w := range exp.warnings {
+			fmt.Printf("\u001b[93mWarning: %s\u001b[0m\n", w)
+		}
+		// 输出由 printEvent 完成，错误也已作为事件打印
+		_, _ = r.session.SendParts(ctx, userMessage, exp.parts)
+	}
+}
 
-				toolName := toolCall.Function.Name
-				toolArgs := toolCall.Function.Arguments // This is a JSON *string*
-
-				fmt.Printf("\u001b[92mTool Call\u001b[0m: %s(%s)\n", toolName, toolArgs) // Green
-				// 获取函数名称
-				toolDef, found := a.tools[toolName]
-				var resultMsg OpenAIChatCompletionMessage
-				if !found {
-					errorMsg := fmt.Sprintf("tool '%s' not found by agent", toolName)
-					fmt.Printf("\u001b[91mTool Error\u001b[0m: %s\n", errorMsg)
-					resultMsg = OpenAIChatCompletionMessage{
-						Role:       "tool",
-						ToolCallID: toolCall.ID,
-						Content:    errorMsg, // Report error back to OpenAI
-						Name:       toolName,
-					}
-				} else {
-					// Execute the actual tool function
-					// Note: toolArgs is a JSON string, pass it as json.RawMessage
-					// 执行函数
-					toolOutput, err := toolDef.Function(json.RawMessage(toolArgs))
-					if err != nil {
-						errorMsg := fmt.Sprintf("error executing tool '%s': %s", toolName, err.Error())
-						fmt.Printf("\u001b[91mTool Error\u001b[0m: %s\n", errorMsg)
-						resultMsg = OpenAIChatCompletionMessage{
-							Role:       "tool",
-							ToolCallID: toolCall.ID,
-							Content:    errorMsg, // Report error back to OpenAI
-							Name:       toolName,
-						}
-					} else {
-						// Log successful tool execution result (optional)
-						// fmt.Printf("\u001b[92mTool Result\u001b[0m: %s\n", toolOutput)
-						resultMsg = OpenAIChatCompletionMessage{
-							Role:       "tool",
-							ToolCallID: toolCall.ID,
-							Content:    toolOutput, // Send success result back to OpenAI
-							Name:       toolName,
-						}
-					}
-				}
-				toolResults = append(toolResults, resultMsg)
-			} // End of processing tool calls for one response
-			conversation = append(conversation, toolResults...)
+// printEvent 以彩色文本打印会话事件
+func printEvent(e agent.Event) {
+	switch e := e.(type) {
+	case agent.AssistantTextDelta:
+		fmt.Printf("\u001b[93mAI\u001b[0m: %s\n", e.Text) // Yellow for AI
+	case agent.ToolCallStarted:
+		if len(e.Repairs) > 0 {
+			fmt.Printf("\u001b[92mTool Call\u001b[0m: %s(%s)\n", e.Name, e.RawArguments) // Green
+			fmt.Printf("\u001b[93mRepaired Arguments\u001b[0m: %s -> %s\n", strings.Join(e.Repairs, ", "), e.Arguments)
+		} else {
+			fmt.Printf("\u001b[92mTool Call\u001b[0m: %s(%s)\n", e.Name, e.Arguments) // Green
+		}
+	case agent.ToolCallFinished:
+		if e.Error != "" {
+			fmt.Printf("\u001b[91mTool Error\u001b[0m: %s\n", e.Error)
+		}
+	case agent.Notice:
+		fmt.Printf("\u001b[93m%s\u001b[0m: %s\n", noticeTitle(e.Kind), e.Message)
+	case agent.ErrorEvent:
+		var budgetErr *agent.BudgetExceededError
+		var filterErr *agent.ContentFilterError
+		var refusalErr *agent.RefusalError
+		switch {
+		case errors.As(e.Err, &budgetErr):
+			fmt.Printf("\u001b[91mBudget Exceeded\u001b[0m: %s. Use /budget to raise it.\n", budgetErr.Reason)
+		case errors.As(e.Err, &filterErr):
+			fmt.Printf("\u001b[91mContent Filtered\u001b[0m: %s\n", filterErr.Error())
+		case errors.As(e.Err, &refusalErr):
+			fmt.Printf("\u001b[91mRefused\u001b[0m: %s\n", refusalErr.Refusal)
+		case errors.Is(e.Err, agent.ErrNoChoices):
+			fmt.Println("\u001b[91mError\u001b[0m: OpenAI response contained no choices.")
+		default:
+			fmt.Printf("\u001b[91mAPI Error\u001b[0m: %s\n", e.Message)
 		}
+	case agent.TurnFinished:
+		if e.Usage.Calls > 0 {
+			fmt.Printf("\u001b[90m[%d calls, %s]\u001b[0m\n", e.Usage.Calls, e.Usage)
+		}
+	}
+}
+
+func noticeTitle(kind string) string {
+	switch kind {
+	case "truncated_tool_call":
+		return "Truncated Tool Call"
+	case "truncated":
+		return "Truncated"
+	case "answer_rejected":
+		return "Answer Rejected"
+	case "instructions":
+		return "Project Rules"
+	case "memory":
+		return "Memory"
 	}
+	return "Warning"
 }
 
 func main() {
+	// --- Subcommands ---
+	if handled, err := runSubcommand(os.Args[1:]); handled {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\u001b[91mError: %s\u001b[0m\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	// --- Configuration Checks ---
-	if openaiAPIKey == "" {
-		fmt.Fprintln(os.Stderr, "\u001b[91mError: OPENAI_API_KEY environment variable not set.\u001b[0m")
+	if err := checkOpenAIConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[91mError: %s\u001b[0m\n", err.Error())
+		os.Exit(1)
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[91mError: %s\u001b[0m\n", err.Error())
 		os.Exit(1)
 	}
+	tui := useTUI()
+	getUserMessage := stdinReader()
+	if tui {
+		httpDebug = false // 请求日志会淹没对话记录
+	} else {
+		askUser = func(question string) (string, bool) {
+			fmt.Print(question)
+			return getUserMessage()
+		}
+	}
+	tools := builtinTools(config)
+	mcpTools, closeMCP := LoadMCPTools(context.Background(), config.MCPServers, tools)
+	defer closeMCP()
+	tools = append(tools, mcpTools...)
+	a, err := NewConfiguredAgent(tools, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[91mError: %s\u001b[0m\n", err.Error())
+		closeMCP()
+		os.Exit(1)
+	}
+	r := newREPL(a, getUserMessage)
+	if tui {
+		err = runTUI(r)
+	} else {
+		err = r.Run(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[91mAgent exited with error: %s\u001b[0m\n", err.Error())
+		closeMCP()
+		os.Exit(1)
+	}
+}
+
+// builtinTools 返回内置工具定义，REPL 与 mcp-serve 共用
+func builtinTools(config *Config) []agent.ToolDefinition {
+	return []agent.ToolDefinition{
+		ReadFileDefinition,
+		ListFilesDefinition,
+		ViewImageDefinition,
+		EditFileDefinition,
+		ApplyPatchDefinition,
+		GetMergeDiffDefinition,
+		GitStatusDefinition,
+		GitDiffDefinition,
+		GitLogDefinition,
+		GitBlameDefinition,
+		GitShowDefinition,
+		MutationTestDefinition,
+		GenerateFuzzTestDefinition,
+		RunFuzzDefinition,
+		GenerateBenchmarkDefinition,
+		RunBenchmarkDefinition,
+		NewGitCommitDefinition(config.Commit),
+	}
+}
+
+// checkOpenAIConfig 校验并补全 OpenAI 相关的环境变量配置
+func checkOpenAIConfig() error {
+	if openaiAPIKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
 	if os.Getenv("OPENAI_API_BASE") == "" {
 		// Default to official OpenAI endpoint if base URL not set
 		openaiAPIEndpoint = "https://api.openai.com/v1/chat/completions"
@@ -207,8 +264,17 @@ func main() {
 		fmt.Printf("Info: OPENAI_MODEL not set, defaulting to %s\n", openaiModel)
 	}
 	fmt.Printf(" openapibase: %s\n", openaiAPIEndpoint)
+	return nil
+}
+
+// maxInputLineBytes 是一行输入的最大长度，粘贴的大段代码也在一行之内
+const maxInputLineBytes = 16 << 20
+
+// stdinReader 返回逐行读取标准输入的函数，输入 exit 或 EOF 时返回 false
+func stdinReader() func() (string, bool) {
 	scanner := bufio.NewScanner(os.Stdin)
-	getUserMessage := func() (string, bool) {
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInputLineBytes)
+	return func() (string, bool) {
 		if !scanner.Scan() {
 			if err := scanner.Err(); err != nil {
 				fmt.Fprintf(os.Stderr, "\u001b[91mError reading input: %v\u001b[0m\n", err)
@@ -221,16 +287,4 @@ func main() {
 		}
 		return scanner.Text(), true
 	}
-	// 工具定义
-	tools := []ToolDefinition{
-		ReadFileDefinition,
-		ListFilesDefinition,
-		GetMergeDiffDefinition,
-	}
-	agent := NewAgent(getUserMessage, openaiModel, tools)
-	err := agent.Run(context.Background())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "\u001b[91mAgent exited with error: %s\u001b[0m\n", err.Error())
-		os.Exit(1)
-	}
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// -------------------------- Model Context Protocol --------------------------
+// MCP 基于 JSON-RPC 2.0。这里定义客户端与服务端共用的消息结构。
+// 参考 https://modelcontextprotocol.io/specification
+
+const (
+	mcpProtocolVersion = "2025-03-26"
+	mcpClientName      = "gomockAgent"
+	mcpClientVersion   = "0.1.0"
+)
+
+// JSON-RPC 标准错误码
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+)
+
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // 请求没有 id 时为通知
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+func (m *jsonrpcMessage) isRequest() bool      { return m.Method != "" && len(m.ID) > 0 }
+func (m *jsonrpcMessage) isNotification() bool { return m.Method != "" && len(m.ID) == 0 }
+func (m *jsonrpcMessage) isResponse() bool     { return m.Method == "" && len(m.ID) > 0 }
+
+type mcpImplementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type mcpInitializeParams struct {
+	ProtocolVersion string            `json:"protocolVersion"`
+	Capabilities    map[string]any    `json:"capabilities"`
+	ClientInfo      mcpImplementation `json:"clientInfo"`
+}
+
+type mcpInitializeResult struct {
+	ProtocolVersion string            `json:"protocolVersion"`
+	Capabilities    map[string]any    `json:"capabilities"`
+	ServerInfo      mcpImplementation `json:"serverInfo"`
+	Instructions    string            `json:"instructions,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type mcpListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type mcpListToolsResult struct {
+	Tools      []mcpTool `json:"tools"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+type mcpCallToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type mcpContent struct {
+	Type     string          `json:"type"` // text, image, audio, resource
+	Text     string          `json:"text,omitempty"`
+	Data     string          `json:"data,omitempty"` // base64
+	MimeType string          `json:"mimeType,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+}
+
+type mcpCallToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent any          `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- MCP 客户端 --------------------------
+// 按配置连接 MCP 服务器（stdio 或 streamable HTTP），列出其工具并包装成 ToolDefinition，
+// 调用时通过 JSON-RPC 转发，无需重新编译即可复用 MCP 生态中的工具。
+
+const defaultMCPTimeout = 60 * time.Second
+
+// mcpTransport 负责发送 JSON-RPC 消息并返回对应的响应
+type mcpTransport interface {
+	call(ctx context.Context, msg *jsonrpcMessage) (*jsonrpcMessage, error)
+	notify(ctx context.Context, msg *jsonrpcMessage) error
+	close() error
+}
+
+// MCPClient 是与单个 MCP 服务器的会话
+type MCPClient struct {
+	name      string
+	transport mcpTransport
+	timeout   time.Duration
+	nextID    atomic.Int64
+	info      mcpInitializeResult
+}
+
+// NewMCPClient 按配置建立连接并完成 initialize 握手
+func NewMCPClient(ctx context.Context, name string, cfg MCPServerConfig) (*MCPClient, error) {
+	var transport mcpTransport
+	var err error
+	switch {
+	case cfg.Command != "":
+		transport, err = newMCPStdioTransport(cfg)
+	case cfg.URL != "":
+		transport = newMCPHTTPTransport(cfg)
+	default:
+		return nil, fmt.Errorf("mcp server %q: either 'command' or 'url' must be set", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %q: %w", name, err)
+	}
+
+	c := &MCPClient{name: name, transport: transport, timeout: defaultMCPTimeout}
+	if cfg.TimeoutSeconds > 0 {
+		c.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	if err := c.initialize(ctx); err != nil {
+		transport.close()
+		return nil, fmt.Errorf("mcp server %q: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *MCPClient) request(ctx context.Context, method string, params, result any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s params: %w", method, err)
+	}
+	id, _ := json.Marshal(c.nextID.Add(1))
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.transport.call(ctx, &jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: raw})
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *MCPClient) initialize(ctx context.Context) error {
+	err := c.request(ctx, "initialize", mcpInitializeParams{
+		ProtocolVersion: mcpProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      mcpImplementation{Name: mcpClientName, Version: mcpClientVersion},
+	}, &c.info)
+	if err != nil {
+		return err
+	}
+	if h, ok := c.transport.(*mcpHTTPTransport); ok {
+		h.protocolVersion = c.info.ProtocolVersion
+	}
+	return c.transport.notify(ctx, &jsonrpcMessage{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// ListTools 拉取服务器的全部工具（处理分页）
+func (c *MCPClient) ListTools(ctx context.Context) ([]mcpTool, error) {
+	var tools []mcpTool
+	cursor := ""
+	for {
+		var page mcpListToolsResult
+		if err := c.request(ctx, "tools/list", mcpListToolsParams{Cursor: cursor}, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool 调用工具并把返回内容转换成文本
+func (c *MCPClient) CallTool(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var result mcpCallToolResult
+	if err := c.request(ctx, "tools/call", mcpCallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return "", err
+	}
+	text := mcpContentText(result)
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// mcpContentText 把各种内容块展开为模型可读的文本
+func mcpContentText(result mcpCallToolResult) string {
+	var parts []string
+	for _, c := range result.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			var res struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			}
+			_ = json.Unmarshal(c.Resource, &res)
+			if res.Text != "" {
+				parts = append(parts, fmt.Sprintf("[resource %s]\n%s", res.URI, res.Text))
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s]", res.URI))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data)))
+		}
+	}
+	if len(parts) == 0 && result.StructuredContent != nil {
+		b, _ := json.Marshal(result.StructuredContent)
+		parts = append(parts, string(b))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (c *MCPClient) Close() error {
+	return c.transport.close()
+}
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// mcpToolName 生成符合 OpenAI 函数名要求（^[a-zA-Z0-9_-]{1,64}$）且不在 taken 中的名字。
+// 替换字符或截断后与已有工具重名时，加上由服务器名与原工具名计算的短哈希；仍然重名时返回 false
+func mcpToolName(server, tool string, taken map[string]bool) (string, bool) {
+	name := invalidToolNameChars.ReplaceAllString(server+"__"+tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if !taken[name] {
+		return name, true
+	}
+	sum := sha256.Sum256([]byte(server + "\x00" + tool))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	name = name[:min(len(name), 64-len(suffix))] + suffix
+	return name, !taken[name]
+}
+
+// ToolDefinitions 把服务器的工具包装成 ToolDefinition；taken 是已经使用的工具名，新的名字会加入其中
+func (c *MCPClient) ToolDefinitions(ctx context.Context, taken map[string]bool) ([]agent.ToolDefinition, error) {
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]agent.ToolDefinition, 0, len(tools))
+	for _, t := range tools {
+		name, ok := mcpToolName(c.name, t.Name, taken)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "\u001b[91mWarning\u001b[0m: mcp server %q: skipping tool %q, its name %s is already in use\n", c.name, t.Name, name)
+			continue
+		}
+		taken[name] = true
+		schema := t.InputSchema
+		if schema == nil {
+			schema = map[string]any{}
+		}
+		schema["type"] = "object" // Ensure root type is object
+		if _, ok := schema["properties"]; !ok {
+			schema["properties"] = map[string]any{}
+		}
+		toolName := t.Name
+		defs = append(defs, agent.ToolDefinition{
+			Name:        name,
+			Description: strings.TrimSpace(fmt.Sprintf("[MCP server %s] %s", c.name, t.Description)),
+			InputSchema: schema,
+			Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+				return c.CallTool(ctx, toolName, input)
+			},
+		})
+	}
+	return defs, nil
+}
+
+// LoadMCPTools 连接配置中的全部 MCP 服务器。单个服务器失败只打印警告，不影响其他服务器。
+// builtin 是已注册的工具，MCP 工具不会与它们或彼此重名。返回的 closeAll 用于退出时断开连接。
+func LoadMCPTools(ctx context.Context, servers map[string]MCPServerConfig, builtin []agent.ToolDefinition) ([]agent.ToolDefinition, func()) {
+	taken := make(map[string]bool, len(builtin))
+	for _, t := range builtin {
+		taken[t.Name] = true
+	}
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tools []agent.ToolDefinition
+	var clients []*MCPClient
+	for _, name := range names {
+		cfg := servers[name]
+		if cfg.Disabled {
+			continue
+		}
+		client, err := NewMCPClient(ctx, name, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\u001b[91mWarning\u001b[0m: %s\n", err)
+			continue
+		}
+		defs, err := client.ToolDefinitions(ctx, taken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\u001b[91mWarning\u001b[0m: mcp server %q: %s\n", name, err)
+			client.Close()
+			continue
+		}
+		fmt.Printf("Info: loaded %d tool(s) from MCP server %s (%s)\n", len(defs), name, client.info.ServerInfo.Name)
+		tools = append(tools, defs...)
+		clients = append(clients, client)
+	}
+	closeAll := func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}
+	return tools, closeAll
+}
+
+// -------------------------- stdio transport --------------------------
+// 每条消息是一行 JSON，写入子进程 stdin，从 stdout 读取。
+
+type mcpStdioTransport struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *jsonrpcMessage
+	done    chan struct{}
+	readErr error
+}
+
+func newMCPStdioTransport(cfg MCPServerConfig) (*mcpStdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+	t := &mcpStdioTransport{cmd: cmd, stdin: stdin, pending: map[string]chan *jsonrpcMessage{}, done: make(chan struct{})}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *mcpStdioTransport) readLoop(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	var err error
+	for {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			t.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	t.mu.Lock()
+	t.readErr = fmt.Errorf("server closed the connection: %w", err)
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *mcpStdioTransport) dispatch(line []byte) {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return // 忽略服务器输出的非 JSON-RPC 内容
+	}
+	switch {
+	case msg.isResponse():
+		t.mu.Lock()
+		ch, ok := t.pending[string(msg.ID)]
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+	case msg.isRequest():
+		// 客户端不提供 sampling/roots 等能力，只回应 ping
+		reply := &jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			reply.Result = json.RawMessage("{}")
+		} else {
+			reply.Error = &jsonrpcError{Code: jsonrpcMethodNotFound, Message: "method not supported by client: " + msg.Method}
+		}
+		_ = t.write(reply)
+	}
+}
+
+func (t *mcpStdioTransport) write(msg *jsonrpcMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+func (t *mcpStdioTransport) call(ctx context.Context, msg *jsonrpcMessage) (*jsonrpcMessage, error) {
+	ch := make(chan *jsonrpcMessage, 1)
+	t.mu.Lock()
+	t.pending[string(msg.ID)] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(msg); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.readErr
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *mcpStdioTransport) notify(ctx context.Context, msg *jsonrpcMessage) error {
+	return t.write(msg)
+}
+
+func (t *mcpStdioTransport) close() error {
+	t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+	}
+	return t.cmd.Wait()
+}
+
+// -------------------------- streamable HTTP transport --------------------------
+// 每条消息单独 POST；响应可能是 application/json，也可能是 text/event-stream。
+
+type mcpHTTPTransport struct {
+	url             string
+	headers         map[string]string
+	client          *http.Client
+	sessionID       string
+	protocolVersion string
+	mu              sync.Mutex
+}
+
+func newMCPHTTPTransport(cfg MCPServerConfig) *mcpHTTPTransport {
+	headers := map[string]string{}
+	for k, v := range cfg.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	return &mcpHTTPTransport{url: cfg.URL, headers: headers, client: &http.Client{}}
+}
+
+func (t *mcpHTTPTransport) post(ctx context.Context, msg *jsonrpcMessage) (*http.Response, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("MCP request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (t *mcpHTTPTransport) call(ctx context.Context, msg *jsonrpcMessage) (*jsonrpcMessage, error) {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var reply jsonrpcMessage
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return &reply, nil
+	}
+
+	// SSE：逐个事件读取，直到拿到与请求 id 匹配的响应
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			continue
+		}
+		var reply jsonrpcMessage
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &reply)
+		data = nil
+		if err == nil && reply.isResponse() && string(reply.ID) == string(msg.ID) {
+			return &reply, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event stream: %w", err)
+	}
+	return nil, fmt.Errorf("event stream ended without a response to request %s", msg.ID)
+}
+
+func (t *mcpHTTPTransport) notify(ctx context.Context, msg *jsonrpcMessage) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// close 通过 DELETE 结束服务端会话
+func (t *mcpHTTPTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
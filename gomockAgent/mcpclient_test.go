@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMCPToolNameCollisions(t *testing.T) {
+	taken := map[string]bool{"read_file": true}
+	long := strings.Repeat("x", 70)
+
+	first, ok := mcpToolName("srv", long+"_a", taken)
+	if !ok || len(first) != 64 {
+		t.Fatalf("first = %q, %v", first, ok)
+	}
+	taken[first] = true
+	second, ok := mcpToolName("srv", long+"_b", taken)
+	if !ok || second == first || len(second) > 64 {
+		t.Fatalf("truncated names must be disambiguated: %q and %q", first, second)
+	}
+
+	taken["a__b"] = true
+	if name, ok := mcpToolName("a", "b", taken); !ok || name == "a__b" {
+		t.Fatalf("name clashing with an existing tool was not disambiguated: %q", name)
+	}
+	if name, ok := mcpToolName("a", "b", taken); !ok || name != mustName(t, "a", "b", taken) {
+		t.Fatalf("disambiguated names must be stable, got %q", name)
+	}
+	taken[mustName(t, "a", "b", taken)] = true
+	if _, ok := mcpToolName("a", "b", taken); ok {
+		t.Fatal("expected the tool to be skipped when the hashed name is taken too")
+	}
+}
+
+func mustName(t *testing.T, server, tool string, taken map[string]bool) string {
+	t.Helper()
+	name, ok := mcpToolName(server, tool, taken)
+	if !ok {
+		t.Fatalf("no name for %s/%s", server, tool)
+	}
+	return name
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- MCP 服务端 --------------------------
+// gomockAgent mcp-serve：通过 stdio 把内置工具作为 MCP 服务暴露给其他 IDE 与 agent。
+// 工具的 InputSchema 直接作为 MCP 的 inputSchema。
+
+// supportedMCPVersions 是服务端接受的协议版本，按新旧排列
+var supportedMCPVersions = []string{mcpProtocolVersion, "2024-11-05"}
+
+type MCPServer struct {
+	tools []agent.ToolDefinition
+	index map[string]agent.ToolDefinition
+
+	out     io.Writer
+	writeMu sync.Mutex
+	wg      sync.WaitGroup
+}
+
+func NewMCPServer(tools []agent.ToolDefinition) *MCPServer {
+	index := make(map[string]agent.ToolDefinition, len(tools))
+	for _, t := range tools {
+		index[t.Name] = t
+	}
+	return &MCPServer{tools: tools, index: index}
+}
+
+// Serve 从 in 逐行读取 JSON-RPC 消息，响应写入 out，直到 in 关闭或 ctx 取消
+func (s *MCPServer) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	reader := bufio.NewReader(in)
+	defer s.wg.Wait()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			s.handleLine(ctx, line)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+	}
+}
+
+func (s *MCPServer) handleLine(ctx context.Context, line []byte) {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		s.reply(&jsonrpcMessage{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &jsonrpcError{Code: jsonrpcParseError, Message: err.Error()}})
+		return
+	}
+	switch {
+	case msg.isNotification(), msg.isResponse():
+		return // notifications/initialized、取消通知等无需响应
+	case !msg.isRequest():
+		s.reply(&jsonrpcMessage{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &jsonrpcError{Code: jsonrpcInvalidRequest, Message: "invalid request"}})
+		return
+	}
+
+	// 工具可能运行很久，每个请求单独处理，避免阻塞 ping 等消息
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		result, rpcErr := s.handleRequest(ctx, &msg)
+		resp := &jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+		if rpcErr == nil {
+			raw, err := json.Marshal(result)
+			if err != nil {
+				resp.Error = &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+			} else {
+				resp.Result = raw
+			}
+		}
+		s.reply(resp)
+	}()
+}
+
+func (s *MCPServer) handleRequest(ctx context.Context, msg *jsonrpcMessage) (any, *jsonrpcError) {
+	switch msg.Method {
+	case "initialize":
+		var params mcpInitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+		}
+		version := mcpProtocolVersion
+		for _, v := range supportedMCPVersions {
+			if v == params.ProtocolVersion {
+				version = v
+			}
+		}
+		return mcpInitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]any{"tools": map[string]any{"listChanged": false}},
+			ServerInfo:      mcpImplementation{Name: mcpClientName, Version: mcpClientVersion},
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		tools := make([]mcpTool, 0, len(s.tools))
+		for _, t := range s.tools {
+			tools = append(tools, mcpTool{Name: t.Name, Description: t.Description, InputSchema: t.InputSchema})
+		}
+		return mcpListToolsResult{Tools: tools}, nil
+
+	case "tools/call":
+		var params mcpCallToolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+		}
+		tool, ok := s.index[params.Name]
+		if !ok {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("unknown tool: %s", params.Name)}
+		}
+		args := params.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		// 工具执行失败按 MCP 约定放在结果里（isError），让调用方的模型看到错误
+		result, err := tool.Call(ctx, args)
+		if err != nil {
+			return mcpCallToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		content := []mcpContent{{Type: "text", Text: result.Text}}
+		for _, part := range result.Parts {
+			content = append(content, mcpContentFromPart(part))
+		}
+		return mcpCallToolResult{Content: content}, nil
+	}
+	return nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func (s *MCPServer) reply(msg *jsonrpcMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, _ = s.out.Write(append(b, '\n'))
+}
+
+// runMCPServeCommand 实现 gomockAgent mcp-serve
+func runMCPServeCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: gomockAgent mcp-serve")
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	// stdout 专用于协议消息，工具里零散的打印改写到 stderr
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = protocolOut }()
+
+	server := NewMCPServer(builtinTools(config))
+	return server.Serve(context.Background(), os.Stdin, protocolOut)
+}
+
+// mcpContentFromPart 把工具返回的多模态内容转换为 MCP 内容块，图片 data URL 拆分为 mimeType 与 base64 数据
+func mcpContentFromPart(part agent.OpenAIContentPart) mcpContent {
+	switch part.Type {
+	case "image_url":
+		if rest, ok := strings.CutPrefix(part.ImageURL.URL, "data:"); ok {
+			if mimeType, data, ok := strings.Cut(rest, ";base64,"); ok {
+				return mcpContent{Type: "image", Data: data, MimeType: mimeType}
+			}
+		}
+		return mcpContent{Type: "text", Text: part.ImageURL.URL}
+	case "input_audio":
+		return mcpContent{Type: "audio", Data: part.InputAudio.Data, MimeType: "audio/" + part.InputAudio.Format}
+	}
+	return mcpContent{Type: "text", Text: part.Text}
+}
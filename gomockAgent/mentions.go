@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- @ 引用 --------------------------
+// 用户输入中的 @path 在发送前展开为附加在消息后的上下文块，不必等模型自己调用 read_file：
+//
+//	@main.go              整个文件
+//	@agent/session.go#L10-40  第 10 到 40 行（#L10 表示单独一行）
+//	@agent/               目录下的文件列表
+//	@screenshot.png       图片，以 image_url 内容发送给支持视觉的模型
+//
+// 不存在的路径保持原样（例如邮箱或 @用户名）。超出大小限制的内容被截断或跳过，并提示用户。
+
+const (
+	maxMentionFileBytes  = 64 << 10  // 单个文件附加的最大字节数，超出部分截断
+	maxMentionTotalBytes = 256 << 10 // 一条消息附加的文本总量，超出后的引用被跳过
+	maxMentionDirEntries = 200
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([^\s#@]+)(?:#L(\d+)(?:-L?(\d+))?)?`)
+
+// mentionExpansion 是展开 @ 引用的结果
+type mentionExpansion struct {
+	parts    []agent.OpenAIContentPart // 附加在用户消息后的内容
+	attached []string                  // 已附加的引用，用于提示用户
+	warnings []string
+}
+
+// expandMentions 展开 input 中的 @ 引用，input 本身原样作为用户消息
+func expandMentions(input string) mentionExpansion {
+	var exp mentionExpansion
+	total := 0
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		path, from, to := m[1], m[2], m[3]
+		info, err := os.Stat(path)
+		if err != nil {
+			// 句末的标点不属于路径
+			trimmed := strings.TrimRight(path, ".,;:!?)'\"")
+			if trimmed == path || trimmed == "" {
+				continue
+			}
+			if info, err = os.Stat(trimmed); err != nil {
+				continue
+			}
+			path = trimmed
+		}
+		key := path + "#" + from + "-" + to
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		switch {
+		case info.IsDir():
+			block, err := mentionDirBlock(path)
+			if err != nil {
+				exp.warnings = append(exp.warnings, err.Error())
+				continue
+			}
+			if total+len(block) > maxMentionTotalBytes {
+				exp.warnings = append(exp.warnings, fmt.Sprintf("@%s skipped: attachments exceed %d KB", path, maxMentionTotalBytes>>10))
+				continue
+			}
+			total += len(block)
+			exp.parts = append(exp.parts, agent.TextPart(block))
+			exp.attached = append(exp.attached, path)
+
+		case isImagePath(path):
+			part, _, err := loadImagePart(path, "")
+			if err != nil {
+				exp.warnings = append(exp.warnings, fmt.Sprintf("@%s skipped: %v", path, err))
+				continue
+			}
+			exp.parts = append(exp.parts, agent.TextPart(fmt.Sprintf("<image path=%q/>", path)), part)
+			exp.attached = append(exp.attached, path)
+
+		default:
+			block, warning, err := mentionFileBlock(path, from, to)
+			if err != nil {
+				exp.warnings = append(exp.warnings, err.Error())
+				continue
+			}
+			if total+len(block) > maxMentionTotalBytes {
+				exp.warnings = append(exp.warnings, fmt.Sprintf("@%s skipped: attachments exceed %d KB", path, maxMentionTotalBytes>>10))
+				continue
+			}
+			if warning != "" {
+				exp.warnings = append(exp.warnings, warning)
+			}
+			total += len(block)
+			exp.parts = append(exp.parts, agent.TextPart(block))
+			label := path
+			if from != "" {
+				label += "#L" + from
+				if to != "" {
+					label += "-" + to
+				}
+			}
+			exp.attached = append(exp.attached, label)
+		}
+	}
+	return exp
+}
+
+// mentionFileBlock 读取文件（或其中的行范围）并包装为 <file> 块
+func mentionFileBlock(path, from, to string) (block, warning string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("@%s skipped: %w", path, err)
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", "", fmt.Errorf("@%s skipped: binary file", path)
+	}
+
+	lines := ""
+	if from != "" {
+		start, _ := strconv.Atoi(from)
+		end := start
+		if to != "" {
+			end, _ = strconv.Atoi(to)
+		}
+		all := strings.SplitAfter(string(data), "\n")
+		if start < 1 || start > len(all) || end < start {
+			return "", "", fmt.Errorf("@%s#L%s skipped: the file has %d lines", path, from, len(all))
+		}
+		end = min(end, len(all))
+		data = []byte(strings.Join(all[start-1:end], ""))
+		lines = fmt.Sprintf(" lines=\"%d-%d\"", start, end)
+	}
+
+	if len(data) > maxMentionFileBytes {
+		data = data[:maxMentionFileBytes]
+		if i := bytes.LastIndexByte(data, '\n'); i > 0 {
+			data = data[:i+1]
+		}
+		warning = fmt.Sprintf("@%s truncated to %d KB, use a line range such as @%s#L1-200 to attach another part", path, maxMentionFileBytes>>10, path)
+		lines += ` truncated="true"`
+	}
+	content := strings.TrimSuffix(string(data), "\n")
+	return fmt.Sprintf("<file path=%q%s>\n%s\n</file>", path, lines, content), warning, nil
+}
+
+// mentionDirBlock 列出目录下的文件（跳过隐藏目录）并包装为 <directory> 块
+func mentionDirBlock(dir string) (string, error) {
+	var entries []string
+	truncated := false
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if rel == "." {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(entries) == maxMentionDirEntries {
+			truncated = true
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			rel += "/"
+		}
+		entries = append(entries, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("@%s skipped: %w", dir, err)
+	}
+	if truncated {
+		entries = append(entries, fmt.Sprintf("… (only the first %d entries are listed)", maxMentionDirEntries))
+	}
+	return fmt.Sprintf("<directory path=%q>\n%s\n</directory>", dir, strings.Join(entries, "\n")), nil
+}
+
+// completeMention 补全 input 末尾的 @ 引用。只有一个候选时直接补全（目录补全到 "/"），
+// 多个候选时补全到公共前缀并返回候选列表；末尾不是 @ 引用时 ok 为 false
+func completeMention(input string) (completed string, candidates []string, ok bool) {
+	start := strings.LastIndexAny(input, " \t\n") + 1
+	token := input[start:]
+	if !strings.HasPrefix(token, "@") || strings.Contains(token, "#") {
+		return input, nil, false
+	}
+	prefix := token[1:]
+	dir, base := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir, base = prefix[:i+1], prefix[i+1:]
+	}
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return input, nil, true
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		candidates = append(candidates, dir+name)
+	}
+	if len(candidates) == 0 {
+		return input, nil, true
+	}
+	sort.Strings(candidates)
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	completed = input[:start] + "@" + common
+	if len(candidates) == 1 {
+		if !strings.HasSuffix(common, "/") {
+			completed += " "
+		}
+		return completed, nil, true
+	}
+	return completed, candidates, true
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- mutation testing --------------------------
+// 通过在 AST 层面制造变异体（翻转条件、修改常量、删除语句），
+// 用包自身的测试去"杀死"变异体，以此衡量生成的测试是否真正有效。
+// 变异体通过 `go test -overlay` 注入，不会修改磁盘上的源码。
+
+// MutationKind 标识变异算子类型
+type MutationKind string
+
+const (
+	MutationFlipCondition   MutationKind = "flip_condition"
+	MutationChangeConstant  MutationKind = "change_constant"
+	MutationRemoveStatement MutationKind = "remove_statement"
+)
+
+// MutantStatus 是单个变异体的测试结果
+type MutantStatus string
+
+const (
+	MutantKilled   MutantStatus = "killed"   // 测试失败，变异被发现
+	MutantSurvived MutantStatus = "survived" // 测试仍然通过，测试存在盲区
+	MutantTimeout  MutantStatus = "timeout"  // 测试超时，按被杀死计算
+	MutantUnviable MutantStatus = "unviable" // 变异后无法编译，不计入分数
+)
+
+// Mutant 描述一次源码替换
+type Mutant struct {
+	ID       int          `json:"id"`
+	Kind     MutationKind `json:"kind"`
+	File     string       `json:"file"`
+	Line     int          `json:"line"`
+	Column   int          `json:"column"`
+	Original string       `json:"original"`
+	Mutated  string       `json:"mutated"`
+	Status   MutantStatus `json:"status,omitempty"`
+
+	offset int // 原文件中的字节偏移
+	end    int
+}
+
+// MutationOptions 控制一次变异测试
+type MutationOptions struct {
+	MaxMutants int           // 0 表示不限制
+	Timeout    time.Duration // 单个变异体的测试超时
+}
+
+// MutationReport 是变异测试的汇总结果
+type MutationReport struct {
+	Package   string    `json:"package"`
+	Total     int       `json:"total"`
+	Killed    int       `json:"killed"`
+	Survived  int       `json:"survived"`
+	Timeout   int       `json:"timeout"`
+	Unviable  int       `json:"unviable"`
+	Score     float64   `json:"score"` // (killed+timeout) / (total-unviable)
+	Survivors []*Mutant `json:"survivors"`
+	Mutants   []*Mutant `json:"mutants"`
+}
+
+var flippedOperators = map[token.Token]token.Token{
+	token.EQL:  token.NEQ,
+	token.NEQ:  token.EQL,
+	token.LSS:  token.GEQ,
+	token.GEQ:  token.LSS,
+	token.GTR:  token.LEQ,
+	token.LEQ:  token.GTR,
+	token.LAND: token.LOR,
+	token.LOR:  token.LAND,
+}
+
+// FindMutants 解析目录下的非测试 Go 文件并列出所有变异点
+func FindMutants(dir string) ([]*Mutant, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse package in '%s': %w", dir, err)
+	}
+
+	var mutants []*Mutant
+	for _, pkg := range pkgs {
+		for fileName, file := range pkg.Files {
+			mutants = append(mutants, mutantsInFile(fset, fileName, file)...)
+		}
+	}
+	sort.SliceStable(mutants, func(i, j int) bool {
+		if mutants[i].File != mutants[j].File {
+			return mutants[i].File < mutants[j].File
+		}
+		return mutants[i].offset < mutants[j].offset
+	})
+	for i, m := range mutants {
+		m.ID = i + 1
+	}
+	return mutants, nil
+}
+
+func mutantsInFile(fset *token.FileSet, fileName string, file *ast.File) []*Mutant {
+	var mutants []*Mutant
+	add := func(kind MutationKind, from, to token.Pos, original, mutated string) {
+		p := fset.Position(from)
+		mutants = append(mutants, &Mutant{
+			Kind:     kind,
+			File:     fileName,
+			Line:     p.Line,
+			Column:   p.Column,
+			Original: original,
+			Mutated:  mutated,
+			offset:   p.Offset,
+			end:      fset.Position(to).Offset,
+		})
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.GenDecl:
+			// 常量声明中的字面量改动通常导致编译失败，直接跳过
+			if node.Tok == token.CONST || node.Tok == token.IMPORT {
+				return false
+			}
+		case *ast.BinaryExpr:
+			if flipped, ok := flippedOperators[node.Op]; ok {
+				op := node.Op.String()
+				add(MutationFlipCondition, node.OpPos, node.OpPos+token.Pos(len(op)), op, flipped.String())
+			}
+		case *ast.BasicLit:
+			if mutated, ok := mutateLiteral(node); ok {
+				add(MutationChangeConstant, node.Pos(), node.End(), node.Value, mutated)
+			}
+		case *ast.BlockStmt:
+			for _, stmt := range node.List {
+				if removable(stmt) {
+					add(MutationRemoveStatement, stmt.Pos(), stmt.End(), firstLine(fset, stmt), "")
+				}
+			}
+		}
+		return true
+	})
+	return mutants
+}
+
+// mutateLiteral 只修改整数字面量：0 变为 1，其余加 1
+func mutateLiteral(lit *ast.BasicLit) (string, bool) {
+	if lit.Kind != token.INT {
+		return "", false
+	}
+	v, err := strconv.ParseInt(lit.Value, 0, 64)
+	if err != nil {
+		return "", false
+	}
+	if v == 0 {
+		return "1", true
+	}
+	return strconv.FormatInt(v+1, 10), true
+}
+
+// removable 只删除不会引入未使用变量的语句
+func removable(stmt ast.Stmt) bool {
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		_, isCall := s.X.(*ast.CallExpr)
+		return isCall
+	case *ast.IncDecStmt:
+		return true
+	case *ast.AssignStmt:
+		return s.Tok != token.DEFINE
+	}
+	return false
+}
+
+func firstLine(fset *token.FileSet, n ast.Node) string {
+	src, err := os.ReadFile(fset.Position(n.Pos()).Filename)
+	if err != nil {
+		return ""
+	}
+	text := string(src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset])
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i] + " ..."
+	}
+	return text
+}
+
+// RunMutationTesting 对 dir 中的包执行变异测试
+func RunMutationTesting(ctx context.Context, dir string, opts MutationOptions) (*MutationReport, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve '%s': %w", dir, err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+
+	// 先确认测试在未变异的代码上通过，否则分数没有意义
+	if status, out := runMutantTests(ctx, absDir, "", opts.Timeout); status != MutantSurvived {
+		return nil, fmt.Errorf("package tests do not pass before mutation:\n%s", out)
+	}
+
+	mutants, err := FindMutants(absDir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxMutants > 0 && len(mutants) > opts.MaxMutants {
+		mutants = mutants[:opts.MaxMutants]
+	}
+
+	workDir, err := os.MkdirTemp("", "gomockagent-mutants-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	report := &MutationReport{Package: absDir, Total: len(mutants), Mutants: mutants, Survivors: []*Mutant{}}
+	sources := map[string][]byte{}
+	for _, m := range mutants {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		src, ok := sources[m.File]
+		if !ok {
+			src, err = os.ReadFile(m.File)
+			if err != nil {
+				return nil, fmt.Errorf("error reading file '%s': %w", m.File, err)
+			}
+			sources[m.File] = src
+		}
+		overlay, err := writeMutantOverlay(workDir, m, src)
+		if err != nil {
+			return nil, err
+		}
+		m.Status, _ = runMutantTests(ctx, absDir, overlay, opts.Timeout)
+
+		switch m.Status {
+		case MutantKilled:
+			report.Killed++
+		case MutantSurvived:
+			report.Survived++
+			report.Survivors = append(report.Survivors, m)
+		case MutantTimeout:
+			report.Timeout++
+		case MutantUnviable:
+			report.Unviable++
+		}
+	}
+	if viable := report.Total - report.Unviable; viable > 0 {
+		report.Score = float64(report.Killed+report.Timeout) / float64(viable)
+	}
+	return report, nil
+}
+
+func writeMutantOverlay(workDir string, m *Mutant, src []byte) (string, error) {
+	var buf bytes.Buffer
+	buf.Write(src[:m.offset])
+	buf.WriteString(m.Mutated)
+	buf.Write(src[m.end:])
+
+	mutantFile := filepath.Join(workDir, fmt.Sprintf("mutant-%d.go", m.ID))
+	if err := os.WriteFile(mutantFile, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write mutant: %w", err)
+	}
+	overlay, err := json.Marshal(map[string]any{
+		"Replace": map[string]string{m.File: mutantFile},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal overlay: %w", err)
+	}
+	overlayFile := filepath.Join(workDir, fmt.Sprintf("overlay-%d.json", m.ID))
+	if err := os.WriteFile(overlayFile, overlay, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return overlayFile, nil
+}
+
+// runMutantTests 运行包测试；overlay 为空时测试原始代码。
+// 返回 MutantSurvived 表示测试全部通过。
+func runMutantTests(ctx context.Context, dir, overlay string, timeout time.Duration) (MutantStatus, string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{"test", "-count=1"}
+	if overlay != "" {
+		args = append(args, "-overlay="+overlay)
+	}
+	args = append(args, ".")
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	// 完全离线：禁止访问模块代理与校验数据库
+	cmd.Env = append(os.Environ(), "GOPROXY=off", "GOSUMDB=off")
+	out, err := cmd.CombinedOutput()
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return MutantTimeout, string(out)
+	case err == nil:
+		return MutantSurvived, string(out)
+	case bytes.Contains(out, []byte("[build failed]")) || bytes.Contains(out, []byte("[setup failed]")):
+		return MutantUnviable, string(out)
+	default:
+		return MutantKilled, string(out)
+	}
+}
+
+// FormatMutationReport 生成适合终端阅读的摘要
+func FormatMutationReport(r *MutationReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Mutation score: %.1f%% (%d killed, %d timeout, %d survived, %d unviable, %d total)\n",
+		r.Score*100, r.Killed, r.Timeout, r.Survived, r.Unviable, r.Total)
+	for _, m := range r.Survivors {
+		rel, err := filepath.Rel(r.Package, m.File)
+		if err != nil {
+			rel = m.File
+		}
+		fmt.Fprintf(&sb, "  survived #%d %s:%d:%d %s: %q -> %q\n", m.ID, rel, m.Line, m.Column, m.Kind, m.Original, m.Mutated)
+	}
+	return sb.String()
+}
+
+// -------------------------- mutation_test --------------------------
+type MutationTestInput struct {
+	Path           string `json:"path" jsonschema_description:"Relative path of the Go package directory to mutate." jsonschema:"required,minLength=1"`
+	MaxMutants     int    `json:"max_mutants,omitempty" jsonschema_description:"Optional upper bound on the number of mutants to evaluate."`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema_description:"Optional per-mutant test timeout in seconds. Defaults to 60."`
+}
+
+var MutationTestDefinition = agent.NewTool(
+	"mutation_test",
+	"Run mutation testing on a Go package: flip conditions, change constants and remove statements, then run the package tests against each mutant. Returns the mutation score and the surviving mutants as JSON. Use this to judge whether tests are actually effective.",
+	MutationTest,
+)
+
+func MutationTest(ctx context.Context, mutationTestInput MutationTestInput) (*MutationReport, error) {
+	report, err := RunMutationTesting(ctx, mutationTestInput.Path, MutationOptions{
+		MaxMutants: mutationTestInput.MaxMutants,
+		Timeout:    time.Duration(mutationTestInput.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 返回给模型时只保留存活的变异体，避免输出过大
+	report.Mutants = nil
+	return report, nil
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- apply_patch --------------------------
+// 支持两种输入：
+//  1. 多文件 unified diff（包括 git 的 new/deleted file 与 rename 头）
+//  2. 简化的结构化格式：
+//     *** Begin Patch
+//     *** Update File: path          （可跟 *** Move to: newpath）
+//     @@ 可选的定位说明
+//     -old
+//     +new
+//     *** Add File: path             （内容每行以 + 开头）
+//     *** Delete File: path
+//     *** End Patch
+// 所有 hunk 先在内存中匹配，只有全部成功才会写盘。
+
+type patchOp string
+
+const (
+	patchAdd    patchOp = "add"
+	patchDelete patchOp = "delete"
+	patchUpdate patchOp = "update"
+	patchRename patchOp = "rename"
+)
+
+type hunkLine struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+type patchHunk struct {
+	oldStart int // 从 1 开始；0 表示没有行号，需要搜索
+	lines    []hunkLine
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+type filePatch struct {
+	op      patchOp
+	oldPath string
+	newPath string
+	hunks   []*patchHunk
+}
+
+// HunkResult 是单个 hunk 的应用结果
+type HunkResult struct {
+	Hunk    int    `json:"hunk"`
+	Applied bool   `json:"applied"`
+	Line    int    `json:"line,omitempty"`   // 实际应用位置（从 1 开始）
+	Offset  int    `json:"offset,omitempty"` // 与 hunk 头中行号的偏差
+	Fuzz    int    `json:"fuzz,omitempty"`   // 0 精确，1 忽略行尾空白，2 忽略首尾空白，3 额外丢弃首尾各一行上下文
+	Message string `json:"message,omitempty"`
+}
+
+type FilePatchResult struct {
+	Path    string       `json:"path"`
+	OldPath string       `json:"old_path,omitempty"`
+	Op      patchOp      `json:"op"`
+	Hunks   []HunkResult `json:"hunks,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type PatchResult struct {
+	Applied bool              `json:"applied"`
+	DryRun  bool              `json:"dry_run"`
+	Files   []FilePatchResult `json:"files"`
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parsePatch 自动识别输入格式
+func parsePatch(text string) ([]*filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.HasPrefix(strings.TrimSpace(text), "*** Begin Patch") {
+		return parseStructuredPatch(text)
+	}
+	return parseUnifiedDiff(text)
+}
+
+func stripDiffPrefix(path string) string {
+	path = strings.TrimSpace(path)
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i] // 去掉时间戳
+	}
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+func parseUnifiedDiff(text string) ([]*filePatch, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var patches []*filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+
+	startFile := func() {
+		cur = &filePatch{op: patchUpdate}
+		patches = append(patches, cur)
+		hunk = nil
+	}
+	isFileHeader := func(i int) bool {
+		return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			startFile()
+			if parts := strings.SplitN(strings.TrimPrefix(line, "diff --git "), " b/", 2); len(parts) == 2 {
+				cur.oldPath = stripDiffPrefix(parts[0])
+				cur.newPath = parts[1]
+			}
+		case isFileHeader(i):
+			if cur == nil || len(cur.hunks) > 0 || hunk != nil {
+				startFile()
+			}
+			cur.oldPath = stripDiffPrefix(strings.TrimPrefix(line, "--- "))
+			cur.newPath = stripDiffPrefix(strings.TrimPrefix(lines[i+1], "+++ "))
+			i++
+		case cur != nil && hunk == nil && strings.HasPrefix(line, "new file mode"):
+			cur.op = patchAdd
+		case cur != nil && hunk == nil && strings.HasPrefix(line, "deleted file mode"):
+			cur.op = patchDelete
+		case cur != nil && hunk == nil && strings.HasPrefix(line, "rename from "):
+			cur.oldPath = strings.TrimPrefix(line, "rename from ")
+			cur.op = patchRename
+		case cur != nil && hunk == nil && strings.HasPrefix(line, "rename to "):
+			cur.newPath = strings.TrimPrefix(line, "rename to ")
+			cur.op = patchRename
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk header before any file header", i+1)
+			}
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", i+1, line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			hunk = &patchHunk{oldStart: start}
+			cur.hunks = append(cur.hunks, hunk)
+		case hunk != nil && strings.HasPrefix(line, `\`):
+			markNoEOL(hunk)
+		case hunk != nil && (line == "" || strings.ContainsRune(" -+", rune(line[0]))):
+			if line == "" {
+				// 模型经常省略空上下文行前的空格
+				hunk.lines = append(hunk.lines, hunkLine{' ', ""})
+			} else {
+				hunk.lines = append(hunk.lines, hunkLine{line[0], line[1:]})
+			}
+		default:
+			// diff 之外的说明文字或 git 扩展头（index、similarity 等）
+			hunk = nil
+		}
+	}
+
+	for _, p := range patches {
+		if p.op == patchUpdate {
+			switch {
+			case p.oldPath == "" && p.newPath != "":
+				p.op = patchAdd
+			case p.newPath == "" && p.oldPath != "":
+				p.op = patchDelete
+			case p.oldPath != p.newPath:
+				p.op = patchRename
+			}
+		}
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers found in patch")
+	}
+	return patches, nil
+}
+
+func markNoEOL(h *patchHunk) {
+	if len(h.lines) == 0 {
+		return
+	}
+	switch h.lines[len(h.lines)-1].kind {
+	case '-':
+		h.oldNoEOL = true
+	case '+':
+		h.newNoEOL = true
+	default:
+		h.oldNoEOL, h.newNoEOL = true, true
+	}
+}
+
+func parseStructuredPatch(text string) ([]*filePatch, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var patches []*filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "*** Begin Patch"), strings.HasPrefix(line, "*** End of File"):
+		case strings.HasPrefix(line, "*** End Patch"):
+			return patches, nil
+		case strings.HasPrefix(line, "*** Add File: "):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "*** Add File: "))
+			cur = &filePatch{op: patchAdd, newPath: path}
+			hunk = &patchHunk{}
+			cur.hunks = []*patchHunk{hunk}
+			patches = append(patches, cur)
+		case strings.HasPrefix(line, "*** Delete File: "):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "*** Delete File: "))
+			cur, hunk = &filePatch{op: patchDelete, oldPath: path}, nil
+			patches = append(patches, cur)
+		case strings.HasPrefix(line, "*** Update File: "):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "*** Update File: "))
+			cur, hunk = &filePatch{op: patchUpdate, oldPath: path, newPath: path}, nil
+			patches = append(patches, cur)
+		case strings.HasPrefix(line, "*** Move to: "):
+			if cur == nil || cur.op != patchUpdate {
+				return nil, fmt.Errorf("line %d: '*** Move to' must follow '*** Update File'", i+1)
+			}
+			cur.newPath = strings.TrimSpace(strings.TrimPrefix(line, "*** Move to: "))
+			cur.op = patchRename
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil || cur.op == patchAdd || cur.op == patchDelete {
+				return nil, fmt.Errorf("line %d: hunk outside of '*** Update File'", i+1)
+			}
+			hunk = &patchHunk{}
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				hunk.oldStart, _ = strconv.Atoi(m[1])
+			}
+			cur.hunks = append(cur.hunks, hunk)
+		case cur == nil:
+			return nil, fmt.Errorf("line %d: content before any file header", i+1)
+		case cur.op == patchAdd:
+			if !strings.HasPrefix(line, "+") {
+				return nil, fmt.Errorf("line %d: lines of an added file must start with '+'", i+1)
+			}
+			hunk.lines = append(hunk.lines, hunkLine{'+', line[1:]})
+		case cur.op == patchDelete:
+			return nil, fmt.Errorf("line %d: unexpected content after '*** Delete File'", i+1)
+		default:
+			if hunk == nil {
+				// 结构化格式允许省略第一个 @@
+				hunk = &patchHunk{}
+				cur.hunks = append(cur.hunks, hunk)
+			}
+			switch {
+			case line == "":
+				hunk.lines = append(hunk.lines, hunkLine{' ', ""})
+			case strings.HasPrefix(line, `\`):
+				markNoEOL(hunk)
+			case strings.ContainsRune(" -+", rune(line[0])):
+				hunk.lines = append(hunk.lines, hunkLine{line[0], line[1:]})
+			default:
+				return nil, fmt.Errorf("line %d: expected ' ', '-' or '+' prefix, got %q", i+1, line)
+			}
+		}
+	}
+	return nil, fmt.Errorf("missing '*** End Patch'")
+}
+
+// -------------------------- hunk matching --------------------------
+
+type fileLines struct {
+	lines []string
+	eol   bool // 最后一行是否以换行结尾
+}
+
+func toFileLines(content string) fileLines {
+	if content == "" {
+		return fileLines{eol: true}
+	}
+	fl := fileLines{eol: strings.HasSuffix(content, "\n")}
+	fl.lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	return fl
+}
+
+func (fl fileLines) String() string {
+	if len(fl.lines) == 0 {
+		return ""
+	}
+	s := strings.Join(fl.lines, "\n")
+	if fl.eol {
+		s += "\n"
+	}
+	return s
+}
+
+var lineNormalizers = []func(string) string{
+	func(s string) string { return s },
+	func(s string) string { return strings.TrimRight(s, " \t") },
+	strings.TrimSpace,
+}
+
+func matchAt(file []string, pos int, want []string, norm func(string) string) bool {
+	if pos < 0 || pos+len(want) > len(file) {
+		return false
+	}
+	for i, w := range want {
+		if norm(file[pos+i]) != norm(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk 从期望位置向两侧搜索，不早于 minPos（hunk 不能回退或重叠）
+func findHunk(file []string, want []string, expected, minPos int, norm func(string) string) (int, bool) {
+	expected = max(expected, minPos)
+	for d := 0; expected-d >= minPos || expected+d <= len(file); d++ {
+		if matchAt(file, expected+d, want, norm) {
+			return expected + d, true
+		}
+		if d > 0 && expected-d >= minPos && matchAt(file, expected-d, want, norm) {
+			return expected - d, true
+		}
+	}
+	return 0, false
+}
+
+// applyHunks 在内存中应用全部 hunk，返回新内容与逐个 hunk 的结果
+func applyHunks(content string, hunks []*patchHunk) (string, []HunkResult, bool) {
+	fl := toFileLines(content)
+	lines := fl.lines
+	var out []string
+	results := make([]HunkResult, 0, len(hunks))
+	cursor, delta, ok := 0, 0, true
+
+	for idx, h := range hunks {
+		res := HunkResult{Hunk: idx + 1}
+		// 纯新增的 hunk（@@ -N,0 +M,k @@）插入到第 N 行之后，其他 hunk 从第 N 行开始
+		pureInsert := len(hunkSide(h.lines, '+')) == 0
+		base := h.oldStart - 1
+		if pureInsert {
+			base = h.oldStart
+		}
+		expected := cursor
+		if h.oldStart > 0 {
+			expected = base + delta
+		}
+
+		hl := h.lines
+		pos, fuzz, found := 0, 0, false
+		if pureInsert {
+			pos, found = min(max(expected, cursor), len(lines)), true
+		}
+		for trim := 0; trim <= 1 && !found; trim++ {
+			if trim == 1 {
+				hl = trimContext(h.lines)
+				if len(hl) == len(h.lines) {
+					break
+				}
+			}
+			old := hunkSide(hl, '+')
+			if len(old) == 0 {
+				// 去掉上下文后没有剩下可定位的旧内容，上下文在文件中不存在，不能当作纯新增
+				break
+			}
+			for level, norm := range lineNormalizers {
+				if p, hit := findHunk(lines, old, expected, cursor, norm); hit {
+					pos, fuzz, found = p, level, true
+					if trim == 1 {
+						fuzz = len(lineNormalizers)
+					}
+					break
+				}
+			}
+		}
+		if !found {
+			ok = false
+			res.Message = describeFailedHunk(lines, h, expected)
+			results = append(results, res)
+			continue
+		}
+
+		out = append(out, lines[cursor:pos]...)
+		fileIdx := pos
+		for _, l := range hl {
+			switch l.kind {
+			case ' ':
+				out = append(out, lines[fileIdx]) // 保留文件中的原始上下文
+				fileIdx++
+			case '-':
+				fileIdx++
+			case '+':
+				out = append(out, l.text)
+			}
+		}
+		if fileIdx == len(lines) && (h.oldNoEOL || h.newNoEOL) {
+			fl.eol = !h.newNoEOL
+		}
+		res.Applied, res.Line, res.Fuzz = true, pos+1, fuzz
+		if h.oldStart > 0 {
+			res.Offset = pos - (base + delta)
+		}
+		delta += len(hunkSide(hl, '-')) - len(hunkSide(hl, '+'))
+		cursor = fileIdx
+		results = append(results, res)
+	}
+	out = append(out, lines[cursor:]...)
+	fl.lines = out
+	return fl.String(), results, ok
+}
+
+// hunkSide 返回去掉某一类行后的文本：skip='+' 得到旧内容，skip='-' 得到新内容
+func hunkSide(lines []hunkLine, skip byte) []string {
+	var side []string
+	for _, l := range lines {
+		if l.kind != skip {
+			side = append(side, l.text)
+		}
+	}
+	return side
+}
+
+// trimContext 丢弃首尾各一行上下文，类似 patch 的 fuzz factor
+func trimContext(lines []hunkLine) []hunkLine {
+	if len(lines) > 0 && lines[0].kind == ' ' {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && lines[len(lines)-1].kind == ' ' {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func describeFailedHunk(file []string, h *patchHunk, expected int) string {
+	var sb strings.Builder
+	sb.WriteString("could not find these lines:\n")
+	for _, l := range hunkSide(h.lines, '+') {
+		sb.WriteString("  | " + l + "\n")
+	}
+	from := max(expected-3, 0)
+	to := min(expected+len(hunkSide(h.lines, '+'))+3, len(file))
+	if from < to {
+		fmt.Fprintf(&sb, "file content around line %d:\n", expected+1)
+		for i := from; i < to; i++ {
+			fmt.Fprintf(&sb, "%5d | %s\n", i+1, file[i])
+		}
+	}
+	return sb.String()
+}
+
+// -------------------------- 执行补丁 --------------------------
+
+type plannedWrite struct {
+	path    string
+	content string
+	remove  bool
+}
+
+// ApplyPatch 解析并应用补丁；dryRun 时只报告结果
+func ApplyPatch(ctx context.Context, patchText string, dryRun bool) (*PatchResult, []string, error) {
+	patches, err := parsePatch(patchText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse patch: %w", err)
+	}
+
+	result := &PatchResult{DryRun: dryRun, Applied: true}
+	var writes []plannedWrite
+	for _, p := range patches {
+		fr := FilePatchResult{Op: p.op, Path: p.newPath}
+		if p.op == patchDelete {
+			fr.Path = p.oldPath
+		}
+		if p.op == patchRename {
+			fr.OldPath = p.oldPath
+		}
+
+		var current string
+		if p.op != patchAdd {
+			content, err := os.ReadFile(p.oldPath)
+			if err != nil {
+				fr.Error = fmt.Sprintf("error reading file '%s': %s", p.oldPath, err)
+				result.Applied = false
+				result.Files = append(result.Files, fr)
+				continue
+			}
+			current = string(content)
+		} else if _, err := os.Stat(p.newPath); err == nil {
+			fr.Error = fmt.Sprintf("file '%s' already exists", p.newPath)
+			result.Applied = false
+			result.Files = append(result.Files, fr)
+			continue
+		}
+
+		if p.op == patchDelete {
+			writes = append(writes, plannedWrite{path: p.oldPath, remove: true})
+			result.Files = append(result.Files, fr)
+			continue
+		}
+		newContent, hunks, ok := applyHunks(current, p.hunks)
+		fr.Hunks = hunks
+		if !ok {
+			result.Applied = false
+		}
+		if p.op == patchRename {
+			writes = append(writes, plannedWrite{path: p.oldPath, remove: true})
+		}
+		writes = append(writes, plannedWrite{path: p.newPath, content: newContent})
+		result.Files = append(result.Files, fr)
+	}
+
+	if !result.Applied || dryRun {
+		return result, nil, nil
+	}
+	var touched []string
+	for _, w := range writes {
+		if w.remove {
+			if err := removeFileWithCheckpoint(ctx, w.path); err != nil {
+				return nil, touched, fmt.Errorf("failed to remove '%s': %w", w.path, err)
+			}
+			continue
+		}
+		if dir := filepath.Dir(w.path); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, touched, fmt.Errorf("failed to create directory '%s': %w", dir, err)
+			}
+		}
+		if err := writeFileWithCheckpoint(ctx, w.path, []byte(w.content), 0o644); err != nil {
+			return nil, touched, fmt.Errorf("error writing file '%s': %w", w.path, err)
+		}
+		touched = append(touched, w.path)
+	}
+	return result, touched, nil
+}
+
+type ApplyPatchInput struct {
+	Patch  string `json:"patch" jsonschema_description:"A multi-file unified diff (git style headers are supported), or a structured patch starting with '*** Begin Patch' and using '*** Add File:', '*** Update File:', '*** Delete File:' and '*** Move to:' sections." jsonschema:"required,minLength=1"`
+	DryRun bool   `json:"dry_run,omitempty" jsonschema_description:"Only check whether the patch applies, without changing any files."`
+}
+
+var ApplyPatchDefinition = agent.NewTool(
+	"apply_patch",
+	"Apply a patch to files in the working directory. Hunks are matched fuzzily (line offsets, whitespace differences, missing outer context). Files are created, deleted or renamed as the patch says. Nothing is changed unless every hunk applies. Returns a per-hunk JSON report.",
+	ApplyPatchTool,
+)
+
+func ApplyPatchTool(ctx context.Context, applyPatchInput ApplyPatchInput) (string, error) {
+	result, touched, err := ApplyPatch(ctx, applyPatchInput.Patch, applyPatchInput.DryRun)
+	if err != nil {
+		return "", err
+	}
+	report, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal patch result to JSON: %w", err)
+	}
+	if !result.Applied {
+		return "", fmt.Errorf("patch does not apply, no files were changed:\n%s", report)
+	}
+	return withGoDiagnostics(ctx, string(report), touched...), nil
+}
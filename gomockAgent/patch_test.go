@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		patch   string
+		want    string
+		ok      bool
+	}{
+		{
+			name:    "pure insert goes after line N",
+			content: "a\nb\nc\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -2,0 +3,1 @@\n+x\n",
+			want:    "a\nb\nx\nc\n",
+			ok:      true,
+		},
+		{
+			name:    "pure insert at the top of the file",
+			content: "a\nb\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -0,0 +1,1 @@\n+x\n",
+			want:    "x\na\nb\n",
+			ok:      true,
+		},
+		{
+			name:    "context-only old side that does not exist",
+			content: "x\ny\nz\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+			want:    "x\ny\nz\n",
+			ok:      false,
+		},
+		{
+			name:    "trimmed context still matches",
+			content: "a\nb\nc\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n zzz\n-b\n+B\n c\n",
+			want:    "a\nB\nc\n",
+			ok:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, results, ok := applyHunks(tt.content, files[0].hunks)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v (%+v)", ok, tt.ok, results)
+			}
+			if ok && got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// Package prompt 从文件加载基于 text/template 的提示模板，修改提示不需要重新编译，也便于版本管理与 diff。
+//
+// 一个模板是一个 .tmpl 文件，可以以 YAML frontmatter 开头，声明描述、带类型的变量与 few-shot 示例：
+//
+//	---
+//	description: System prompt of the interactive agent
+//	variables:
+//	  language: {type: string, default: Go}
+//	  tools: {type: list, required: true, description: names of the available tools}
+//	examples:
+//	  - user: Rename foo to bar in main.go
+//	    assistant: I'll read main.go first.
+//	---
+//	You are a helpful {{.language}} programmer. {{template "tool_rules" .}}
+//
+// 文件名决定模板名与语言：commit.tmpl 是默认版本，commit.zh.tmpl 是中文版本，渲染时按
+// 请求的语言、语言的主标签（zh-CN → zh）、默认版本的顺序查找。以 _ 开头的文件是 partial，
+// 例如 _tool_rules.tmpl 可以在任何模板中以 {{template "tool_rules" .}} 引用，同样支持语言版本。
+//
+// 变量在渲染时校验：未声明的变量、缺少必填变量或类型不符都会返回错误；未提供的可选变量取
+// default 或该类型的零值。模板中引用未声明的变量同样是错误。示例中的文本也作为模板渲染。
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variable 描述模板的一个变量
+type Variable struct {
+	Type        string `yaml:"type" json:"type"` // string（默认）、int、number、bool、list、map、any
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	Default     any    `yaml:"default,omitempty" json:"default,omitempty"`
+}
+
+// Example 是一组 few-shot 示例
+type Example struct {
+	User      string `yaml:"user" json:"user"`
+	Assistant string `yaml:"assistant" json:"assistant"`
+}
+
+// Message 是渲染后的一条消息，Role 为 system、user 或 assistant
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Rendered 是渲染结果
+type Rendered struct {
+	Name     string
+	Locale   string // 实际使用的语言版本，默认版本为空
+	Text     string
+	Examples []Example
+}
+
+// ExampleMessages 把 few-shot 示例展开为交替的 user / assistant 消息
+func (r *Rendered) ExampleMessages() []Message {
+	var msgs []Message
+	for _, e := range r.Examples {
+		msgs = append(msgs, Message{Role: "user", Content: e.User}, Message{Role: "assistant", Content: e.Assistant})
+	}
+	return msgs
+}
+
+// Info 描述一个已加载的模板
+type Info struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Locales     []string            `json:"locales"` // "" 表示默认版本
+	Variables   map[string]Variable `json:"variables,omitempty"`
+	Partial     bool                `json:"partial,omitempty"`
+	Source      string              `json:"source"` // 默认版本的文件路径
+}
+
+type meta struct {
+	Description string              `yaml:"description"`
+	Variables   map[string]Variable `yaml:"variables"`
+	Examples    []Example           `yaml:"examples"`
+}
+
+type file struct {
+	source string
+	meta   meta
+	body   string
+}
+
+// Library 是一组按名称与语言索引的模板
+type Library struct {
+	templates map[string]map[string]*file // name → locale → file
+	partials  map[string]map[string]*file
+}
+
+var localeSuffix = regexp.MustCompile(`^[a-z]{2}(?:[-_][A-Za-z]{2,4})?$`)
+
+// Load 读取每个 fs 根目录下的 *.tmpl 文件；后面的 fs 中的同名文件覆盖前面的，
+// 因此可以先传入内置的默认模板，再传入用户与项目的目录
+func Load(fsyss ...fs.FS) (*Library, error) {
+	l := &Library{templates: map[string]map[string]*file{}, partials: map[string]map[string]*file{}}
+	for _, fsys := range fsyss {
+		paths, err := fs.Glob(fsys, "*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read prompt %s: %w", p, err)
+			}
+			f, err := parseFile(p, string(data))
+			if err != nil {
+				return nil, err
+			}
+			name, locale := splitName(p)
+			set := l.templates
+			if strings.HasPrefix(name, "_") {
+				name, set = name[1:], l.partials
+			}
+			if set[name] == nil {
+				set[name] = map[string]*file{}
+			}
+			set[name][locale] = f
+		}
+	}
+	// 尽早发现语法错误，而不是等到第一次渲染
+	for name, locales := range l.templates {
+		for locale := range locales {
+			if _, err := l.parse(name, locale); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return l, nil
+}
+
+// LoadDirs 依次加载 base 与存在的目录，不存在的目录被忽略
+func LoadDirs(base fs.FS, dirs ...string) (*Library, error) {
+	fsyss := []fs.FS{base}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			fsyss = append(fsyss, os.DirFS(dir))
+		}
+	}
+	return Load(fsyss...)
+}
+
+// splitName 从文件名得到模板名与语言，例如 commit.zh.tmpl → commit, zh
+func splitName(p string) (name, locale string) {
+	name = strings.TrimSuffix(path.Base(p), ".tmpl")
+	if i := strings.LastIndex(name, "."); i > 0 && localeSuffix.MatchString(name[i+1:]) {
+		return name[:i], normalizeLocale(name[i+1:])
+	}
+	return name, ""
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func parseFile(source, text string) (*file, error) {
+	f := &file{source: source, body: text}
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return f, nil
+	}
+	rest := text[strings.Index(text, "\n")+1:]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return nil, fmt.Errorf("prompt %s: unterminated frontmatter", source)
+	}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &f.meta); err != nil {
+		return nil, fmt.Errorf("prompt %s: invalid frontmatter: %w", source, err)
+	}
+	for name, v := range f.meta.Variables {
+		switch v.Type {
+		case "":
+			v.Type = "string"
+			f.meta.Variables[name] = v
+		case "string", "int", "number", "bool", "list", "map", "any":
+		default:
+			return nil, fmt.Errorf("prompt %s: variable %q has unknown type %q", source, name, v.Type)
+		}
+	}
+	body := rest[end+len("\n---"):]
+	if i := strings.Index(body, "\n"); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	f.body = body
+	return f, nil
+}
+
+// lookup 按 locale、主语言标签、默认版本的顺序查找
+func lookup(variants map[string]*file, locale string) (*file, string) {
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	for _, c := range append(candidates, "") {
+		if f, ok := variants[c]; ok {
+			return f, c
+		}
+	}
+	return nil, ""
+}
+
+var funcs = template.FuncMap{
+	"join": func(sep string, list []any) string {
+		parts := make([]string, len(list))
+		for i, v := range list {
+			parts[i] = fmt.Sprint(v)
+		}
+		return strings.Join(parts, sep)
+	},
+	"trim": strings.TrimSpace,
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+}
+
+// parse 解析模板及其引用的 partial（选用同一语言的版本）
+func (l *Library) parse(name, locale string) (*template.Template, error) {
+	f, _ := lookup(l.templates[name], locale)
+	if f == nil {
+		return nil, fmt.Errorf("prompt %q not found", name)
+	}
+	t := template.New(name).Funcs(funcs).Option("missingkey=error")
+	for pname, variants := range l.partials {
+		p, _ := lookup(variants, locale)
+		if p == nil {
+			continue
+		}
+		// partial 常在句中引用，去掉文件末尾的换行
+		if _, err := t.New(pname).Parse(strings.TrimSuffix(p.body, "\n")); err != nil {
+			return nil, fmt.Errorf("prompt partial %s: %w", p.source, err)
+		}
+	}
+	if _, err := t.Parse(f.body); err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", f.source, err)
+	}
+	return t, nil
+}
+
+// Render 以 vars（map 或可序列化为 JSON 对象的结构体）渲染模板
+func (l *Library) Render(name, locale string, vars any) (*Rendered, error) {
+	f, used := lookup(l.templates[name], locale)
+	if f == nil {
+		return nil, fmt.Errorf("prompt %q not found", name)
+	}
+	data, err := f.bind(vars)
+	if err != nil {
+		return nil, err
+	}
+	t, err := l.parse(name, locale)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", f.source, err)
+	}
+	r := &Rendered{Name: name, Locale: used, Text: strings.TrimSpace(buf.String())}
+	for i, e := range f.meta.Examples {
+		user, err := renderString(t, fmt.Sprintf("example %d user", i+1), e.User, data)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", f.source, err)
+		}
+		assistant, err := renderString(t, fmt.Sprintf("example %d assistant", i+1), e.Assistant, data)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", f.source, err)
+		}
+		r.Examples = append(r.Examples, Example{User: user, Assistant: assistant})
+	}
+	return r, nil
+}
+
+func renderString(base *template.Template, name, text string, data map[string]any) (string, error) {
+	t, err := base.Clone()
+	if err != nil {
+		return "", err
+	}
+	if _, err := t.New(name).Parse(text); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// bind 校验变量并补全默认值
+func (f *file) bind(vars any) (map[string]any, error) {
+	given := map[string]any{}
+	if vars != nil {
+		raw, err := json.Marshal(vars)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: failed to encode variables: %w", f.source, err)
+		}
+		if err := json.Unmarshal(raw, &given); err != nil {
+			return nil, fmt.Errorf("prompt %s: variables must be an object: %w", f.source, err)
+		}
+	}
+	var problems []string
+	data := map[string]any{}
+	for name, value := range given {
+		v, ok := f.meta.Variables[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown variable %q", name))
+			continue
+		}
+		if !hasType(value, v.Type) {
+			problems = append(problems, fmt.Sprintf("variable %q must be of type %s, got %s", name, v.Type, describe(value)))
+			continue
+		}
+		data[name] = value
+	}
+	for name, v := range f.meta.Variables {
+		if _, ok := given[name]; ok {
+			continue
+		}
+		switch {
+		case v.Required:
+			problems = append(problems, fmt.Sprintf("missing required variable %q", name))
+		case v.Default != nil:
+			data[name] = normalizeYAML(v.Default)
+		default:
+			data[name] = zeroValue(v.Type)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("prompt %s: %s", f.source, strings.Join(problems, "; "))
+	}
+	return data, nil
+}
+
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "int":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "list":
+		_, ok := value.([]any)
+		return ok || value == nil
+	case "map":
+		_, ok := value.(map[string]any)
+		return ok || value == nil
+	}
+	return true
+}
+
+func zeroValue(typ string) any {
+	switch typ {
+	case "string":
+		return ""
+	case "int", "number":
+		return 0
+	case "bool":
+		return false
+	case "list":
+		return []any{}
+	case "map":
+		return map[string]any{}
+	}
+	return nil
+}
+
+func describe(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalizeYAML 让 YAML 中的默认值与 JSON 传入的变量类型一致（例如整数统一为 float64）
+func normalizeYAML(v any) any {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if json.Unmarshal(raw, &out) != nil {
+		return v
+	}
+	return out
+}
+
+// Templates 返回已加载的模板与 partial，按名称排序
+func (l *Library) Templates() []Info {
+	var infos []Info
+	collect := func(set map[string]map[string]*file, partial bool) {
+		for name, variants := range set {
+			info := Info{Name: name, Partial: partial}
+			for locale := range variants {
+				info.Locales = append(info.Locales, locale)
+			}
+			sort.Strings(info.Locales)
+			f, _ := lookup(variants, "")
+			if f == nil {
+				f = variants[info.Locales[0]]
+			}
+			info.Description, info.Variables, info.Source = f.meta.Description, f.meta.Variables, f.source
+			infos = append(infos, info)
+		}
+	}
+	collect(l.templates, false)
+	collect(l.partials, true)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Locale 从 $GOMOCKAGENT_LOCALE、$LC_ALL、$LC_MESSAGES、$LANG 推断语言，例如 zh_CN.UTF-8 → zh-cn；
+// 无法推断（含 C、POSIX）时返回空字符串，即默认版本
+func Locale() string {
+	for _, env := range []string{"GOMOCKAGENT_LOCALE", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		if i := strings.IndexAny(v, ".@"); i >= 0 {
+			v = v[:i]
+		}
+		if v == "C" || v == "POSIX" {
+			return ""
+		}
+		return normalizeLocale(v)
+	}
+	return ""
+}
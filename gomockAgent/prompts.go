@@ -0,0 +1,152 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gomockAgent/agent"
+	"gomockAgent/prompt"
+)
+
+// -------------------------- 提示模板 --------------------------
+// 提示放在 prompts/*.tmpl 中并编译进二进制作为默认版本；同名文件可以放在
+// ~/.config/gomockagent/prompts 或 ./.gomockagent/prompts 中覆盖（后者优先），修改后无需重新编译。
+// 语言由 $GOMOCKAGENT_LOCALE 或 $LANG 决定，例如 zh 使用 system.zh.tmpl。
+// 格式见 prompt 包的文档；`gomockAgent prompts` 列出模板，`gomockAgent prompts render <name>` 查看渲染结果。
+
+//go:embed prompts/*.tmpl
+var builtinPromptFiles embed.FS
+
+func promptDirs() []string {
+	dirs := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "gomockagent", "prompts"))
+	}
+	return append(dirs, filepath.Join(".gomockagent", "prompts"))
+}
+
+// loadPrompts 加载内置与用户的模板；用户模板有误时警告并只使用内置模板
+var loadPrompts = sync.OnceValue(func() *prompt.Library {
+	builtin, _ := fs.Sub(builtinPromptFiles, "prompts")
+	lib, err := prompt.LoadDirs(builtin, promptDirs()...)
+	if err == nil {
+		return lib
+	}
+	fmt.Fprintf(os.Stderr, "\u001b[93mWarning: %v, using the built-in prompts\u001b[0m\n", err)
+	lib, err = prompt.Load(builtin)
+	if err != nil {
+		panic(err) // 内置模板在编译时就应保证正确
+	}
+	return lib
+})
+
+// renderPrompt 以当前语言渲染模板
+func renderPrompt(name string, vars any) (*prompt.Rendered, error) {
+	return loadPrompts().Render(name, prompt.Locale(), vars)
+}
+
+// exampleMessages 把模板中的 few-shot 示例转换为对话消息
+func exampleMessages(r *prompt.Rendered) []agent.OpenAIChatCompletionMessage {
+	var msgs []agent.OpenAIChatCompletionMessage
+	for _, m := range r.ExampleMessages() {
+		msgs = append(msgs, agent.OpenAIChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	return msgs
+}
+
+// -------------------------- prompts 子命令 --------------------------
+
+func runPromptsCommand(args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		for _, info := range loadPrompts().Templates() {
+			name := info.Name
+			if info.Partial {
+				name = "_" + name
+			}
+			locales := make([]string, len(info.Locales))
+			for i, l := range info.Locales {
+				if l == "" {
+					l = "default"
+				}
+				locales[i] = l
+			}
+			fmt.Printf("%-18s %-14s %s\n", name, strings.Join(locales, ","), info.Description)
+		}
+		return nil
+	}
+	if args[0] != "render" {
+		return fmt.Errorf("unknown prompts command %q, expected list or render", args[0])
+	}
+
+	fs := flag.NewFlagSet("prompts render", flag.ContinueOnError)
+	locale := fs.String("locale", prompt.Locale(), "locale variant to render, for example zh")
+	varsFile := fs.String("vars", "", "JSON file with the template variables")
+	var pairs []string
+	fs.Func("var", "template variable as name=value, may be repeated", func(s string) error {
+		if !strings.Contains(s, "=") {
+			return fmt.Errorf("expected name=value, got %q", s)
+		}
+		pairs = append(pairs, s)
+		return nil
+	})
+	// 模板名可以出现在选项之前或之后
+	var positional []string
+	for rest := args[1:]; len(rest) > 0; rest = fs.Args()[1:] {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: prompts render [-locale zh] [-var name=value]... [-vars file.json] <name>")
+	}
+	name := positional[0]
+
+	vars := map[string]any{}
+	if *varsFile != "" {
+		data, err := os.ReadFile(*varsFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &vars); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", *varsFile, err)
+		}
+	}
+	declared := map[string]prompt.Variable{}
+	for _, info := range loadPrompts().Templates() {
+		if info.Name == name && !info.Partial {
+			declared = info.Variables
+		}
+	}
+	for _, pair := range pairs {
+		k, v, _ := strings.Cut(pair, "=")
+		// 非字符串变量按 JSON 解析，例如 -var count=3 或 -var tools='["a","b"]'
+		var value any = v
+		if t := declared[k].Type; t != "" && t != "string" {
+			if err := json.Unmarshal([]byte(v), &value); err != nil {
+				return fmt.Errorf("variable %s: %q is not a valid %s: %w", k, v, t, err)
+			}
+		}
+		vars[k] = value
+	}
+
+	r, err := loadPrompts().Render(name, *locale, vars)
+	if err != nil {
+		return err
+	}
+	fmt.Println(r.Text)
+	for i, e := range r.Examples {
+		fmt.Printf("\n--- example %d: user ---\n%s\n--- example %d: assistant ---\n%s\n", i+1, e.User, i+1, e.Assistant)
+	}
+	return nil
+}
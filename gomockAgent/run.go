@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- gomockAgent run --------------------------
+
+// runOneShotCommand 实现 gomockAgent run：执行一次任务后退出，结果写到 stdout
+func runOneShotCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	schemaFile := fs.String("schema", "", "JSON schema file the final answer must match")
+	retries := fs.Int("retries", agent.DefaultAnswerRetries, "how many times to re-ask when the final answer does not match the schema")
+	asJSON := fs.Bool("json", false, "print the answer and token usage as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: gomockAgent run [-schema file] [-retries n] [-json] <prompt | ->")
+	}
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(data)
+	}
+
+	var spec *agent.AnswerSpec
+	if *schemaFile != "" {
+		data, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+		if spec, err = agent.AnswerSpecFromJSON(data); err != nil {
+			return err
+		}
+		spec.MaxRetries = *retries
+	}
+
+	// stdout 只输出结果，过程信息改写到 stderr
+	resultOut := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = resultOut }()
+
+	if err := checkOpenAIConfig(); err != nil {
+		return err
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	tools := builtinTools(config)
+	mcpTools, closeMCP := LoadMCPTools(context.Background(), config.MCPServers, tools)
+	defer closeMCP()
+	ag, err := NewConfiguredAgent(append(tools, mcpTools...), config)
+	if err != nil {
+		return err
+	}
+
+	session := ag.NewSession()
+	session.Subscribe(agent.SubscriberFunc(printEvent))
+	var answer json.RawMessage
+	if spec != nil {
+		answer, err = session.SendStructured(context.Background(), prompt, spec)
+	} else {
+		var text string
+		if text, err = session.Send(context.Background(), prompt); err == nil {
+			answer, err = json.Marshal(text)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(struct {
+			Answer json.RawMessage  `json:"answer"`
+			Usage  agent.TokenUsage `json:"usage"`
+		}{answer, session.Usage().Session()}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(resultOut, string(out))
+		return nil
+	}
+	if spec == nil {
+		var text string
+		_ = json.Unmarshal(answer, &text)
+		fmt.Fprintln(resultOut, text)
+		return nil
+	}
+	fmt.Fprintln(resultOut, string(answer))
+	return nil
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- gomockAgent serve --------------------------
+// 通过 HTTP 暴露同一个 Agent，供内部 Web 工具与机器人共用：
+//
+//	POST   /v1/sessions                          创建会话
+//	GET    /v1/sessions                          列出会话
+//	GET    /v1/sessions/{id}                     会话详情与对话
+//	DELETE /v1/sessions/{id}                     取消进行中的一轮并删除会话
+//	POST   /v1/sessions/{id}/messages            发送用户消息，{"content": "...", "wait": false}
+//	POST   /v1/sessions/{id}/cancel              取消进行中的一轮
+//	GET    /v1/sessions/{id}/events              SSE 事件流，支持 Last-Event-ID / ?after=N 续传
+//	GET    /v1/sessions/{id}/approvals           等待审批的工具调用
+//	POST   /v1/sessions/{id}/approvals/{call_id} 审批，{"approved": true, "reason": "..."}
+//	POST   /v1/chat/completions                  OpenAI 兼容接口，在服务端执行完整的工具循环
+//	GET    /v1/ws                                WebSocket 双向通道，见 websocket.go
+//	GET    /v1/ws/schema                         WebSocket 帧的 JSON schema
+//
+// 所有请求都需要 Authorization: Bearer <token>；未通过 -token 或 $GOMOCKAGENT_SERVE_TOKEN 指定时，
+// 启动时生成一个随机 token 并打印到 stderr。
+// 浏览器中的任意网页都能向 127.0.0.1 发请求，因此：
+//   - Host 必须是回环地址、localhost 或 -allow-host 列出的名字，防止 DNS rebinding 把恶意域名解析到本机
+//   - 带 Origin 的请求只接受同源或 -allow-origin 列出的来源
+//   - 请求体必须是 Content-Type: application/json（跨站表单与 text/plain 的“简单请求”会被拒绝）
+
+const (
+	maxLoggedEvents    = 1000 // 每个会话保留的事件数，用于断线续传
+	maxRequestBodySize = 8 << 20
+)
+
+// APIServer 管理会话并处理 HTTP 请求
+type APIServer struct {
+	agent           *agent.Agent
+	token           string
+	allowedOrigins  map[string]bool // 除同源外允许的 Origin，例如 http://localhost:3000
+	allowedHosts    map[string]bool // 除回环地址外允许的 Host（不含端口），例如监听 0.0.0.0 时的机器名
+	requireApproval bool            // 每次工具调用都需要通过 approvals 接口批准
+	approvalTimeout time.Duration   // 超时未审批视为拒绝，0 表示一直等待
+
+	ctx      context.Context // 服务关闭时取消所有进行中的轮次
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+func NewAPIServer(ctx context.Context, a *agent.Agent) *APIServer {
+	return &APIServer{agent: a, ctx: ctx, sessions: map[string]*serverSession{}}
+}
+
+// serverSession 是 HTTP 侧的会话状态：事件日志、进行中的轮次与待审批的工具调用
+type serverSession struct {
+	*agent.Session
+	Created   time.Time
+	events    *eventLog
+	ephemeral bool // /v1/chat/completions 创建的临时会话，请求结束即删除
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // 非 nil 表示有一轮正在进行
+	pending map[string]*pendingApproval
+}
+
+type pendingApproval struct {
+	Request  agent.ToolApprovalRequested
+	decision chan approvalDecision
+}
+
+type approvalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Handler 返回注册了所有路由的 http.Handler
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /v1/sessions", s.handleListSessions)
+	mux.HandleFunc("GET /v1/sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("DELETE /v1/sessions/{id}", s.handleDeleteSession)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", s.handlePostMessage)
+	mux.HandleFunc("POST /v1/sessions/{id}/cancel", s.handleCancel)
+	mux.HandleFunc("GET /v1/sessions/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /v1/sessions/{id}/approvals", s.handleListApprovals)
+	mux.HandleFunc("POST /v1/sessions/{id}/approvals/{call_id}", s.handleApprove)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("GET /v1/ws", s.handleWebSocket)
+	mux.HandleFunc("GET /v1/ws/schema", s.handleWebSocketSchema)
+	return s.authenticate(mux)
+}
+
+func (s *APIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hostAllowed(r) {
+			writeAPIError(w, http.StatusForbidden, "host "+strconv.Quote(r.Host)+" is not allowed")
+			return
+		}
+		if !s.originAllowed(r) {
+			writeAPIError(w, http.StatusForbidden, "cross-origin request from "+r.Header.Get("Origin")+" is not allowed")
+			return
+		}
+		// 没有 token 时拒绝所有请求，而不是放行
+		if s.token == "" || !s.authorized(r) {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized 检查 Authorization 头；WebSocket 握手还可以用 token 查询参数或 bearer.<token> 子协议
+func (s *APIServer) authorized(r *http.Request) bool {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) == 1 {
+		return true
+	}
+	if r.URL.Path != "/v1/ws" {
+		return false
+	}
+	for _, token := range wsTokens(r) {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// hostAllowed 只接受回环地址、localhost 与 allowedHosts 中的 Host
+func (s *APIServer) hostAllowed(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || s.allowedHosts[host] {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// originAllowed 接受不带 Origin 的请求（非浏览器客户端）、同源请求与 allowedOrigins 中的来源
+func (s *APIServer) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if s.allowedOrigins[strings.TrimSuffix(origin, "/")] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, r.Host)
+}
+
+// -------------------------- 会话 --------------------------
+
+// newSession 创建并登记一个会话
+func (s *APIServer) newSession(session *agent.Session, ephemeral bool) *serverSession {
+	ss := &serverSession{
+		Session:   session,
+		Created:   time.Now(),
+		events:    newEventLog(),
+		ephemeral: ephemeral,
+		pending:   map[string]*pendingApproval{},
+	}
+	session.Subscribe(ss.events)
+	if s.requireApproval {
+		session.SetApprover(ss.waitForApproval(s.approvalTimeout))
+	}
+	s.mu.Lock()
+	s.sessions[session.ID] = ss
+	s.mu.Unlock()
+	return ss
+}
+
+func (s *APIServer) session(w http.ResponseWriter, r *http.Request) (*serverSession, bool) {
+	s.mu.Lock()
+	ss, ok := s.sessions[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("session %q not found", r.PathValue("id")))
+	}
+	return ss, ok
+}
+
+// removeSession 取消进行中的一轮并关闭事件流
+func (s *APIServer) removeSession(ss *serverSession) {
+	s.mu.Lock()
+	delete(s.sessions, ss.ID)
+	s.mu.Unlock()
+	ss.cancelTurn()
+	ss.events.close()
+	fileCheckpoints.Remove(ss.ID)
+}
+
+// startTurn 标记会话开始新的一轮；已有一轮在进行时返回 false
+func (ss *serverSession) startTurn(parent context.Context) (context.Context, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.cancel != nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(parent)
+	ss.cancel = cancel
+	return ctx, true
+}
+
+func (ss *serverSession) endTurn() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.cancel != nil {
+		ss.cancel()
+		ss.cancel = nil
+	}
+}
+
+// cancelTurn 取消进行中的一轮；本轮在工具循环退出后才结束，期间仍视为忙碌
+func (ss *serverSession) cancelTurn() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.cancel == nil {
+		return false
+	}
+	ss.cancel()
+	return true
+}
+
+type turnResult struct {
+	reply string
+	err   error
+}
+
+// sendAsync 在后台执行一轮，结果写入返回的 channel；已有一轮在进行时返回 false
+func (ss *serverSession) sendAsync(parent context.Context, content string) (<-chan turnResult, bool) {
+	ctx, ok := ss.startTurn(parent)
+	if !ok {
+		return nil, false
+	}
+	done := make(chan turnResult, 1)
+	go func() {
+		defer ss.endTurn()
+		reply, err := ss.Send(ctx, content)
+		done <- turnResult{reply, err}
+	}()
+	return done, true
+}
+
+// sessionInfo 是会话在 API 中的表示
+type sessionInfo struct {
+	ID               string                              `json:"id"`
+	Created          time.Time                           `json:"created"`
+	Busy             bool                                `json:"busy"`
+	Ephemeral        bool                                `json:"ephemeral,omitempty"`
+	Usage            agent.TokenUsage                    `json:"usage"`
+	PendingApprovals []agent.ToolApprovalRequested       `json:"pending_approvals"`
+	Messages         []agent.OpenAIChatCompletionMessage `json:"messages,omitempty"`
+}
+
+func (ss *serverSession) info(withMessages bool) sessionInfo {
+	info := sessionInfo{
+		ID:               ss.ID,
+		Created:          ss.Created,
+		Ephemeral:        ss.ephemeral,
+		Usage:            ss.Usage().Session(),
+		PendingApprovals: ss.pendingApprovals(),
+	}
+	ss.mu.Lock()
+	info.Busy = ss.cancel != nil
+	ss.mu.Unlock()
+	if withMessages {
+		info.Messages = ss.Messages()
+	}
+	return info
+}
+
+func (s *APIServer) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	ss := s.newSession(s.agent.NewSession(), false)
+	writeJSON(w, http.StatusCreated, ss.info(false))
+}
+
+func (s *APIServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	list := make([]sessionInfo, 0, len(s.sessions))
+	for _, ss := range s.sessions {
+		list = append(list, ss.info(false))
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": list})
+}
+
+func (s *APIServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	if ss, ok := s.session(w, r); ok {
+		writeJSON(w, http.StatusOK, ss.info(true))
+	}
+}
+
+func (s *APIServer) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if ss, ok := s.session(w, r); ok {
+		s.removeSession(ss)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// postMessageRequest 是 POST /v1/sessions/{id}/messages 的请求体
+type postMessageRequest struct {
+	Content string `json:"content"`
+	Wait    bool   `json:"wait,omitempty"` // 为 true 时等待本轮结束并返回回复
+}
+
+func (s *APIServer) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	ss, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	var req postMessageRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeAPIError(w, http.StatusBadRequest, "content must not be empty")
+		return
+	}
+	done, ok := ss.sendAsync(s.ctx, req.Content)
+	if !ok {
+		writeAPIError(w, http.StatusConflict, "a turn is already running in this session")
+		return
+	}
+	if !req.Wait {
+		// 结果通过事件流获取
+		writeJSON(w, http.StatusAccepted, map[string]any{"session_id": ss.ID, "status": "running"})
+		return
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			writeAPIError(w, turnErrorStatus(res.err), res.err.Error())
+			return
+		}
+		turn, _ := ss.Usage().LastTurn()
+		writeJSON(w, http.StatusOK, map[string]any{"session_id": ss.ID, "reply": res.reply, "usage": turn.Total})
+	case <-r.Context().Done():
+		// 客户端断开不取消本轮，结果仍会进入事件流
+	}
+}
+
+func (s *APIServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	ss, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	if !ss.cancelTurn() {
+		writeAPIError(w, http.StatusConflict, "no turn is running in this session")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// turnErrorStatus 把一轮的错误映射为 HTTP 状态码
+func turnErrorStatus(err error) int {
+	var budgetErr *agent.BudgetExceededError
+	var filterErr *agent.ContentFilterError
+	var refusalErr *agent.RefusalError
+	switch {
+	case errors.As(err, &budgetErr):
+		return http.StatusPaymentRequired
+	case errors.As(err, &filterErr), errors.As(err, &refusalErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.Canceled):
+		return http.StatusConflict
+	}
+	return http.StatusBadGateway
+}
+
+// -------------------------- SSE 事件流 --------------------------
+
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ss, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	after := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		after, _ = strconv.Atoi(v)
+	} else if v := r.URL.Query().Get("after"); v != "" {
+		after, _ = strconv.Atoi(v)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		events, changed, closed := ss.events.since(after)
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+			after = e.Seq
+		}
+		flusher.Flush()
+		if closed {
+			return
+		}
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// loggedEvent 是带序号的事件，SSE 与其他传输共用这一 JSON 形式
+type loggedEvent struct {
+	Seq  int         `json:"seq"`
+	Type string      `json:"type"`
+	Data agent.Event `json:"data"`
+}
+
+// eventLog 保存会话最近的事件，供多个读者各自按序号读取
+type eventLog struct {
+	mu      sync.Mutex
+	events  []loggedEvent
+	next    int
+	changed chan struct{} // 有新事件或关闭时 close 并替换
+	closed  bool
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{next: 1, changed: make(chan struct{})}
+}
+
+func (l *eventLog) HandleEvent(e agent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.events = append(l.events, loggedEvent{Seq: l.next, Type: e.Type(), Data: e})
+	l.next++
+	if len(l.events) > maxLoggedEvents {
+		l.events = l.events[len(l.events)-maxLoggedEvents:]
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since 返回序号大于 after 的事件，以及下次有变化时会被关闭的 channel
+func (l *eventLog) since(after int) ([]loggedEvent, <-chan struct{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := sort.Search(len(l.events), func(i int) bool { return l.events[i].Seq > after })
+	return append([]loggedEvent(nil), l.events[i:]...), l.changed, l.closed
+}
+
+func (l *eventLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+}
+
+// -------------------------- 工具审批 --------------------------
+
+// waitForApproval 返回的 approver 把工具调用登记为待审批，直到 approvals 接口作出决定
+func (ss *serverSession) waitForApproval(timeout time.Duration) agent.ToolApprover {
+	return func(ctx context.Context, call agent.ToolApprovalRequested) error {
+		p := &pendingApproval{Request: call, decision: make(chan approvalDecision, 1)}
+		ss.mu.Lock()
+		ss.pending[call.CallID] = p
+		ss.mu.Unlock()
+		defer func() {
+			ss.mu.Lock()
+			delete(ss.pending, call.CallID)
+			ss.mu.Unlock()
+		}()
+
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case d := <-p.decision:
+			if !d.Approved {
+				return &agent.ToolDeniedError{Tool: call.Name, Reason: d.Reason}
+			}
+			return nil
+		case <-expired:
+			return &agent.ToolDeniedError{Tool: call.Name, Reason: "no approval within " + timeout.String()}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (ss *serverSession) pendingApprovals() []agent.ToolApprovalRequested {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	list := make([]agent.ToolApprovalRequested, 0, len(ss.pending))
+	for _, p := range ss.pending {
+		list = append(list, p.Request)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	return list
+}
+
+// decide 把审批结果交给等待中的工具调用
+func (ss *serverSession) decide(callID string, d approvalDecision) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	p, ok := ss.pending[callID]
+	if !ok {
+		return false
+	}
+	delete(ss.pending, callID)
+	p.decision <- d
+	return true
+}
+
+func (s *APIServer) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	if ss, ok := s.session(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{"approvals": ss.pendingApprovals()})
+	}
+}
+
+func (s *APIServer) handleApprove(w http.ResponseWriter, r *http.Request) {
+	ss, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	var d approvalDecision
+	if !decodeRequest(w, r, &d) {
+		return
+	}
+	if !ss.decide(r.PathValue("call_id"), d) {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no pending approval for tool call %q", r.PathValue("call_id")))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// -------------------------- OpenAI 兼容接口 --------------------------
+// 客户端把 gomockAgent 当作普通的 chat completions 服务使用：最后一条必须是 user 消息，
+// 之前的消息作为对话历史；工具循环在服务端执行，只返回最终回复。请求中的 model 与采样参数被忽略，
+// 以服务端的 profile 为准。需要审批时，临时会话会出现在 /v1/sessions 中（ephemeral），
+// 其 ID 即响应 ID 去掉 "chatcmpl-" 前缀。
+
+// chatCompletionChunk 是 stream=true 时的响应块
+type chatCompletionChunk struct {
+	ID      string                     `json:"id"`
+	Object  string                     `json:"object"`
+	Created int64                      `json:"created"`
+	Model   string                     `json:"model"`
+	Choices []chatCompletionChunkDelta `json:"choices"`
+	Usage   *agent.OpenAIUsage         `json:"usage,omitempty"`
+}
+
+type chatCompletionChunkDelta struct {
+	Index int `json:"index"`
+	Delta struct {
+		Role    string `json:"role,omitempty"`
+		Content string `json:"content,omitempty"`
+	} `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+func (s *APIServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		agent.OpenAIChatCompletionRequest
+		Stream bool `json:"stream"`
+	}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	n := len(req.Messages)
+	if n == 0 || req.Messages[n-1].Role != "user" {
+		writeAPIError(w, http.StatusBadRequest, "the last message must have role \"user\"")
+		return
+	}
+
+	// content 可以是字符串或内容数组，图片等部分原样转发给模型
+	prompt := req.Messages[n-1]
+	ss := s.newSession(s.agent.ResumeSession(req.Messages[:n-1]), true)
+	defer s.removeSession(ss)
+	ctx, _ := ss.startTurn(r.Context()) // 客户端断开时取消本轮
+	defer ss.endTurn()
+
+	id := "chatcmpl-" + ss.ID
+	created := time.Now().Unix()
+	model := s.agent.Model()
+	if !req.Stream {
+		reply, err := ss.SendParts(ctx, prompt.Content, prompt.Parts)
+		if err != nil {
+			writeAPIError(w, turnErrorStatus(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, agent.OpenAIChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: created,
+			Model:   model,
+			Choices: []agent.OpenAIChatCompletionChoice{{
+				Message:      agent.OpenAIChatCompletionMessage{Role: "assistant", Content: reply},
+				FinishReason: "stop",
+			}},
+			Usage: openAIUsage(ss.Usage().Session()),
+		})
+		return
+	}
+
+	// 流式：每条助手文本作为一个 delta 发送，工具调用在服务端完成，不出现在流中
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	var writeMu sync.Mutex
+	send := func(chunk chatCompletionChunk) {
+		chunk.ID, chunk.Object, chunk.Created, chunk.Model = id, "chat.completion.chunk", created, model
+		data, _ := json.Marshal(chunk)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	first := chatCompletionChunkDelta{}
+	first.Delta.Role = "assistant"
+	send(chatCompletionChunk{Choices: []chatCompletionChunkDelta{first}})
+
+	wrote := false
+	unsubscribe := ss.Subscribe(agent.SubscriberFunc(func(e agent.Event) {
+		if text, ok := e.(agent.AssistantTextDelta); ok {
+			delta := chatCompletionChunkDelta{}
+			if wrote {
+				delta.Delta.Content = "\n\n"
+			}
+			delta.Delta.Content += text.Text
+			wrote = true
+			send(chatCompletionChunk{Choices: []chatCompletionChunkDelta{delta}})
+		}
+	}))
+	_, err := ss.SendParts(ctx, prompt.Content, prompt.Parts)
+	unsubscribe()
+
+	finishReason := "stop"
+	if err != nil {
+		// 响应头已发送，错误只能作为流中的一项告知客户端
+		writeMu.Lock()
+		data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": err.Error(), "type": "agent_error"}})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		writeMu.Unlock()
+		finishReason = "error"
+	}
+	last := chatCompletionChunkDelta{FinishReason: &finishReason}
+	send(chatCompletionChunk{Choices: []chatCompletionChunkDelta{last}, Usage: openAIUsage(ss.Usage().Session())})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func openAIUsage(u agent.TokenUsage) *agent.OpenAIUsage {
+	usage := &agent.OpenAIUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens(),
+	}
+	if u.CachedTokens > 0 {
+		usage.PromptTokensDetails = &agent.OpenAIPromptTokensDetails{CachedTokens: u.CachedTokens}
+	}
+	if u.ReasoningTokens > 0 {
+		usage.CompletionTokensDetails = &agent.OpenAICompletionTokensDetails{ReasoningTokens: u.ReasoningTokens}
+	}
+	return usage
+}
+
+// -------------------------- JSON 辅助函数 --------------------------
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "request body must be sent with Content-Type: application/json")
+		return false
+	}
+	body := http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError 使用与 OpenAI 相同的错误格式
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{
+		"message": message,
+		"type":    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		"code":    status,
+	}})
+}
+
+// -------------------------- 命令 --------------------------
+
+// runServeCommand 实现 gomockAgent serve
+func runServeCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "listen address")
+	token := fs.String("token", os.Getenv("GOMOCKAGENT_SERVE_TOKEN"), "bearer token required on every request (default $GOMOCKAGENT_SERVE_TOKEN, or a random token printed at startup)")
+	requireApproval := fs.Bool("require-approval", false, "hold every tool call until it is approved through the approvals endpoint")
+	approvalTimeout := fs.Duration("approval-timeout", 10*time.Minute, "deny tool calls that are not approved in time (0 = wait forever)")
+	allowedOrigins := map[string]bool{}
+	fs.Func("allow-origin", "browser origin allowed to call the API besides the same origin, e.g. http://localhost:3000; may be repeated", func(v string) error {
+		allowedOrigins[strings.TrimSuffix(v, "/")] = true
+		return nil
+	})
+	allowedHosts := map[string]bool{}
+	fs.Func("allow-host", "host name accepted in the Host header besides loopback addresses and localhost, e.g. when listening on 0.0.0.0; may be repeated", func(v string) error {
+		allowedHosts[strings.ToLower(v)] = true
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: gomockAgent serve [-addr host:port] [-token t] [-allow-origin url]... [-allow-host name]... [-require-approval] [-approval-timeout d]")
+	}
+	if *token == "" {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("failed to generate a token: %w", err)
+		}
+		*token = hex.EncodeToString(b)
+		fmt.Fprintf(os.Stderr, "No -token or $GOMOCKAGENT_SERVE_TOKEN given, generated token: %s\n", *token)
+	}
+
+	if err := checkOpenAIConfig(); err != nil {
+		return err
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	tools := builtinTools(config)
+	mcpTools, closeMCP := LoadMCPTools(context.Background(), config.MCPServers, tools)
+	defer closeMCP()
+	a, err := NewConfiguredAgent(append(tools, mcpTools...), config)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := NewAPIServer(ctx, a)
+	server.token = *token
+	server.allowedOrigins = allowedOrigins
+	server.allowedHosts = allowedHosts
+	server.requireApproval = *requireApproval
+	server.approvalTimeout = *approvalTimeout
+	httpServer := &http.Server{Addr: *addr, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	errc := make(chan error, 1)
+	go func() { errc <- httpServer.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "Serving gomockAgent API on http://%s\n", *addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
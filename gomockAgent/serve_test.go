@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gomockAgent/agent"
+)
+
+func TestServeRejectsCrossSiteRequests(t *testing.T) {
+	server := NewAPIServer(context.Background(), agent.New(agent.Options{Endpoint: "http://127.0.0.1:0"}))
+	server.token = "secret"
+	server.allowedOrigins = map[string]bool{"http://localhost:3000": true}
+	handler := server.Handler()
+
+	tests := []struct {
+		name        string
+		origin      string
+		contentType string
+		want        int
+	}{
+		{"simple text/plain POST", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"form POST", "", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"cross-site origin", "http://evil.example", "application/json", http.StatusForbidden},
+		{"cross-site origin with the same port", "http://attacker:8080", "application/json", http.StatusForbidden},
+		{"same origin", "http://127.0.0.1:8080", "application/json; charset=utf-8", http.StatusBadRequest},
+		{"allowed origin", "http://localhost:3000/", "application/json", http.StatusBadRequest},
+		{"no origin", "", "application/json", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 请求体缺少 messages，通过检查的请求得到 400
+			req := httptest.NewRequest("POST", "http://127.0.0.1:8080/v1/chat/completions", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer secret")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestServeRequiresTokenAndLoopbackHost(t *testing.T) {
+	newHandler := func(token string) http.Handler {
+		server := NewAPIServer(context.Background(), agent.New(agent.Options{Endpoint: "http://127.0.0.1:0"}))
+		server.token = token
+		server.allowedHosts = map[string]bool{"devbox": true}
+		return server.Handler()
+	}
+
+	tests := []struct {
+		name   string
+		token  string // 服务端配置的 token
+		host   string
+		bearer string
+		want   int
+	}{
+		{"no token configured", "", "127.0.0.1:8080", "", http.StatusUnauthorized},
+		{"missing token", "secret", "127.0.0.1:8080", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "127.0.0.1:8080", "wrong", http.StatusUnauthorized},
+		{"right token", "secret", "127.0.0.1:8080", "secret", http.StatusBadRequest},
+		{"localhost", "secret", "localhost:8080", "secret", http.StatusBadRequest},
+		{"ipv6 loopback", "secret", "[::1]:8080", "secret", http.StatusBadRequest},
+		{"allowed host", "secret", "devbox:8080", "secret", http.StatusBadRequest},
+		// DNS rebinding：恶意域名解析到 127.0.0.1，Host 仍是恶意域名
+		{"rebound host", "secret", "evil.example:8080", "secret", http.StatusForbidden},
+		{"rebound host without token", "secret", "evil.example", "", http.StatusForbidden},
+		{"lan address", "secret", "192.168.1.10:8080", "secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://127.0.0.1:8080/v1/chat/completions", strings.NewReader(`{}`))
+			req.Host = tt.host
+			req.Header.Set("Content-Type", "application/json")
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			newHandler(tt.token).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
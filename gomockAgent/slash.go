@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- REPL 斜杠命令 --------------------------
+
+// handleSlashCommand 处理以 "/" 开头的输入。handled=false 表示不是已知命令，
+// 输入将原样发送给模型；note 非空时作为系统消息追加到对话，让模型知晓状态变化。
+func (r *repl) handleSlashCommand(input string) (note string, handled bool) {
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/undo":
+		turn, diff, err := fileCheckpoints.Session(r.session.ID).Undo()
+		if err != nil {
+			fmt.Printf("\u001b[91mUndo Error\u001b[0m: %s\n", err.Error())
+			return "", true
+		}
+		printRestoreDiff(diff)
+		return fmt.Sprintf("The user reverted all file changes made in turn %d. Re-read files before editing them again.", turn), true
+
+	case "/rewind":
+		if len(fields) != 2 {
+			fmt.Println("Usage: /rewind <turn>")
+			return "", true
+		}
+		turn, err := strconv.Atoi(fields[1])
+		if err != nil {
+			fmt.Printf("\u001b[91mRewind Error\u001b[0m: invalid turn %q\n", fields[1])
+			return "", true
+		}
+		diff, err := fileCheckpoints.Session(r.session.ID).Rewind(turn)
+		if err != nil {
+			fmt.Printf("\u001b[91mRewind Error\u001b[0m: %s\n", err.Error())
+			return "", true
+		}
+		printRestoreDiff(diff)
+		return fmt.Sprintf("The user restored all files to their state before turn %d. Re-read files before editing them again.", turn), true
+
+	case "/usage":
+		if len(fields) > 1 && fields[1] == "json" {
+			data, err := json.MarshalIndent(r.session.Usage().Report(), "", "  ")
+			if err != nil {
+				fmt.Printf("\u001b[91mUsage Error\u001b[0m: %s\n", err.Error())
+				return "", true
+			}
+			fmt.Println(string(data))
+			return "", true
+		}
+		if turn, ok := r.session.Usage().LastTurn(); ok {
+			fmt.Printf("last turn (%d): %s\n", turn.Turn, turn.Total)
+			for i, call := range turn.Calls {
+				fmt.Printf("    call %d: %s\n", i+1, call)
+			}
+		}
+		fmt.Printf("session: %d calls, %s\n", r.session.Usage().Session().Calls, r.session.Usage().Session())
+		if b := r.session.Usage().Budget(); b.MaxCostUSD > 0 || b.MaxTokens > 0 {
+			fmt.Printf("budget: $%.4f, %d tokens (0 = unlimited)\n", b.MaxCostUSD, b.MaxTokens)
+		}
+		return "", true
+
+	case "/budget":
+		if len(fields) < 2 || len(fields) > 3 {
+			fmt.Println("Usage: /budget <max-usd> [max-tokens]  (0 = unlimited)")
+			return "", true
+		}
+		var budget agent.BudgetConfig
+		var err error
+		if budget.MaxCostUSD, err = strconv.ParseFloat(strings.TrimPrefix(fields[1], "$"), 64); err != nil {
+			fmt.Printf("\u001b[91mBudget Error\u001b[0m: invalid amount %q\n", fields[1])
+			return "", true
+		}
+		if len(fields) == 3 {
+			if budget.MaxTokens, err = strconv.Atoi(fields[2]); err != nil {
+				fmt.Printf("\u001b[91mBudget Error\u001b[0m: invalid token count %q\n", fields[2])
+				return "", true
+			}
+		}
+		r.session.Usage().SetBudget(budget)
+		fmt.Printf("Budget set to $%.4f, %d tokens.\n", budget.MaxCostUSD, budget.MaxTokens)
+		return "", true
+
+	case "/repairs":
+		models, stats := r.agent.RepairStats()
+		if len(models) == 0 {
+			fmt.Println("No tool calls recorded in this session.")
+		}
+		for _, m := range models {
+			s := stats[m]
+			fmt.Printf("%s: %d tool calls, %d repaired, %d failed\n", m, s.Calls, s.Repaired, s.Failed)
+			kinds := make([]string, 0, len(s.Kinds))
+			for k := range s.Kinds {
+				kinds = append(kinds, k)
+			}
+			sort.Strings(kinds)
+			for _, k := range kinds {
+				fmt.Printf("    %-40s %d\n", k, s.Kinds[k])
+			}
+		}
+		return "", true
+
+	case "/checkpoints":
+		turns := fileCheckpoints.Session(r.session.ID).Turns()
+		if len(turns) == 0 {
+			fmt.Println("No file changes recorded in this session.")
+		}
+		for _, t := range turns {
+			fmt.Printf("turn %d: %q\n", t.Turn, t.Prompt)
+			for _, f := range t.Files() {
+				fmt.Printf("    %s\n", displayPath(f))
+			}
+		}
+		return "", true
+	}
+	return "", false
+}
+
+func printRestoreDiff(diff string) {
+	if diff == "" {
+		fmt.Println("Files already match the checkpoint, nothing changed.")
+		return
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Print(line)
+		case strings.HasPrefix(line, "+"):
+			fmt.Printf("\u001b[92m%s\u001b[0m", line)
+		case strings.HasPrefix(line, "-"):
+			fmt.Printf("\u001b[91m%s\u001b[0m", line)
+		default:
+			fmt.Print(line)
+		}
+	}
+}
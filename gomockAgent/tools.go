@@ -1,51 +1,34 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/invopop/jsonschema"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"gomockAgent/agent"
 )
 
-type ToolDefinition struct {
-	Name        string
-	Description string
-	// InputSchema now map[string]any to match OpenAI's parameter schema format
-	InputSchema map[string]any
-	Function    func(input json.RawMessage) (string, error) // Input is JSON string from OpenAI args
-}
-
 // -------------------------- 工具实现 --------------------------
 
 // -------------------------- read_file --------------------------
 type ReadFileInput struct { // Defines the input structure for the tool
-	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory." jsonschema:"required"`
+	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory." jsonschema:"required,minLength=1"`
 }
 
-// 工具定义
-var ReadFileDefinition = ToolDefinition{
-	Name:        "read_file",
-	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
-	InputSchema: GenerateSchema[ReadFileInput](),
-	Function:    ReadFile, // Function implementation remains the same
-}
+// 工具定义；参数解析与校验由 NewTool 完成
+var ReadFileDefinition = agent.NewTool(
+	"read_file",
+	"Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
+	ReadFile,
+)
 
-func ReadFile(input json.RawMessage) (string, error) { // Implementation unchanged
-	readFileInput := ReadFileInput{}
-	err := json.Unmarshal(input, &readFileInput)
+func ReadFile(ctx context.Context, input ReadFileInput) (string, error) {
+	content, err := os.ReadFile(input.Path)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse input for read_file: %w. Input was: %s", err, string(input))
-	}
-	if readFileInput.Path == "" {
-		return "", fmt.Errorf("missing required parameter 'path' for read_file")
-	}
-	content, err := os.ReadFile(readFileInput.Path)
-	if err != nil {
-		return "", fmt.Errorf("error reading file '%s': %w", readFileInput.Path, err)
+		return "", fmt.Errorf("error reading file '%s': %w", input.Path, err)
 	}
 	return string(content), nil
 }
@@ -55,22 +38,13 @@ type ListFilesInput struct {
 	Path string `json:"path,omitempty" jsonschema_description:"Optional relative path to list files from. Defaults to current directory if not provided."`
 }
 
-var ListFilesDefinition = ToolDefinition{
-	Name:        "list_files",
-	Description: "List files and directories at a given path. If no path is provided, lists files in the current directory. Returns a JSON array of strings, directories have a trailing slash.",
-	InputSchema: GenerateSchema[ListFilesInput](),
-	Function:    ListFiles, // Function implementation remains the same
-}
+var ListFilesDefinition = agent.NewTool(
+	"list_files",
+	"List files and directories at a given path. If no path is provided, lists files in the current directory. Returns a JSON array of strings, directories have a trailing slash.",
+	ListFiles,
+)
 
-// ListFiles function implementation unchanged
-func ListFiles(input json.RawMessage) (string, error) {
-	listFilesInput := ListFilesInput{}
-	if len(input) > 0 && string(input) != "null" {
-		err := json.Unmarshal(input, &listFilesInput)
-		if err != nil {
-			return "", fmt.Errorf("failed to parse input for list_files: %w. Input was: %s", err, string(input))
-		}
-	}
+func ListFiles(ctx context.Context, listFilesInput ListFilesInput) ([]string, error) {
 	dir := "."
 	if listFilesInput.Path != "" {
 		dir = listFilesInput.Path
@@ -95,63 +69,74 @@ func ListFiles(input json.RawMessage) (string, error) {
 		return nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("error listing files in '%s': %w", dir, err)
+		return nil, fmt.Errorf("error listing files in '%s': %w", dir, err)
 	}
-	result, err := json.Marshal(files)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal file list to JSON: %w", err)
-	}
-	return string(result), nil
+	return files, nil
 }
 
-// GenerateSchema adapted to return map[string]any
-func GenerateSchema[T any]() map[string]any {
-	reflector := jsonschema.Reflector{
-		AllowAdditionalProperties:  false,
-		DoNotReference:             true, // Keep definitions inline for OpenAI
-		RequiredFromJSONSchemaTags: true, // Respect `jsonschema:"required"`
+// -------------------------- edit_file --------------------------
+type EditFileInput struct {
+	Path   string `json:"path" jsonschema_description:"The path to the file." jsonschema:"required,minLength=1"`
+	OldStr string `json:"old_str,omitempty" jsonschema_description:"Text to search for. Must match exactly and occur exactly once. Leave empty to create a new file."`
+	NewStr string `json:"new_str" jsonschema_description:"Text to replace old_str with, or the content of the new file." jsonschema:"required"`
+}
+
+var EditFileDefinition = agent.NewTool(
+	"edit_file",
+	"Make edits to a text file. Replaces 'old_str' with 'new_str' in the given file; 'old_str' must occur exactly once. If the file does not exist and 'old_str' is empty, the file is created. Go files are formatted with goimports afterwards and the package is checked with go build and go vet; any diagnostics are included in the result.",
+	EditFile,
+)
+
+func EditFile(ctx context.Context, editFileInput EditFileInput) (string, error) {
+	if editFileInput.OldStr == editFileInput.NewStr {
+		return "", fmt.Errorf("'old_str' and 'new_str' must be different")
 	}
-	var v T
-	schema := reflector.Reflect(v)
-
-	// Convert the jsonschema.Schema to map[string]any expected by OpenAI
-	// This is a simplification; a full conversion might be more complex
-	schemaBytes, _ := json.Marshal(schema)
-	var schemaMap map[string]any
-	_ = json.Unmarshal(schemaBytes, &schemaMap)
-
-	// OpenAI expects parameters schema directly, remove unnecessary outer layers if present
-	if props, ok := schemaMap["properties"]; ok {
-		schemaMap["properties"] = props
+
+	content, err := os.ReadFile(editFileInput.Path)
+	if os.IsNotExist(err) && editFileInput.OldStr == "" {
+		if dir := filepath.Dir(editFileInput.Path); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return "", fmt.Errorf("failed to create directory '%s': %w", dir, err)
+			}
+		}
+		if err := writeFileWithCheckpoint(ctx, editFileInput.Path, []byte(editFileInput.NewStr), 0o644); err != nil {
+			return "", fmt.Errorf("error writing file '%s': %w", editFileInput.Path, err)
+		}
+		return withGoDiagnostics(ctx, "Successfully created file "+editFileInput.Path, editFileInput.Path), nil
 	}
-	if req, ok := schemaMap["required"]; ok {
-		schemaMap["required"] = req
+	if err != nil {
+		return "", fmt.Errorf("error reading file '%s': %w", editFileInput.Path, err)
 	}
-	schemaMap["type"] = "object" // Ensure root type is object
 
-	return schemaMap
+	oldContent := string(content)
+	switch n := strings.Count(oldContent, editFileInput.OldStr); {
+	case editFileInput.OldStr == "":
+		return "", fmt.Errorf("file '%s' already exists, 'old_str' must not be empty", editFileInput.Path)
+	case n == 0:
+		return "", fmt.Errorf("'old_str' not found in file '%s'", editFileInput.Path)
+	case n > 1:
+		return "", fmt.Errorf("'old_str' found %d times in file '%s', it must be unique", n, editFileInput.Path)
+	}
+	newContent := strings.Replace(oldContent, editFileInput.OldStr, editFileInput.NewStr, 1)
+	if err := writeFileWithCheckpoint(ctx, editFileInput.Path, []byte(newContent), 0o644); err != nil {
+		return "", fmt.Errorf("error writing file '%s': %w", editFileInput.Path, err)
+	}
+	return withGoDiagnostics(ctx, "OK", editFileInput.Path), nil
 }
 
 // -------------------------- 工具实现 --------------------------
 type GetMergeDiffInput struct {
-	ProjectId int `json:"project_id" jsonschema_description:"gitlab project id." jsonschema:"required"`
-	MergeId   int `json:"merge_id" jsonschema_description:"gitlab merge request id." jsonschema:"required"`
-}
-
-var GetMergeDiffDefinition = ToolDefinition{
-	Name:        "get_merge_diff",
-	Description: "Get the diff of a merge request.",
-	InputSchema: GenerateSchema[GetMergeDiffInput](),
-	Function:    GetMergeDiff,
+	ProjectId int `json:"project_id" jsonschema_description:"gitlab project id." jsonschema:"required,minimum=1"`
+	MergeId   int `json:"merge_id" jsonschema_description:"gitlab merge request id." jsonschema:"required,minimum=1"`
 }
 
-func GetMergeDiff(input json.RawMessage) (string, error) {
-	getMergeDiffInput := GetMergeDiffInput{}
-	err := json.Unmarshal(input, &getMergeDiffInput)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse input for get_merge_diff: %w. Input was: %s", err, string(input))
-	}
+var GetMergeDiffDefinition = agent.NewTool(
+	"get_merge_diff",
+	"Get the diff of a merge request.",
+	GetMergeDiff,
+)
 
+func GetMergeDiff(ctx context.Context, getMergeDiffInput GetMergeDiffInput) (string, error) {
 	gitClient, err := gitlab.NewClient(os.Getenv("GITLAB_TOKEN"), gitlab.WithBaseURL(os.Getenv("GITLAB_API_URL")))
 	if err != nil {
 		return "", fmt.Errorf("failed to create GitLab client: %w", err)
@@ -164,7 +149,7 @@ func GetMergeDiff(input json.RawMessage) (string, error) {
 			ListOptions: gitlab.ListOptions{
 				Page: page,
 			},
-		})
+		}, gitlab.WithContext(ctx))
 		if err != nil {
 			return "", fmt.Errorf("failed to get MR changes: %w", err)
 		}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- TUI --------------------------
+// 终端是交互式时 REPL 使用全屏界面：可滚动的对话记录、多行输入、持久化的输入历史、
+// Markdown 与代码块高亮、可折叠的工具调用面板，以及显示模型、token 与费用的状态栏。
+// 设置 GOMOCKAGENT_TUI=0 或输入输出不是终端时使用逐行读取的 REPL。
+//
+// 界面运行期间 os.Stdout 与 os.Stderr 被重定向，斜杠命令和工具打印的内容显示在对话记录中。
+//
+// 按键：
+//
+//	enter              发送；alt+enter / ctrl+j 换行
+//	up / down          在首行 / 末行时浏览历史（ctrl+p / ctrl+n 任意位置）
+//	tab                补全输入末尾的 @ 引用路径
+//	pgup / pgdown      滚动对话记录
+//	ctrl+t / ctrl+o    展开或折叠最近一个 / 全部工具调用面板
+//	esc / ctrl+c       取消进行中的一轮；空闲时 ctrl+c 或 ctrl+d 退出
+
+const (
+	maxInputHeight          = 10 // 输入框最多显示的行数，超出部分可滚动
+	maxToolPanelLines       = 40 // 展开的工具面板中结果最多显示的行数
+	maxToolHeaderWidth      = 80
+	maxCompletionCandidates = 30
+)
+
+// useTUI 判断是否使用全屏界面
+func useTUI() bool {
+	if v := os.Getenv("GOMOCKAGENT_TUI"); v == "0" || v == "false" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+type tuiEntryKind int
+
+const (
+	entryUser tuiEntryKind = iota
+	entryAssistant
+	entryTool
+	entryNotice
+	entryError
+	entryOutput // 斜杠命令与工具打印的内容
+)
+
+type tuiEntry struct {
+	kind      tuiEntryKind
+	text      string
+	call      agent.ToolCallStarted
+	result    *agent.ToolCallFinished // nil 表示工具仍在运行
+	collapsed bool
+	captured  bool // 来自重定向的输出，后续输出并入同一条记录
+
+	rendered      string // Markdown 渲染结果，宽度变化时重新渲染
+	renderedWidth int
+}
+
+// 发送给界面的消息
+type (
+	eventMsg     struct{ event agent.Event }
+	turnDoneMsg  struct{}
+	slashDoneMsg struct{ note string }
+	outputMsg    string
+	askReply     struct {
+		text string
+		ok   bool
+	}
+	askMsg struct {
+		question string
+		reply    chan askReply
+	}
+	editorMsg struct {
+		cmd  *exec.Cmd
+		done chan error
+	}
+)
+
+var (
+	userLabelStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Bold(true)
+	aiLabelStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Bold(true)
+	toolStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	toolErrorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	noticeStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	errorStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)
+	dimStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	toolPanelStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+	statusBarStyle   = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("252")).Padding(0, 1)
+	inputBorderStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true, false, false, false).BorderForeground(lipgloss.Color("8"))
+)
+
+type tuiModel struct {
+	repl    *repl
+	history *inputHistory
+	program *tea.Program
+
+	viewport viewport.Model
+	input    textarea.Model
+	spinner  spinner.Model
+	width    int
+	height   int
+	ready    bool
+
+	entries []*tuiEntry
+	tools   map[string]*tuiEntry // call id → 工具面板
+
+	historyPos int    // 正在浏览的历史位置，len(history) 表示草稿
+	draft      string // 开始浏览历史前的输入
+
+	busy    bool
+	cancel  context.CancelFunc
+	started time.Time
+	usage   agent.TokenUsage
+	ask     *askMsg // 工具正在等待用户回答
+
+	markdownStyle string
+	renderer      *glamour.TermRenderer
+	rendererWidth int
+}
+
+func newTUIModel(r *repl, history *inputHistory, markdownStyle string) *tuiModel {
+	input := textarea.New()
+	input.Placeholder = "Ask anything, /usage, /undo … (alt+enter for a new line)"
+	input.ShowLineNumbers = false
+	input.Prompt = "› "
+	input.CharLimit = 0 // 允许粘贴大段代码
+	input.MaxHeight = 0
+	input.SetHeight(1)
+	input.FocusedStyle.CursorLine = lipgloss.NewStyle()
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+
+	m := &tuiModel{
+		repl:          r,
+		history:       history,
+		input:         input,
+		spinner:       sp,
+		tools:         map[string]*tuiEntry{},
+		historyPos:    len(history.Entries()),
+		markdownStyle: markdownStyle,
+	}
+	m.viewport = viewport.New(0, 0)
+	m.viewport.KeyMap = viewport.KeyMap{
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+	}
+	return m
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.spinner.Tick)
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.SetWidth(msg.Width)
+		m.ready = true
+		m.layout()
+		m.refresh()
+		return m, nil
+
+	case tea.KeyMsg:
+		if cmd, handled := m.handleKey(msg); handled {
+			return m, cmd
+		}
+
+	case eventMsg:
+		m.handleEvent(msg.event)
+		m.refresh()
+		return m, nil
+
+	case turnDoneMsg:
+		m.busy = false
+		m.cancel = nil
+		m.refresh()
+		return m, nil
+
+	case slashDoneMsg:
+		if msg.note != "" {
+			m.repl.session.AddNote(msg.note)
+		}
+		return m, nil
+
+	case outputMsg:
+		m.appendOutput(string(msg))
+		m.refresh()
+		return m, nil
+
+	case askMsg:
+		m.ask = &msg
+		if msg.question != "" {
+			m.entries = append(m.entries, &tuiEntry{kind: entryNotice, text: msg.question})
+		}
+		m.input.Placeholder = "answer the question above (esc to cancel)"
+		m.refresh()
+		return m, nil
+
+	case editorMsg:
+		// 编辑器需要直接使用终端，界面暂停直到它退出
+		return m, tea.ExecProcess(msg.cmd, func(err error) tea.Msg {
+			msg.done <- err
+			return nil
+		})
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+	m.viewport, cmd = m.viewport.Update(msg)
+	cmds = append(cmds, cmd)
+	m.layout()
+	return m, tea.Batch(cmds...)
+}
+
+// handleKey 处理界面自己的按键，handled=false 时交给输入框与对话记录
+func (m *tuiModel) handleKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		switch {
+		case m.ask != nil:
+			m.answer("", false)
+		case m.busy:
+			m.cancel()
+			m.entries = append(m.entries, &tuiEntry{kind: entryNotice, text: "Cancelling…"})
+			m.refresh()
+		case msg.String() == "ctrl+c":
+			return tea.Quit, true
+		}
+		return nil, true
+
+	case "ctrl+d":
+		if !m.busy && m.ask == nil && m.input.Value() == "" {
+			return tea.Quit, true
+		}
+
+	case "enter":
+		text := m.input.Value()
+		if m.ask != nil {
+			m.input.Reset()
+			m.answer(text, true)
+			return nil, true
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil, true
+		}
+		if m.busy {
+			return nil, true // 保留输入，本轮结束后再发送
+		}
+		m.input.Reset()
+		m.layout()
+		return m.submit(text), true
+
+	case "up", "ctrl+p":
+		if msg.String() == "ctrl+p" || m.input.Line() == 0 {
+			m.browseHistory(-1)
+			return nil, true
+		}
+	case "down", "ctrl+n":
+		if msg.String() == "ctrl+n" || m.input.Line() == m.input.LineCount()-1 {
+			m.browseHistory(1)
+			return nil, true
+		}
+
+	case "tab":
+		if m.ask != nil {
+			break
+		}
+		completed, candidates, ok := completeMention(m.input.Value())
+		if !ok {
+			break
+		}
+		m.input.SetValue(completed)
+		if len(candidates) > 0 {
+			if len(candidates) > maxCompletionCandidates {
+				candidates = append(candidates[:maxCompletionCandidates], fmt.Sprintf("… %d more", len(candidates)-maxCompletionCandidates))
+			}
+			m.entries = append(m.entries, &tuiEntry{kind: entryOutput, text: dimStyle.Render(strings.Join(candidates, "  "))})
+			m.refresh()
+		}
+		m.layout()
+		return nil, true
+
+	case "ctrl+t":
+		for i := len(m.entries) - 1; i >= 0; i-- {
+			if m.entries[i].kind == entryTool {
+				m.entries[i].collapsed = !m.entries[i].collapsed
+				break
+			}
+		}
+		m.refresh()
+		return nil, true
+	case "ctrl+o":
+		collapse := false
+		for _, e := range m.entries {
+			if e.kind == entryTool && !e.collapsed {
+				collapse = true
+			}
+		}
+		for _, e := range m.entries {
+			if e.kind == entryTool {
+				e.collapsed = collapse
+			}
+		}
+		m.refresh()
+		return nil, true
+
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd, true
+	}
+	return nil, false
+}
+
+func (m *tuiModel) answer(text string, ok bool) {
+	m.ask.reply <- askReply{text: text, ok: ok}
+	m.ask = nil
+	m.input.Placeholder = "Ask anything, /usage, /undo … (alt+enter for a new line)"
+	if ok {
+		m.entries = append(m.entries, &tuiEntry{kind: entryUser, text: text})
+	}
+	m.refresh()
+}
+
+// submit 处理一次输入：斜杠命令或发送给会话
+func (m *tuiModel) submit(text string) tea.Cmd {
+	if err := m.history.Add(text); err != nil {
+		m.entries = append(m.entries, &tuiEntry{kind: entryError, text: err.Error()})
+	}
+	m.historyPos = len(m.history.Entries())
+	m.draft = ""
+
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "exit" || trimmed == "/exit" || trimmed == "/quit" {
+		return tea.Quit
+	}
+	m.entries = append(m.entries, &tuiEntry{kind: entryUser, text: text})
+	m.refresh()
+	m.viewport.GotoBottom()
+	if strings.HasPrefix(trimmed, "/") {
+		// 斜杠命令的输出经重定向的 stdout 进入对话记录；在后台运行，避免输出较多时阻塞界面
+		return func() tea.Msg {
+			note, handled := m.repl.handleSlashCommand(trimmed)
+			if !handled {
+				fmt.Printf("Unknown command %s\n", strings.Fields(trimmed)[0])
+			}
+			return slashDoneMsg{note: note}
+		}
+	}
+
+	exp := expandMentions(text)
+	if len(exp.attached) > 0 {
+		m.entries = append(m.entries, &tuiEntry{kind: entryOutput, text: dimStyle.Render("Attached: " + strings.Join(exp.attached, ", "))})
+	}
+	for _, w := range exp.warnings {
+		m.entries = append(m.entries, &tuiEntry{kind: entryNotice, text: "Warning: " + w})
+	}
+	m.refresh()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.busy, m.cancel, m.started = true, cancel, time.Now()
+	session := m.repl.session
+	return func() tea.Msg {
+		defer cancel()
+		_, _ = session.SendParts(ctx, text, exp.parts) // 结果与错误都以事件的形式到达
+		return turnDoneMsg{}
+	}
+}
+
+func (m *tuiModel) browseHistory(delta int) {
+	entries := m.history.Entries()
+	pos := m.historyPos + delta
+	if pos < 0 || pos > len(entries) {
+		return
+	}
+	if m.historyPos == len(entries) {
+		m.draft = m.input.Value()
+	}
+	m.historyPos = pos
+	if pos == len(entries) {
+		m.input.SetValue(m.draft)
+	} else {
+		m.input.SetValue(entries[pos])
+	}
+	m.layout()
+}
+
+func (m *tuiModel) handleEvent(e agent.Event) {
+	switch e := e.(type) {
+	case agent.AssistantTextDelta:
+		m.entries = append(m.entries, &tuiEntry{kind: entryAssistant, text: e.Text})
+	case agent.ToolCallStarted:
+		entry := &tuiEntry{kind: entryTool, call: e, collapsed: true}
+		m.tools[e.CallID] = entry
+		m.entries = append(m.entries, entry)
+	case agent.ToolCallFinished:
+		if entry, ok := m.tools[e.CallID]; ok {
+			entry.result = &e
+			if e.Error != "" {
+				entry.collapsed = false // 出错时默认展开
+			}
+		}
+	case agent.Notice:
+		m.entries = append(m.entries, &tuiEntry{kind: entryNotice, text: noticeTitle(e.Kind) + ": " + e.Message})
+	case agent.ErrorEvent:
+		m.entries = append(m.entries, &tuiEntry{kind: entryError, text: e.Message})
+	case agent.UsageUpdated:
+		m.usage = e.Session
+	case agent.TurnFinished:
+		if e.Usage.Calls > 0 {
+			m.entries = append(m.entries, &tuiEntry{kind: entryOutput, text: dimStyle.Render(fmt.Sprintf("[%d calls, %s]", e.Usage.Calls, e.Usage))})
+		}
+	}
+}
+
+// appendOutput 把捕获的输出并入最后一条输出记录
+func (m *tuiModel) appendOutput(text string) {
+	if n := len(m.entries); n > 0 && m.entries[n-1].captured {
+		m.entries[n-1].text += text
+		return
+	}
+	m.entries = append(m.entries, &tuiEntry{kind: entryOutput, text: text, captured: true})
+}
+
+// layout 根据输入内容调整输入框与对话记录的高度
+func (m *tuiModel) layout() {
+	if !m.ready {
+		return
+	}
+	inputHeight := min(max(m.input.LineCount(), 1), maxInputHeight)
+	m.input.SetHeight(inputHeight)
+	m.viewport.Width = m.width
+	m.viewport.Height = max(m.height-inputHeight-2, 1) // 输入框上边框与状态栏各占一行
+}
+
+// refresh 重新生成对话记录；原本在底部时保持跟随
+func (m *tuiModel) refresh() {
+	if !m.ready {
+		return
+	}
+	atBottom := m.viewport.AtBottom()
+	parts := make([]string, 0, len(m.entries))
+	for _, e := range m.entries {
+		parts = append(parts, m.renderEntry(e))
+	}
+	m.viewport.SetContent(strings.Join(parts, "\n"))
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *tuiModel) renderEntry(e *tuiEntry) string {
+	width := max(m.width-2, 20)
+	wrap := lipgloss.NewStyle().Width(width)
+	switch e.kind {
+	case entryUser:
+		return userLabelStyle.Render("You") + "\n" + wrap.Render(e.text) + "\n"
+	case entryAssistant:
+		return aiLabelStyle.Render("AI") + "\n" + m.renderMarkdown(e, width)
+	case entryTool:
+		return m.renderTool(e, width)
+	case entryNotice:
+		return noticeStyle.Width(width).Render(e.text)
+	case entryError:
+		return errorStyle.Width(width).Render("Error: " + e.text)
+	}
+	return strings.TrimRight(e.text, "\n")
+}
+
+func (m *tuiModel) renderMarkdown(e *tuiEntry, width int) string {
+	if e.rendered != "" && e.renderedWidth == width {
+		return e.rendered
+	}
+	if m.renderer == nil || m.rendererWidth != width {
+		r, err := glamour.NewTermRenderer(
+			glamour.WithStandardStyle(m.markdownStyle),
+			glamour.WithWordWrap(width),
+			glamour.WithColorProfile(lipgloss.ColorProfile()),
+		)
+		if err != nil {
+			return e.text
+		}
+		m.renderer, m.rendererWidth = r, width
+	}
+	out, err := m.renderer.Render(e.text)
+	if err != nil {
+		return e.text
+	}
+	e.rendered, e.renderedWidth = strings.Trim(out, "\n"), width
+	return e.rendered
+}
+
+func (m *tuiModel) renderTool(e *tuiEntry, width int) string {
+	arrow := "▾"
+	if e.collapsed {
+		arrow = "▸"
+	}
+	header := fmt.Sprintf("%s %s(%s)", arrow, e.call.Name, compactJSON(e.call.Arguments))
+	if len(header) > maxToolHeaderWidth {
+		header = header[:maxToolHeaderWidth-1] + "…"
+	}
+	style := toolStyle
+	switch {
+	case e.result == nil:
+		header += " " + m.spinner.View()
+	case e.result.Error != "":
+		header += " ✗"
+		style = toolErrorStyle
+	default:
+		header += fmt.Sprintf(" ✓ %s", e.result.Duration.Round(time.Millisecond))
+	}
+	header = style.Render(header)
+	if len(e.call.Repairs) > 0 {
+		header += dimStyle.Render("  (repaired: " + strings.Join(e.call.Repairs, ", ") + ")")
+	}
+	if e.collapsed {
+		return header
+	}
+
+	var body strings.Builder
+	body.WriteString(dimStyle.Render("arguments") + "\n" + prettyJSON(e.call.Arguments))
+	if e.result != nil {
+		if e.result.Error != "" {
+			body.WriteString("\n" + toolErrorStyle.Render("error") + "\n" + e.result.Error)
+		} else {
+			lines := strings.Split(strings.TrimRight(e.result.Output, "\n"), "\n")
+			if len(lines) > maxToolPanelLines {
+				more := len(lines) - maxToolPanelLines
+				lines = append(lines[:maxToolPanelLines], dimStyle.Render(fmt.Sprintf("… %d more lines", more)))
+			}
+			body.WriteString("\n" + dimStyle.Render("result") + "\n" + strings.Join(lines, "\n"))
+		}
+	}
+	return header + "\n" + toolPanelStyle.Width(width-2).Render(body.String())
+}
+
+func compactJSON(s string) string {
+	var v any
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func prettyJSON(s string) string {
+	var v any
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
+
+func (m *tuiModel) statusBar() string {
+	left := " " + m.repl.agent.Model()
+	if m.usage.Calls > 0 {
+		left += fmt.Sprintf(" │ %d tokens │ $%.4f", m.usage.TotalTokens(), m.usage.CostUSD)
+	}
+	right := "ctrl+t/ctrl+o tools · pgup/pgdn scroll · ctrl+c quit"
+	switch {
+	case m.ask != nil:
+		right = "waiting for your answer · esc to cancel"
+	case m.busy:
+		right = fmt.Sprintf("%s working %s · esc to cancel", m.spinner.View(), time.Since(m.started).Round(time.Second))
+	}
+	gap := max(m.width-lipgloss.Width(left)-lipgloss.Width(right)-2, 1)
+	return statusBarStyle.Width(m.width).Render(left + strings.Repeat(" ", gap) + right)
+}
+
+func (m *tuiModel) View() string {
+	if !m.ready {
+		return "Loading…"
+	}
+	return m.viewport.View() + "\n" + inputBorderStyle.Width(m.width).Render(m.input.View()) + "\n" + m.statusBar()
+}
+
+// -------------------------- 启动 --------------------------
+
+// runTUI 运行全屏界面，直到用户退出
+func runTUI(r *repl) error {
+	history, err := loadInputHistory(historyPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\u001b[93mWarning: %v\u001b[0m\n", err)
+	}
+
+	// 颜色与背景在重定向输出之前探测
+	terminalOut, terminalErr := os.Stdout, os.Stderr
+	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(terminalOut))
+	markdownStyle := "light"
+	if lipgloss.HasDarkBackground() {
+		markdownStyle = "dark"
+	}
+
+	model := newTUIModel(r, history, markdownStyle)
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithOutput(terminalOut))
+	model.program = program
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to redirect output: %w", err)
+	}
+	os.Stdout, os.Stderr = outW, outW
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := outR.Read(buf)
+			if n > 0 {
+				program.Send(outputMsg(buf[:n]))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		os.Stdout, os.Stderr = terminalOut, terminalErr
+		outW.Close()
+		<-copied
+		outR.Close()
+	}()
+
+	unsubscribe := r.session.Subscribe(agent.SubscriberFunc(func(e agent.Event) { program.Send(eventMsg{e}) }))
+	defer unsubscribe()
+	askUser = func(question string) (string, bool) {
+		reply := make(chan askReply, 1)
+		program.Send(askMsg{question: question, reply: reply})
+		answer := <-reply
+		return answer.text, answer.ok
+	}
+	runEditor = func(cmd *exec.Cmd) error {
+		cmd.Stdout, cmd.Stderr = terminalOut, terminalErr
+		done := make(chan error, 1)
+		program.Send(editorMsg{cmd: cmd, done: done})
+		return <-done
+	}
+
+	_, err = program.Run()
+	if model.cancel != nil {
+		model.cancel()
+	}
+	return err
+}
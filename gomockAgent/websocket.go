@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/websocket"
+
+	"gomockAgent/agent"
+)
+
+// -------------------------- WebSocket 通道 --------------------------
+// GET /v1/ws 在同一个连接上双向交互，供 IDE 插件使用：客户端发送用户消息、取消进行中的一轮、
+// 回答工具审批；服务端推送会话事件。
+//
+// 该端点要求服务以 -token 启动。浏览器无法为 WebSocket 设置 Authorization 头，因此 token 除了
+// Authorization: Bearer <token> 外，也可以通过查询参数 token=<token> 或子协议 bearer.<token> 传入；
+// 使用子协议时，服务端优先回应客户端同时提供的其他子协议。带 Origin 的握手只接受同源或 -allow-origin 列出的来源。
+//
+// 查询参数：
+//
+//	token=<token>          鉴权，见上文
+//	session=<id>           连接已有会话（例如 POST /v1/sessions 创建的会话，断开后保留，可重新连接）；
+//	                       省略时在握手成功后为本连接创建临时会话，连接关闭时删除
+//	after=<seq>            重新连接时只补发序号大于 seq 的事件
+//	require_approval=true  本连接创建的会话的每次工具调用都需要客户端通过 approval 帧批准；
+//	                       不能与 session 同时使用，已有会话的审批方式不受连接影响
+//
+// 协议版本 1。每个 WebSocket 文本消息是一个 JSON 对象（帧），都带有 "v" 与 "type"。
+// 完整的 JSON schema 见 GET /v1/ws/schema，即下面 wsClientFrame 与 wsServerFrame 生成的 schema。
+//
+// 客户端 → 服务端：
+//
+//	{"v":1,"type":"user_message","id":"c1","content":"..."}   开始新的一轮；已有一轮在进行时返回 error
+//	{"v":1,"type":"cancel","id":"c2"}                         取消进行中的一轮
+//	{"v":1,"type":"approval","id":"c3","call_id":"call_x","approved":true,"reason":"..."}
+//	{"v":1,"type":"ping","id":"c4"}
+//
+// 服务端 → 客户端：
+//
+//	{"v":1,"type":"welcome","session_id":"...","versions":[1]}          连接建立后的第一帧
+//	{"v":1,"type":"event","seq":3,"event":"tool_call_started","data":{...}}  与 SSE 的 data 相同
+//	{"v":1,"type":"ack","id":"c1"}                                       客户端帧已被接受
+//	{"v":1,"type":"error","id":"c1","code":"turn_running","message":"..."}
+//	{"v":1,"type":"pong","id":"c4"}
+//
+// 一轮的结果通过 assistant_text_delta、error 与 turn_finished 事件获得。
+// 收到 v 不受支持的帧时回复 code 为 unsupported_version 的 error 帧，连接保持打开；
+// 协议的不兼容修改会增加版本号，新增字段与帧类型不会。
+
+const wsProtocolVersion = 1
+
+// wsClientFrame 是客户端发送的帧
+type wsClientFrame struct {
+	V        int    `json:"v" jsonschema:"required,enum=1" jsonschema_description:"Protocol version."`
+	Type     string `json:"type" jsonschema:"required,enum=user_message,enum=cancel,enum=approval,enum=ping"`
+	ID       string `json:"id,omitempty" jsonschema_description:"Client-chosen id echoed in the ack, error or pong frame."`
+	Content  string `json:"content,omitempty" jsonschema_description:"user_message: the message text."`
+	CallID   string `json:"call_id,omitempty" jsonschema_description:"approval: the call_id of a tool_approval_requested event."`
+	Approved bool   `json:"approved,omitempty" jsonschema_description:"approval: true to run the tool, false to deny it."`
+	Reason   string `json:"reason,omitempty" jsonschema_description:"approval: optional reason, sent to the model when the call is denied."`
+}
+
+// wsServerFrame 是服务端发送的帧
+type wsServerFrame struct {
+	V         int    `json:"v" jsonschema:"required,enum=1" jsonschema_description:"Protocol version."`
+	Type      string `json:"type" jsonschema:"required,enum=welcome,enum=event,enum=ack,enum=error,enum=pong"`
+	ID        string `json:"id,omitempty" jsonschema_description:"The id of the client frame this frame answers."`
+	SessionID string `json:"session_id,omitempty" jsonschema_description:"welcome: the session this connection is attached to."`
+	Versions  []int  `json:"versions,omitempty" jsonschema_description:"welcome: protocol versions supported by the server."`
+	Seq       int    `json:"seq,omitempty" jsonschema_description:"event: sequence number, pass it as ?after= when reconnecting."`
+	Event     string `json:"event,omitempty" jsonschema:"enum=turn_started,enum=assistant_text_delta,enum=tool_call_started,enum=tool_approval_requested,enum=tool_call_finished,enum=notice,enum=error,enum=usage,enum=turn_finished" jsonschema_description:"event: the event type."`
+	Data      any    `json:"data,omitempty" jsonschema_description:"event: the event payload, always including session_id, turn and time."`
+	Code      string `json:"code,omitempty" jsonschema:"enum=invalid_frame,enum=unsupported_version,enum=unknown_type,enum=turn_running,enum=no_turn,enum=no_pending_approval" jsonschema_description:"error: machine-readable error code."`
+	Message   string `json:"message,omitempty" jsonschema_description:"error: human-readable description."`
+}
+
+func (s *APIServer) handleWebSocketSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version":      wsProtocolVersion,
+		"client_frame": agent.GenerateSchema[wsClientFrame](),
+		"server_frame": agent.GenerateSchema[wsServerFrame](),
+	})
+}
+
+// wsTokenProtocolPrefix 是以子协议传递 token 时的前缀
+const wsTokenProtocolPrefix = "bearer."
+
+// wsProtocols 返回客户端提供的子协议
+func wsProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(header, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	return protocols
+}
+
+// wsTokens 返回握手请求中以查询参数或子协议传递的 token
+func wsTokens(r *http.Request) []string {
+	var tokens []string
+	if t := r.URL.Query().Get("token"); t != "" {
+		tokens = append(tokens, t)
+	}
+	for _, p := range wsProtocols(r) {
+		if t, ok := strings.CutPrefix(p, wsTokenProtocolPrefix); ok && t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// handleWebSocket 在升级前解析已有会话，找不到时以普通 HTTP 错误返回；
+// 新会话在握手成功后才创建，握手失败不会留下会话
+func (s *APIServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.token == "" {
+		// 没有 token 时任何网页都能连接并驱动修改文件的工具
+		writeAPIError(w, http.StatusUnauthorized, "the WebSocket endpoint requires a token, start serve with -token or $GOMOCKAGENT_SERVE_TOKEN")
+		return
+	}
+	requireApproval, _ := strconv.ParseBool(r.URL.Query().Get("require_approval"))
+	var existing *serverSession
+	if id := r.URL.Query().Get("session"); id != "" {
+		if requireApproval {
+			// 否则任何持有 token 的连接都能替换别人会话的审批方式
+			writeAPIError(w, http.StatusBadRequest, "require_approval only applies to sessions created by the connection, omit session to create one")
+			return
+		}
+		s.mu.Lock()
+		existing = s.sessions[id]
+		s.mu.Unlock()
+		if existing == nil {
+			writeAPIError(w, http.StatusNotFound, "session "+strconv.Quote(id)+" not found")
+			return
+		}
+	}
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+	server := websocket.Server{
+		// 非浏览器客户端通常不发送 Origin；浏览器的跨站握手被拒绝（403）
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			if !s.originAllowed(req) {
+				return errors.New("origin not allowed")
+			}
+			config.Origin, _ = websocket.Origin(config, req)
+			// 只回应一个子协议，且尽量不回显 token
+			config.Protocol = nil
+			for _, p := range wsProtocols(req) {
+				if !strings.HasPrefix(p, wsTokenProtocolPrefix) {
+					config.Protocol = []string{p}
+					break
+				}
+				if config.Protocol == nil {
+					config.Protocol = []string{p}
+				}
+			}
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			ss := existing
+			if ss == nil {
+				ss = s.newSession(s.agent.NewSession(), true)
+				defer s.removeSession(ss)
+				if requireApproval && !s.requireApproval {
+					ss.SetApprover(ss.waitForApproval(s.approvalTimeout))
+				}
+			}
+			s.serveWebSocket(conn, ss, after)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (s *APIServer) serveWebSocket(conn *websocket.Conn, ss *serverSession, after int) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	// websocket.Conn 的写操作自带锁，事件与回复可以在不同 goroutine 中发送
+	send := func(f wsServerFrame) error {
+		f.V = wsProtocolVersion
+		return websocket.JSON.Send(conn, f)
+	}
+	if err := send(wsServerFrame{Type: "welcome", SessionID: ss.ID, Versions: []int{wsProtocolVersion}}); err != nil {
+		return
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			events, changed, closed := ss.events.since(after)
+			for _, e := range events {
+				if err := send(wsServerFrame{Type: "event", Seq: e.Seq, Event: e.Type, Data: e.Data}); err != nil {
+					return
+				}
+				after = e.Seq
+			}
+			if closed {
+				return // 会话已被删除
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close() // 让阻塞中的 Receive 返回
+	}()
+	for {
+		var raw json.RawMessage
+		if err := websocket.JSON.Receive(conn, &raw); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				_ = send(wsServerFrame{Type: "error", Code: "invalid_frame", Message: err.Error()})
+				continue
+			}
+			return // 连接已关闭
+		}
+		if reply := s.handleClientFrame(ss, raw); reply.Type != "" {
+			if err := send(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleClientFrame 处理一个客户端帧，返回要发送的回复
+func (s *APIServer) handleClientFrame(ss *serverSession, raw json.RawMessage) wsServerFrame {
+	var f wsClientFrame
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return wsServerFrame{Type: "error", Code: "invalid_frame", Message: err.Error()}
+	}
+	fail := func(code, message string) wsServerFrame {
+		return wsServerFrame{Type: "error", ID: f.ID, Code: code, Message: message}
+	}
+	if f.V != wsProtocolVersion {
+		return fail("unsupported_version", "unsupported protocol version "+strconv.Itoa(f.V)+", this server speaks version "+strconv.Itoa(wsProtocolVersion))
+	}
+	ack := wsServerFrame{Type: "ack", ID: f.ID}
+
+	switch f.Type {
+	case "ping":
+		return wsServerFrame{Type: "pong", ID: f.ID}
+	case "user_message":
+		if strings.TrimSpace(f.Content) == "" {
+			return fail("invalid_frame", "content must not be empty")
+		}
+		// 本轮属于会话而不是连接：连接断开不会取消已有会话中的一轮，服务关闭或会话被删除时才取消
+		if _, ok := ss.sendAsync(s.ctx, f.Content); !ok {
+			return fail("turn_running", "a turn is already running in this session")
+		}
+		return ack
+	case "cancel":
+		if !ss.cancelTurn() {
+			return fail("no_turn", "no turn is running in this session")
+		}
+		return ack
+	case "approval":
+		if !ss.decide(f.CallID, approvalDecision{Approved: f.Approved, Reason: f.Reason}) {
+			return fail("no_pending_approval", "no pending approval for tool call "+strconv.Quote(f.CallID))
+		}
+		return ack
+	}
+	return fail("unknown_type", "unknown frame type "+strconv.Quote(f.Type))
+}
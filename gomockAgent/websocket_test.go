@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"gomockAgent/agent"
+)
+
+func TestWebSocketHandshakeAuth(t *testing.T) {
+	newServer := func(token string) *httptest.Server {
+		s := NewAPIServer(context.Background(), agent.New(agent.Options{Endpoint: "http://127.0.0.1:0"}))
+		s.token = token
+		ts := httptest.NewServer(s.Handler())
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	dial := func(ts *httptest.Server, query, origin string, protocols ...string) (*websocket.Conn, error) {
+		config, err := websocket.NewConfig("ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/ws"+query, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Protocol = protocols
+		return websocket.DialConfig(config)
+	}
+	welcome := func(t *testing.T, conn *websocket.Conn) {
+		t.Helper()
+		defer conn.Close()
+		var frame wsServerFrame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil || frame.Type != "welcome" {
+			t.Fatalf("expected a welcome frame, got %+v, %v", frame, err)
+		}
+	}
+
+	open := newServer("")
+	if _, err := dial(open, "", open.URL); err == nil {
+		t.Error("handshake without a configured token must fail")
+	}
+
+	ts := newServer("secret")
+	sameOrigin := ts.URL
+	t.Run("query token", func(t *testing.T) {
+		conn, err := dial(ts, "?token=secret", sameOrigin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		welcome(t, conn)
+	})
+	t.Run("subprotocol token", func(t *testing.T) {
+		conn, err := dial(ts, "", sameOrigin, "gomockagent", "bearer.secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.Config().Protocol; len(got) != 1 || got[0] != "gomockagent" {
+			t.Errorf("negotiated protocol = %v, want [gomockagent]", got)
+		}
+		welcome(t, conn)
+	})
+	t.Run("wrong token", func(t *testing.T) {
+		if _, err := dial(ts, "?token=wrong", sameOrigin); err == nil {
+			t.Error("expected the handshake to fail")
+		}
+	})
+	t.Run("cross-site origin", func(t *testing.T) {
+		if _, err := dial(ts, "?token=secret", "http://evil.example"); err == nil {
+			t.Error("expected the handshake to fail")
+		}
+	})
+}
+
+func TestWebSocketSessionLifecycle(t *testing.T) {
+	s := NewAPIServer(context.Background(), agent.New(agent.Options{Endpoint: "http://127.0.0.1:0"}))
+	s.token = "secret"
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	dial := func(query, origin string) (*websocket.Conn, error) {
+		return websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/ws?token=secret"+query, "", origin)
+	}
+	sessionCount := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.sessions)
+	}
+
+	t.Run("failed handshake leaves no session", func(t *testing.T) {
+		if _, err := dial("", "http://evil.example"); err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+		if n := sessionCount(); n != 0 {
+			t.Fatalf("%d session(s) left after a failed handshake", n)
+		}
+	})
+
+	t.Run("new session is removed on close", func(t *testing.T) {
+		conn, err := dial("", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var frame wsServerFrame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil || frame.Type != "welcome" {
+			t.Fatalf("expected a welcome frame, got %+v, %v", frame, err)
+		}
+		s.mu.Lock()
+		ss := s.sessions[frame.SessionID]
+		s.mu.Unlock()
+		if ss == nil || !ss.ephemeral {
+			t.Fatalf("session %s is not registered as ephemeral", frame.SessionID)
+		}
+		conn.Close()
+		deadline := time.Now().Add(5 * time.Second)
+		for sessionCount() != 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("session was not removed after the connection closed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("existing session is kept on close", func(t *testing.T) {
+		ss := s.newSession(s.agent.NewSession(), false)
+		t.Cleanup(func() { s.removeSession(ss) })
+		conn, err := dial("&session="+ss.ID, ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var frame wsServerFrame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil || frame.SessionID != ss.ID {
+			t.Fatalf("expected a welcome frame for %s, got %+v, %v", ss.ID, frame, err)
+		}
+		conn.Close()
+		time.Sleep(50 * time.Millisecond)
+		s.mu.Lock()
+		_, ok := s.sessions[ss.ID]
+		s.mu.Unlock()
+		if !ok {
+			t.Fatal("an existing session must survive the connection")
+		}
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		if _, err := dial("&session=missing", ts.URL); err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+	})
+}
+
+// require_approval 只作用于本连接创建的会话
+func TestWebSocketRequireApproval(t *testing.T) {
+	// 第一次请求返回工具调用，之后返回文本
+	var calls atomic.Int32
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := agent.OpenAIChatCompletionMessage{Role: "assistant", Content: "done"}
+		finish := "stop"
+		if calls.Add(1) == 1 {
+			message = agent.OpenAIChatCompletionMessage{Role: "assistant", ToolCalls: []agent.OpenAIChatCompletionToolCall{{
+				ID: "call_1", Type: "function",
+				Function: agent.OpenAIChatCompletionFunctionCall{Name: "echo", Arguments: `{"text":"hi"}`},
+			}}}
+			finish = "tool_calls"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(agent.OpenAIChatCompletionResponse{
+			Choices: []agent.OpenAIChatCompletionChoice{{Message: message, FinishReason: finish}},
+		})
+	}))
+	t.Cleanup(llm.Close)
+	type echoInput struct {
+		Text string `json:"text" jsonschema:"required"`
+	}
+	echo := agent.NewTool("echo", "Echo the text.", func(ctx context.Context, in echoInput) (string, error) { return in.Text, nil })
+
+	s := NewAPIServer(context.Background(), agent.New(agent.Options{Endpoint: llm.URL, Tools: []agent.ToolDefinition{echo}}))
+	s.token = "secret"
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/ws?token=secret&require_approval=true"
+
+	t.Run("existing session", func(t *testing.T) {
+		ss := s.newSession(s.agent.NewSession(), false)
+		t.Cleanup(func() { s.removeSession(ss) })
+		if _, err := websocket.Dial(url+"&session="+ss.ID, "", ts.URL); err == nil {
+			t.Fatal("require_approval must not be honoured on an existing session")
+		}
+	})
+
+	t.Run("new session", func(t *testing.T) {
+		conn, err := websocket.Dial(url, "", ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := websocket.JSON.Send(conn, wsClientFrame{V: wsProtocolVersion, Type: "user_message", ID: "c1", Content: "echo hi"}); err != nil {
+			t.Fatal(err)
+		}
+		approved := false
+		for {
+			var frame wsServerFrame
+			if err := websocket.JSON.Receive(conn, &frame); err != nil {
+				t.Fatal(err)
+			}
+			switch frame.Event {
+			case "tool_approval_requested":
+				data, _ := frame.Data.(map[string]any)
+				if data["call_id"] != "call_1" {
+					t.Fatalf("approval request = %v", frame.Data)
+				}
+				approved = true
+				if err := websocket.JSON.Send(conn, wsClientFrame{V: wsProtocolVersion, Type: "approval", ID: "c2", CallID: "call_1", Approved: true}); err != nil {
+					t.Fatal(err)
+				}
+			case "turn_finished":
+				if !approved {
+					t.Fatal("turn finished without an approval request")
+				}
+				return
+			}
+		}
+	})
+}
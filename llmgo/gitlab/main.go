@@ -114,11 +114,20 @@ func llmClient() (*openai.LLM, error) {
 
 func LLM(llm *openai.LLM, diff string) (string, error) {
 	ctx := context.Background()
-	prompt := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "作为一个golang专业开发人员，请根据git diff中的内容中获取所有被改动的函数，注意改动的函数必须是在函数体内部进行有效修改;无效修改包含添加注释, 添加日志, 语句中添加空格等相关操作; "),
-		llms.TextParts(llms.ChatMessageTypeHuman, diff),
+	system, err := reviewerPrompt()
+	if err != nil {
+		return "", err
+	}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, system.Text)}
+	for _, m := range system.Examples {
+		role := llms.ChatMessageTypeHuman
+		if m.Role == "assistant" {
+			role = llms.ChatMessageTypeAI
+		}
+		messages = append(messages, llms.TextParts(role, m.Content))
 	}
-	completion, err := llm.GenerateContent(ctx, prompt)
+	messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, diff))
+	completion, err := llm.GenerateContent(ctx, messages)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 提示模板在 prompts/ 中，$REVIEW_PROMPTS_DIR 中的同名文件可以覆盖，语言由 $GOMOCKAGENT_LOCALE 或 $LANG 决定。
+// 格式与 gomockAgent 的 prompt 包相同（YAML frontmatter + text/template），这里只实现审查需要的部分，
+// 让 llmgo 不依赖同级模块。
+//
+//go:embed prompts/*.tmpl
+var promptFiles embed.FS
+
+// promptMeta 是模板的 frontmatter
+type promptMeta struct {
+	Variables map[string]struct {
+		Default any `yaml:"default"`
+	} `yaml:"variables"`
+	Examples []struct {
+		User      string `yaml:"user"`
+		Assistant string `yaml:"assistant"`
+	} `yaml:"examples"`
+}
+
+// promptMessage 是渲染后的一条 few-shot 消息，Role 为 user 或 assistant
+type promptMessage struct {
+	Role    string
+	Content string
+}
+
+// renderedPrompt 是渲染后的系统提示与示例
+type renderedPrompt struct {
+	Text     string
+	Examples []promptMessage
+}
+
+func reviewerPrompt() (*renderedPrompt, error) {
+	builtin, _ := fs.Sub(promptFiles, "prompts")
+	fsyss := []fs.FS{builtin}
+	if dir := os.Getenv("REVIEW_PROMPTS_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			// 覆盖目录优先
+			fsyss = append([]fs.FS{os.DirFS(dir)}, fsyss...)
+		}
+	}
+	return renderPrompt(fsyss, "reviewer", promptLocale())
+}
+
+// renderPrompt 按 name.<locale>.tmpl、name.<主语言标签>.tmpl、name.tmpl 的顺序查找并以变量默认值渲染
+func renderPrompt(fsyss []fs.FS, name, locale string) (*renderedPrompt, error) {
+	candidates := []string{}
+	if locale != "" {
+		candidates = append(candidates, name+"."+locale+".tmpl")
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, name+"."+locale[:i]+".tmpl")
+		}
+	}
+	candidates = append(candidates, name+".tmpl")
+	for _, file := range candidates {
+		for _, fsys := range fsyss {
+			text, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				continue
+			}
+			return parsePrompt(file, string(text))
+		}
+	}
+	return nil, fmt.Errorf("prompt %q not found", name)
+}
+
+func parsePrompt(source, text string) (*renderedPrompt, error) {
+	var meta promptMeta
+	body := strings.TrimPrefix(text, "\ufeff")
+	if strings.HasPrefix(body, "---\n") || strings.HasPrefix(body, "---\r\n") {
+		rest := body[strings.Index(body, "\n")+1:]
+		end := strings.Index(rest, "\n---")
+		if end < 0 {
+			return nil, fmt.Errorf("prompt %s: unterminated frontmatter", source)
+		}
+		if err := yaml.Unmarshal([]byte(rest[:end]), &meta); err != nil {
+			return nil, fmt.Errorf("prompt %s: invalid frontmatter: %w", source, err)
+		}
+		body = rest[end+len("\n---"):]
+		if i := strings.Index(body, "\n"); i >= 0 {
+			body = body[i+1:]
+		} else {
+			body = ""
+		}
+	}
+
+	data := map[string]any{}
+	for name, v := range meta.Variables {
+		data[name] = v.Default
+	}
+	render := func(text string) (string, error) {
+		t, err := template.New(source).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("prompt %s: %w", source, err)
+		}
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return "", fmt.Errorf("prompt %s: %w", source, err)
+		}
+		return sb.String(), nil
+	}
+
+	out := &renderedPrompt{}
+	var err error
+	if out.Text, err = render(body); err != nil {
+		return nil, err
+	}
+	for _, e := range meta.Examples {
+		user, err := render(e.User)
+		if err != nil {
+			return nil, err
+		}
+		assistant, err := render(e.Assistant)
+		if err != nil {
+			return nil, err
+		}
+		out.Examples = append(out.Examples, promptMessage{Role: "user", Content: user}, promptMessage{Role: "assistant", Content: assistant})
+	}
+	return out, nil
+}
+
+// promptLocale 从 $GOMOCKAGENT_LOCALE、$LC_ALL、$LC_MESSAGES、$LANG 推断语言，例如 zh_CN.UTF-8 → zh-cn
+func promptLocale() string {
+	for _, env := range []string{"GOMOCKAGENT_LOCALE", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		if i := strings.IndexAny(v, ".@"); i >= 0 {
+			v = v[:i]
+		}
+		if v == "C" || v == "POSIX" {
+			return ""
+		}
+		return strings.ToLower(strings.ReplaceAll(v, "_", "-"))
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	builtin, _ := fs.Sub(promptFiles, "prompts")
+	override := fstest.MapFS{
+		"reviewer.fr.tmpl": {Data: []byte("---\nvariables:\n  language: {default: Go}\nexamples:\n  - user: diff {{.language}}\n    assistant: ok\n---\nRelis le code {{.language}}.\n")},
+	}
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", "作为一个golang专业开发人员"},
+		{"en-us", "As a professional Go developer"},
+		{"zh-cn", "作为一个golang专业开发人员"},
+		{"fr", "Relis le code Go."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			p, err := renderPrompt([]fs.FS{override, builtin}, "reviewer", tt.locale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(p.Text, tt.want) {
+				t.Fatalf("Text = %q, want prefix %q", p.Text, tt.want)
+			}
+			if strings.Contains(p.Text, "---") {
+				t.Fatalf("frontmatter was not stripped: %q", p.Text)
+			}
+		})
+	}
+
+	p, err := renderPrompt([]fs.FS{override, builtin}, "reviewer", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Examples) != 2 || p.Examples[0].Content != "diff Go" || p.Examples[1].Role != "assistant" {
+		t.Fatalf("Examples = %+v", p.Examples)
+	}
+	if _, err := renderPrompt([]fs.FS{builtin}, "missing", ""); err == nil {
+		t.Fatal("expected an error for a missing prompt")
+	}
+}
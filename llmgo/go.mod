@@ -3,14 +3,18 @@ module llmgo
 go 1.23.3
 
 require (
-	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/tmc/langchaingo v0.1.13
+	gitlab.com/gitlab-org/api/client-go v0.128.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
 	github.com/pkoukk/tiktoken-go v0.1.6 // indirect
-	github.com/tmc/langchaingo v0.1.13 // indirect
-	gitlab.com/gitlab-org/api/client-go v0.128.0 // indirect
 	golang.org/x/oauth2 v0.25.0 // indirect
 	golang.org/x/time v0.10.0 // indirect
 )